@@ -0,0 +1,648 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ActivityPubConfig controls publishing the blog to the Fediverse
+type ActivityPubConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Username string `yaml:"username"` // the blog is followed as @username@host
+}
+
+// Follower is a Fediverse account following the blog, stored in data/followers.json
+type Follower struct {
+	ID       string    `json:"id"`
+	Inbox    string    `json:"inbox"`
+	Followed time.Time `json:"followed"`
+}
+
+// apActor is the part of a remote actor document Podium needs
+type apActor struct {
+	ID        string `json:"id"`
+	Inbox     string `json:"inbox"`
+	Endpoints struct {
+		SharedInbox string `json:"sharedInbox"`
+	} `json:"endpoints"`
+	PublicKey struct {
+		ID           string `json:"id"`
+		Owner        string `json:"owner"`
+		PublicKeyPem string `json:"publicKeyPem"`
+	} `json:"publicKey"`
+}
+
+// apActivity is an incoming activity
+type apActivity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+const (
+	activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+	activityStreamsPublic  = "https://www.w3.org/ns/activitystreams#Public"
+	activityJSONType       = "application/activity+json"
+)
+
+var (
+	followerStore = newJSONStore("followers.json")
+
+	apKeyMu sync.Mutex
+	apKey   *rsa.PrivateKey
+
+	// activityPubClient fetches remote actors and delivers activities. Tests
+	// can swap it for a client that reaches an in-process fake server.
+	activityPubClient = newPublicHTTPClient(15 * time.Second)
+)
+
+func init() {
+	onPublish(deliverActivityPubPost)
+}
+
+// apActorURL returns the ID of the blog's actor
+func apActorURL() string {
+	return appConfig.SiteURL + "/ap/actor"
+}
+
+// wantsActivityJSON reports whether a request asks for ActivityPub JSON instead of HTML
+func wantsActivityJSON(c *gin.Context) bool {
+	accept := c.GetHeader("Accept")
+	return strings.Contains(accept, activityJSONType) ||
+		(strings.Contains(accept, "application/ld+json") && strings.Contains(accept, "activitystreams"))
+}
+
+// activityJSON writes an ActivityPub JSON response
+func activityJSON(c *gin.Context, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, activityJSONType+"; charset=utf-8", data)
+}
+
+// apPrivateKey loads the blog's signing key from the data folder, creating it on first use
+func apPrivateKey() (*rsa.PrivateKey, error) {
+	apKeyMu.Lock()
+	defer apKeyMu.Unlock()
+	if apKey != nil {
+		return apKey, nil
+	}
+
+	path := filepath.Join(appConfig.DataFolder, "activitypub-key.pem")
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(appConfig.DataFolder, 0755); err != nil {
+			return nil, err
+		}
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			return nil, err
+		}
+		log.Printf("Created ActivityPub signing key: %s", path)
+		apKey = key
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	apKey = key
+	return key, nil
+}
+
+// WebFinger lookup (RFC 7033), how Mastodon finds @username@host
+func handleWebFinger(c *gin.Context) {
+	if !appConfig.ActivityPub.Enabled {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	site, err := url.Parse(appConfig.SiteURL)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	subject := "acct:" + appConfig.ActivityPub.Username + "@" + site.Host
+	resource := c.Query("resource")
+	if !strings.EqualFold(resource, subject) && resource != apActorURL() {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(gin.H{
+		"subject": subject,
+		"aliases": []string{apActorURL(), appConfig.SiteURL + "/"},
+		"links": []gin.H{
+			{"rel": "self", "type": activityJSONType, "href": apActorURL()},
+			{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": appConfig.SiteURL + "/"},
+		},
+	})
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Data(http.StatusOK, "application/jrd+json; charset=utf-8", data)
+}
+
+// The blog's ActivityPub actor
+func handleActor(c *gin.Context) {
+	if !appConfig.ActivityPub.Enabled {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	key, err := apPrivateKey()
+	if err != nil {
+		log.Printf("Error loading ActivityPub key: %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	site := languageConfig(defaultLanguage())
+	actor := apActorURL()
+	activityJSON(c, http.StatusOK, gin.H{
+		"@context":                  []string{activityStreamsContext, "https://w3id.org/security/v1"},
+		"id":                        actor,
+		"type":                      "Person",
+		"preferredUsername":         appConfig.ActivityPub.Username,
+		"name":                      site.SiteTitle,
+		"summary":                   site.SiteDescription,
+		"url":                       appConfig.SiteURL + "/",
+		"inbox":                     appConfig.SiteURL + "/ap/inbox",
+		"outbox":                    appConfig.SiteURL + "/ap/outbox",
+		"followers":                 appConfig.SiteURL + "/ap/followers",
+		"manuallyApprovesFollowers": false,
+		"discoverable":              true,
+		"publicKey": gin.H{
+			"id":           actor + "#main-key",
+			"owner":        actor,
+			"publicKeyPem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+		},
+	})
+}
+
+// The outbox lists the latest posts as Create activities
+func handleOutbox(c *gin.Context) {
+	if !appConfig.ActivityPub.Enabled {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	posts := getBlogPosts()
+	if len(posts) > appConfig.FeedItems {
+		posts = posts[:appConfig.FeedItems]
+	}
+
+	lang := defaultLanguage()
+	var items []interface{}
+	for _, post := range posts {
+		doc, err := loadMarkdownFile("posts", langFileSlug(post.Slug, lang))
+		if err != nil {
+			continue
+		}
+		items = append(items, apActivityFor("Create", post.Slug, lang, doc))
+	}
+	activityJSON(c, http.StatusOK, gin.H{
+		"@context":     activityStreamsContext,
+		"id":           appConfig.SiteURL + "/ap/outbox",
+		"type":         "OrderedCollection",
+		"totalItems":   len(items),
+		"orderedItems": items,
+	})
+}
+
+// The followers collection only reveals how many followers there are
+func handleFollowers(c *gin.Context) {
+	if !appConfig.ActivityPub.Enabled {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	var followers []Follower
+	if err := followerStore.Read(&followers); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	activityJSON(c, http.StatusOK, gin.H{
+		"@context":   activityStreamsContext,
+		"id":         appConfig.SiteURL + "/ap/followers",
+		"type":       "OrderedCollection",
+		"totalItems": len(followers),
+	})
+}
+
+// The inbox accepts Follow and Undo(Follow); other activities are ignored
+func handleInbox(c *gin.Context) {
+	if !appConfig.ActivityPub.Enabled {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	body, err := readLimited(c.Request.Body, 1<<20)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	var activity apActivity
+	if err := json.Unmarshal(body, &activity); err != nil || activity.Actor == "" {
+		c.String(http.StatusBadRequest, "invalid activity\n")
+		return
+	}
+
+	switch activity.Type {
+	case "Follow", "Undo":
+	default:
+		c.Status(http.StatusAccepted)
+		return
+	}
+
+	remote, err := verifyHTTPSignature(c.Request, body)
+	if err != nil || remote.ID != activity.Actor {
+		log.Printf("Rejected ActivityPub %s from %s: signature %v", activity.Type, activity.Actor, err)
+		c.String(http.StatusUnauthorized, "invalid signature\n")
+		return
+	}
+
+	switch activity.Type {
+	case "Follow":
+		var object string
+		if json.Unmarshal(activity.Object, &object) != nil || object != apActorURL() {
+			c.String(http.StatusBadRequest, "can only follow %s\n", apActorURL())
+			return
+		}
+		inbox := remote.Endpoints.SharedInbox
+		if inbox == "" {
+			inbox = remote.Inbox
+		}
+		err := updateFollowers(func(followers []Follower) []Follower {
+			for _, f := range followers {
+				if f.ID == remote.ID {
+					return followers
+				}
+			}
+			return append(followers, Follower{ID: remote.ID, Inbox: inbox, Followed: time.Now()})
+		})
+		if err != nil {
+			log.Printf("Error saving follower %s: %v", remote.ID, err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		log.Printf("New Fediverse follower: %s", remote.ID)
+
+		accept := gin.H{
+			"@context": activityStreamsContext,
+			"id":       apActorURL() + "#accept-" + randomID(8),
+			"type":     "Accept",
+			"actor":    apActorURL(),
+			"object":   json.RawMessage(body),
+		}
+		goBackground(func() {
+			if err := postActivity(remote.Inbox, accept); err != nil {
+				log.Printf("Error accepting follow from %s: %v", remote.ID, err)
+			}
+		})
+
+	case "Undo":
+		var object apActivity
+		if json.Unmarshal(activity.Object, &object) != nil || object.Type != "Follow" {
+			c.Status(http.StatusAccepted)
+			return
+		}
+		err := updateFollowers(func(followers []Follower) []Follower {
+			var kept []Follower
+			for _, f := range followers {
+				if f.ID != remote.ID {
+					kept = append(kept, f)
+				}
+			}
+			return kept
+		})
+		if err != nil {
+			log.Printf("Error removing follower %s: %v", remote.ID, err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Fediverse follower left: %s", remote.ID)
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func updateFollowers(fn func([]Follower) []Follower) error {
+	var followers []Follower
+	return followerStore.Update(&followers, func() error {
+		followers = fn(followers)
+		return nil
+	})
+}
+
+// apArticle returns the ActivityPub Article for a post
+func apArticle(slug, lang string, doc *MarkdownFile) gin.H {
+	postURL := appConfig.SiteURL + langPrefix(lang) + "/posts/" + slug
+	var tags []gin.H
+	for _, tag := range doc.Tags {
+		tags = append(tags, gin.H{
+			"type": "Hashtag",
+			"name": "#" + strings.Replace(tag, " ", "", -1),
+			"href": appConfig.SiteURL + langPrefix(lang) + "/tags/" + url.PathEscape(tag),
+		})
+	}
+	article := gin.H{
+		"id":           postURL,
+		"type":         "Article",
+		"attributedTo": apActorURL(),
+		"name":         doc.Title,
+		"summary":      postDescription(doc),
+		"content":      doc.HTML,
+		"contentMap":   gin.H{lang: doc.HTML},
+		"url":          postURL,
+		"to":           []string{activityStreamsPublic},
+		"cc":           []string{appConfig.SiteURL + "/ap/followers"},
+		"tag":          tags,
+	}
+	if published := apDate(doc); published != "" {
+		article["published"] = published
+	}
+	return article
+}
+
+// apActivityFor wraps a post's Article in a Create or Update activity
+func apActivityFor(activityType, slug, lang string, doc *MarkdownFile) gin.H {
+	article := apArticle(slug, lang, doc)
+	activity := gin.H{
+		"@context": activityStreamsContext,
+		"id":       fmt.Sprintf("%s#%s", article["id"], strings.ToLower(activityType)),
+		"type":     activityType,
+		"actor":    apActorURL(),
+		"object":   article,
+		"to":       article["to"],
+		"cc":       article["cc"],
+	}
+	if published, ok := article["published"]; ok {
+		activity["published"] = published
+	}
+	return activity
+}
+
+// apDate returns the publication date of a post as an ActivityStreams date-time
+func apDate(doc *MarkdownFile) string {
+	date := metaDate(doc.Date, doc.PublishDate)
+	if len(date) == len("2006-01-02") {
+		date += "T00:00:00Z"
+	}
+	return date
+}
+
+// deliverActivityPubPost sends a published or edited post to every follower's inbox
+func deliverActivityPubPost(ev PublishEvent) {
+	if !appConfig.ActivityPub.Enabled {
+		return
+	}
+	var followers []Follower
+	if err := followerStore.Read(&followers); err != nil {
+		log.Printf("Warning: Failed to read followers: %v", err)
+		return
+	}
+	if len(followers) == 0 {
+		return
+	}
+
+	activityType := "Create"
+	if ev.Updated {
+		activityType = "Update"
+	}
+	activity := apActivityFor(activityType, ev.Slug, ev.Lang, ev.Doc)
+
+	// Followers on the same server share an inbox, deliver once per inbox
+	inboxes := map[string]bool{}
+	for _, f := range followers {
+		inboxes[f.Inbox] = true
+	}
+	goBackground(func() {
+		for inbox := range inboxes {
+			if err := postActivity(inbox, activity); err != nil {
+				log.Printf("ActivityPub delivery to %s failed: %v", inbox, err)
+			}
+		}
+		log.Printf("Delivered %s for %s to %d inbox(es)", activityType, ev.URL, len(inboxes))
+	})
+}
+
+// postActivity delivers an activity to an inbox with an HTTP signature
+func postActivity(inbox string, activity interface{}) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", activityJSONType)
+	if err := signRequest(req, body); err != nil {
+		return err
+	}
+	resp, err := activityPubClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("inbox returned %s", resp.Status)
+	}
+	return nil
+}
+
+// fetchActor fetches a remote actor document with a signed GET, which servers
+// running in "secure mode" require
+func fetchActor(actorURL string) (*apActor, error) {
+	req, err := http.NewRequest(http.MethodGet, actorURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", activityJSONType)
+	if err := signRequest(req, nil); err != nil {
+		return nil, err
+	}
+	resp, err := activityPubClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", actorURL, resp.Status)
+	}
+	body, err := readLimited(resp.Body, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	var actor apActor
+	if err := json.Unmarshal(body, &actor); err != nil {
+		return nil, err
+	}
+	return &actor, nil
+}
+
+// signRequest adds Date, Digest and Signature headers (draft-cavage-http-signatures,
+// as used by Mastodon) to an outgoing request
+func signRequest(req *http.Request, body []byte) error {
+	key, err := apPrivateKey()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		sum := sha256.Sum256(body)
+		req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+		headers = append(headers, "digest")
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(req, headers)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s#main-key",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		apActorURL(), strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// verifyHTTPSignature checks the signature of an incoming request against the
+// sender's public key and returns the sender's actor
+func verifyHTTPSignature(req *http.Request, body []byte) (*apActor, error) {
+	params := map[string]string{}
+	for _, part := range strings.Split(req.Header.Get("Signature"), ",") {
+		if i := strings.Index(part, "="); i > 0 {
+			params[strings.TrimSpace(part[:i])] = strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+		}
+	}
+	if params["keyId"] == "" || params["signature"] == "" {
+		return nil, errors.New("missing signature")
+	}
+	headers := strings.Fields(params["headers"])
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	if !containsString(headers, "(request-target)") || !containsString(headers, "digest") || !containsString(headers, "date") {
+		return nil, errors.New("signature must cover (request-target), digest and date")
+	}
+
+	sum := sha256.Sum256(body)
+	if req.Header.Get("Digest") != "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]) {
+		return nil, errors.New("digest mismatch")
+	}
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil || time.Since(date) > 12*time.Hour || time.Until(date) > 12*time.Hour {
+		return nil, errors.New("date missing or out of range")
+	}
+
+	keyURL := params["keyId"]
+	if i := strings.Index(keyURL, "#"); i >= 0 {
+		keyURL = keyURL[:i]
+	}
+	actor, err := fetchActor(keyURL)
+	if err != nil {
+		return nil, err
+	}
+	if actor.PublicKey.ID != params["keyId"] {
+		return nil, errors.New("key id does not match actor")
+	}
+	// Any server can publish a document claiming another actor's id, so the
+	// key, its owner and the actor must all live on the server the key came from
+	if actor.PublicKey.Owner != actor.ID {
+		return nil, errors.New("key is not owned by the actor")
+	}
+	if !sameOrigin(keyURL, actor.ID) {
+		return nil, errors.New("key and actor are on different servers")
+	}
+	block, _ := pem.Decode([]byte(actor.PublicKey.PublicKeyPem))
+	if block == nil {
+		return nil, errors.New("actor has no public key")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+	sig, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return nil, err
+	}
+	hashed := sha256.Sum256([]byte(signingString(req, headers)))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hashed[:], sig); err != nil {
+		return nil, err
+	}
+	return actor, nil
+}
+
+// sameOrigin reports whether two URLs have the same scheme and host
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Host != "" && strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// signingString builds the string covered by an HTTP signature
+func signingString(req *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, h := range headers {
+		switch h {
+		case "(request-target)":
+			lines[i] = "(request-target): " + strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "host":
+			host := req.Host
+			if host == "" {
+				host = req.URL.Host
+			}
+			lines[i] = "host: " + host
+		default:
+			lines[i] = h + ": " + req.Header.Get(h)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeFediverse is an in-process stand-in for a remote server: it publishes
+// actor documents and records what is delivered to their inboxes
+type fakeFediverse struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	actors    map[string]gin.H // by path
+	delivered []deliveredActivity
+}
+
+type deliveredActivity struct {
+	Signature string
+	Activity  apActivity
+}
+
+func newFakeFediverse(t *testing.T) *fakeFediverse {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeFediverse{key: key, actors: map[string]gin.H{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeFediverse) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/inbox") {
+		var activity apActivity
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &activity)
+		f.delivered = append(f.delivered, deliveredActivity{Signature: r.Header.Get("Signature"), Activity: activity})
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	actor, ok := f.actors[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", activityJSONType)
+	json.NewEncoder(w).Encode(actor)
+}
+
+// addActor publishes an actor at path with the server's key. The id and key
+// owner default to the actor's own URL and can be overridden to forge them.
+func (f *fakeFediverse) addActor(path, id, owner string) string {
+	pub, _ := x509.MarshalPKIXPublicKey(&f.key.PublicKey)
+	actorURL := f.URL + path
+	if id == "" {
+		id = actorURL
+	}
+	if owner == "" {
+		owner = id
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actors[path] = gin.H{
+		"id":    id,
+		"type":  "Person",
+		"inbox": actorURL + "/inbox",
+		"publicKey": gin.H{
+			"id":           actorURL + "#main-key",
+			"owner":        owner,
+			"publicKeyPem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+		},
+	}
+	return actorURL
+}
+
+func (f *fakeFediverse) deliveries() []deliveredActivity {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]deliveredActivity(nil), f.delivered...)
+}
+
+// inboxRequest builds a request to the blog's inbox signed with key as keyID
+// over the given headers; no headers leaves the request unsigned
+func inboxRequest(t *testing.T, key *rsa.PrivateKey, keyID string, body []byte, headers ...string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, appConfig.SiteURL+"/ap/inbox", bytes.NewReader(body))
+	req.Header.Set("Content-Type", activityJSONType)
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	sum := sha256.Sum256(body)
+	req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+	if len(headers) == 0 {
+		return req
+	}
+	hashed := sha256.Sum256([]byte(signingString(req, headers)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig)))
+	return req
+}
+
+var signedHeaders = []string{"(request-target)", "host", "date", "digest"}
+
+// useActivityPub enables ActivityPub for a test and returns a router with its routes
+func useActivityPub(t *testing.T) *gin.Engine {
+	t.Helper()
+	useTestNetwork(t)
+	config := appConfig.ActivityPub
+	appConfig.ActivityPub = ActivityPubConfig{Enabled: true, Username: "blog"}
+	t.Cleanup(func() { appConfig.ActivityPub = config })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/.well-known/webfinger", handleWebFinger)
+	router.GET("/ap/actor", handleActor)
+	router.POST("/ap/inbox", handleInbox)
+	return router
+}
+
+func serve(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func storedFollowers(t *testing.T) []Follower {
+	t.Helper()
+	var followers []Follower
+	if err := followerStore.Read(&followers); err != nil {
+		t.Fatal(err)
+	}
+	return followers
+}
+
+func TestWebFinger(t *testing.T) {
+	router := useActivityPub(t)
+	host := strings.TrimPrefix(strings.TrimPrefix(appConfig.SiteURL, "http://"), "https://")
+
+	rec := serve(router, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:blog@"+host, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var jrd struct {
+		Subject string
+		Links   []struct{ Rel, Type, Href string }
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &jrd); err != nil {
+		t.Fatal(err)
+	}
+	if jrd.Subject != "acct:blog@"+host {
+		t.Errorf("subject = %q", jrd.Subject)
+	}
+	found := false
+	for _, link := range jrd.Links {
+		found = found || (link.Rel == "self" && link.Type == activityJSONType && link.Href == apActorURL())
+	}
+	if !found {
+		t.Errorf("no self link to %s in %s", apActorURL(), rec.Body)
+	}
+
+	rec = serve(router, httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:someone@"+host, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown account: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestFollowAndUndo(t *testing.T) {
+	router := useActivityPub(t)
+	remote := newFakeFediverse(t)
+	alice := remote.addActor("/users/alice", "", "")
+
+	follow, _ := json.Marshal(gin.H{"id": alice + "#follow-1", "type": "Follow", "actor": alice, "object": apActorURL()})
+	rec := serve(router, inboxRequest(t, remote.key, alice+"#main-key", follow, signedHeaders...))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Follow: status = %d, want 202: %s", rec.Code, rec.Body)
+	}
+	backgroundTasks.Wait()
+
+	followers := storedFollowers(t)
+	if len(followers) != 1 || followers[0].ID != alice || followers[0].Inbox != alice+"/inbox" {
+		t.Fatalf("followers = %+v", followers)
+	}
+	deliveries := remote.deliveries()
+	if len(deliveries) != 1 {
+		t.Fatalf("%d deliveries, want the Accept", len(deliveries))
+	}
+	accept := deliveries[0]
+	if accept.Activity.Type != "Accept" || accept.Activity.Actor != apActorURL() {
+		t.Errorf("delivered %+v, want an Accept from %s", accept.Activity, apActorURL())
+	}
+	var accepted apActivity
+	if json.Unmarshal(accept.Activity.Object, &accepted) != nil || accepted.ID != alice+"#follow-1" {
+		t.Errorf("Accept object = %s, want the Follow", accept.Activity.Object)
+	}
+	if !strings.Contains(accept.Signature, `keyId="`+apActorURL()+`#main-key"`) {
+		t.Errorf("Accept signature = %q", accept.Signature)
+	}
+
+	undo, _ := json.Marshal(gin.H{"type": "Undo", "actor": alice, "object": gin.H{"type": "Follow", "actor": alice, "object": apActorURL()}})
+	rec = serve(router, inboxRequest(t, remote.key, alice+"#main-key", undo, signedHeaders...))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Undo: status = %d, want 202: %s", rec.Code, rec.Body)
+	}
+	if followers := storedFollowers(t); len(followers) != 0 {
+		t.Errorf("followers after Undo = %+v", followers)
+	}
+}
+
+func TestInboxRejectsBadSignatures(t *testing.T) {
+	router := useActivityPub(t)
+	remote := newFakeFediverse(t)
+	alice := remote.addActor("/users/alice", "", "")
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follow, _ := json.Marshal(gin.H{"type": "Follow", "actor": alice, "object": apActorURL()})
+
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"unsigned", inboxRequest(t, nil, "", follow)},
+		{"wrong key", inboxRequest(t, other, alice+"#main-key", follow, signedHeaders...)},
+		{"date not signed", inboxRequest(t, remote.key, alice+"#main-key", follow, "(request-target)", "host", "digest")},
+		{"digest not signed", inboxRequest(t, remote.key, alice+"#main-key", follow, "(request-target)", "host", "date")},
+		{"body changed", func() *http.Request {
+			req := inboxRequest(t, remote.key, alice+"#main-key", follow, signedHeaders...)
+			req.Body = ioutil.NopCloser(strings.NewReader(strings.Replace(string(follow), "Follow", "Undo", 1)))
+			return req
+		}()},
+		{"old date", func() *http.Request {
+			req := inboxRequest(t, remote.key, alice+"#main-key", follow, signedHeaders...)
+			req.Header.Set("Date", time.Now().Add(-24*time.Hour).UTC().Format(http.TimeFormat))
+			return req
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(router, tt.req); rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want 401", rec.Code)
+			}
+		})
+	}
+	if followers := storedFollowers(t); len(followers) != 0 {
+		t.Errorf("followers = %+v, want none", followers)
+	}
+}
+
+func TestInboxRejectsForgedActors(t *testing.T) {
+	router := useActivityPub(t)
+	home := newFakeFediverse(t)
+	victim := home.addActor("/users/victim", "", "")
+	if err := updateFollowers(func([]Follower) []Follower {
+		return []Follower{{ID: victim, Inbox: victim + "/inbox", Followed: time.Now()}}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another server claims the victim's id for a document holding its own key
+	evil := newFakeFediverse(t)
+	forged := evil.addActor("/users/victim", victim, "")
+	// The victim's server hosts a key whose owner is someone else
+	owned := home.addActor("/users/mallory", "", victim)
+
+	undo, _ := json.Marshal(gin.H{"type": "Undo", "actor": victim, "object": gin.H{"type": "Follow", "actor": victim, "object": apActorURL()}})
+	tests := []struct {
+		name string
+		key  *rsa.PrivateKey
+		id   string
+	}{
+		{"key on another server", evil.key, forged + "#main-key"},
+		{"key owned by another actor", home.key, owned + "#main-key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(router, inboxRequest(t, tt.key, tt.id, undo, signedHeaders...)); rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want 401", rec.Code)
+			}
+		})
+	}
+	if followers := storedFollowers(t); len(followers) != 1 || followers[0].ID != victim {
+		t.Errorf("followers = %+v, want the victim to stay", followers)
+	}
+}
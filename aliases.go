@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// siteAlias is where an old URL of a post or page redirects to
+type siteAlias struct {
+	Path  string // current path of the post or page
+	Input string // its buildInputs key, e.g. "post:en:first-post"
+}
+
+// normalizeAlias reduces an alias or request path to the form aliases are
+// matched in: a path with a leading and without a trailing slash. Full URLs
+// of the old site are reduced to their path.
+func normalizeAlias(alias string) string {
+	if u, err := url.Parse(alias); err == nil && u.Path != "" {
+		alias = u.Path
+	}
+	return "/" + strings.Trim(alias, "/")
+}
+
+// siteAliases returns the old URLs of every published post and page, as set
+// with the Aliases front matter key
+func siteAliases() map[string]siteAlias {
+	aliases := map[string]siteAlias{}
+	for _, language := range appConfig.Languages {
+		lang := language.Code
+		for _, section := range []struct{ folder, route, kind string }{{"posts", "/posts/", "post"}, {"static", "/page/", "page"}} {
+			for _, slug := range liveSlugs(section.folder, lang) {
+				doc, err := loadMarkdownFile(section.folder, langFileSlug(slug, lang))
+				if err != nil {
+					continue
+				}
+				for _, alias := range doc.Aliases {
+					aliases[normalizeAlias(alias)] = siteAlias{
+						Path:  langPrefix(lang) + section.route + slug,
+						Input: section.kind + ":" + lang + ":" + slug,
+					}
+				}
+			}
+		}
+	}
+	return aliases
+}
+
+// sortedAliases returns the alias paths in a stable order
+func sortedAliases(aliases map[string]siteAlias) []string {
+	var paths []string
+	for alias := range aliases {
+		paths = append(paths, alias)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// redirectAlias redirects a request for an old URL to the post or page that
+// moved from it, and reports whether it did
+func redirectAlias(c *gin.Context) bool {
+	alias, ok := siteAliases()[normalizeAlias(c.Request.URL.Path)]
+	if !ok || alias.Path == c.Request.URL.Path {
+		return false
+	}
+	c.Redirect(http.StatusMovedPermanently, alias.Path)
+	return true
+}
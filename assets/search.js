@@ -0,0 +1,353 @@
+// Client-side search over /search-index.json, for static exports and hosts
+// without the server-side /search. Tokenizing, stemming and ranking follow
+// search.go, so both return results in the same order.
+(function () {
+  const TITLE_WEIGHT = 10;
+  const TAG_WEIGHT = 5;
+  const PREFIX_SCALE = 0.5;
+
+  const NORWEGIAN_SUFFIXES = [
+    "hetene", "hetens", "heten", "heter", "endes", "ande", "ende", "edes", "enes",
+    "erte", "ene", "ane", "het", "ert", "ers", "ets", "en", "ar", "er", "et", "as", "es", "e", "a", "s",
+  ];
+
+  // Split text into lowercase words of letters and digits, with their offsets
+  function tokenize(text) {
+    const tokens = [];
+    for (const match of (text || "").matchAll(/[\p{L}\p{Nd}]+/gu)) {
+      tokens.push({
+        word: match[0].toLowerCase(),
+        start: match.index,
+        end: match.index + match[0].length,
+      });
+    }
+    return tokens;
+  }
+
+  function stemEnglish(word) {
+    if (word.endsWith("sses")) {
+      word = word.slice(0, -2);
+    } else if (word.endsWith("ies") && word.length > 4) {
+      word = word.slice(0, -3) + "y";
+    } else if (word.endsWith("s") && !word.endsWith("ss") && !word.endsWith("us") && !word.endsWith("is")) {
+      word = word.slice(0, -1);
+    }
+
+    for (const suffix of ["ingly", "edly", "ing", "ed", "ly"]) {
+      if (!word.endsWith(suffix)) {
+        continue;
+      }
+      let base = word.slice(0, -suffix.length);
+      if (base.length < 3 || !/[aeiouy]/.test(base)) {
+        continue;
+      }
+      // running -> run, stopped -> stop
+      const n = base.length;
+      if (n >= 4 && base[n - 1] === base[n - 2] && !"lsz".includes(base[n - 1])) {
+        base = base.slice(0, -1);
+      }
+      return base;
+    }
+    return word;
+  }
+
+  // Reduce a lowercase word to its stem (English and Norwegian)
+  function stem(lang, word) {
+    const length = Array.from(word).length;
+    if (length <= 3) {
+      return word;
+    }
+    if (lang.startsWith("en")) {
+      return stemEnglish(word);
+    }
+    if (lang === "nb" || lang === "nn" || lang === "no") {
+      for (const suffix of NORWEGIAN_SUFFIXES) {
+        if (word.endsWith(suffix) && length - Array.from(suffix).length >= 3) {
+          return word.slice(0, -suffix.length);
+        }
+      }
+    }
+    return word;
+  }
+
+  // Split a query into words, "quoted phrases", word* prefixes and tag:name filters
+  function parseQuery(lang, q) {
+    const query = { terms: [], tags: [] };
+    const parts = q.match(/"[^"]*"?|\S+/g) || [];
+    for (const part of parts) {
+      const phrase = part.startsWith('"');
+      if (!phrase && part.startsWith("tag:")) {
+        if (part.length > 4) {
+          query.tags.push(part.slice(4));
+        }
+        continue;
+      }
+      const tokens = tokenize(part);
+      if (tokens.length === 0) {
+        continue;
+      }
+      if (!phrase && tokens.length === 1 && part.endsWith("*")) {
+        query.terms.push({ stems: [tokens[0].word], prefix: true });
+        continue;
+      }
+      query.terms.push({ stems: tokens.map((t) => stem(lang, t.word)), prefix: false });
+    }
+    return query;
+  }
+
+  // Build per-document postings and document frequencies from the index
+  function prepare(index) {
+    const lang = index.lang || "en";
+    const df = new Map();
+    const docs = (index.docs || []).map((doc) => {
+      const postings = new Map();
+      const posting = (term) => {
+        if (!postings.has(term)) {
+          postings.set(term, { title: [], body: [], tag: false });
+        }
+        return postings.get(term);
+      };
+      tokenize(doc.t).forEach((t, i) => posting(stem(lang, t.word)).title.push(i));
+      (doc.b ? doc.b.split(" ") : []).forEach((term, i) => posting(term).body.push(i));
+      (doc.g || []).forEach((tag) => tokenize(tag).forEach((t) => (posting(stem(lang, t.word)).tag = true)));
+      postings.forEach((_, term) => df.set(term, (df.get(term) || 0) + 1));
+      return { doc, postings };
+    });
+    return { lang, docs, df };
+  }
+
+  function termScore(p, n, df) {
+    const idf = Math.log(1 + n / df);
+    let score = 0;
+    if (p.title.length > 0) {
+      score += TITLE_WEIGHT * idf;
+    }
+    if (p.tag) {
+      score += TAG_WEIGHT * idf;
+    }
+    if (p.body.length > 0) {
+      score += (1 + Math.log(p.body.length)) * idf;
+    }
+    return score;
+  }
+
+  function phraseCount(starts, rest, field) {
+    return starts.filter((start) => rest.every((p, i) => p[field].includes(start + i + 1))).length;
+  }
+
+  // Score of a term in one document, or undefined when it does not match
+  function matchTerm(prepared, entry, term) {
+    const n = prepared.docs.length;
+    if (term.prefix) {
+      let best;
+      entry.postings.forEach((p, indexed) => {
+        if (!indexed.startsWith(term.stems[0])) {
+          return;
+        }
+        let score = termScore(p, n, prepared.df.get(indexed));
+        if (indexed !== term.stems[0]) {
+          score *= PREFIX_SCALE;
+        }
+        best = best === undefined ? score : Math.max(best, score);
+      });
+      return best;
+    }
+
+    const first = entry.postings.get(term.stems[0]);
+    if (!first) {
+      return undefined;
+    }
+    const idf = Math.log(1 + n / prepared.df.get(term.stems[0]));
+    if (term.stems.length === 1) {
+      return termScore(first, n, prepared.df.get(term.stems[0]));
+    }
+
+    // Phrases: every word must follow the previous one
+    const rest = term.stems.slice(1).map((s) => entry.postings.get(s));
+    if (rest.some((p) => !p)) {
+      return undefined;
+    }
+    const inTitle = phraseCount(first.title, rest, "title");
+    const inBody = phraseCount(first.body, rest, "body");
+    if (inTitle + inBody === 0) {
+      return undefined;
+    }
+    let score = 0;
+    if (inTitle > 0) {
+      score += 2 * TITLE_WEIGHT * idf;
+    }
+    if (inBody > 0) {
+      score += 2 * (1 + Math.log(inBody)) * idf;
+    }
+    return score;
+  }
+
+  // Return the documents matching every term and tag, best matches first
+  function search(prepared, q, extraTag) {
+    const query = parseQuery(prepared.lang, q);
+    if (extraTag) {
+      query.tags.push(extraTag);
+    }
+    if (query.terms.length === 0 && query.tags.length === 0) {
+      return { query, results: [] };
+    }
+
+    const results = [];
+    for (const entry of prepared.docs) {
+      const tags = (entry.doc.g || []).map((t) => t.toLowerCase());
+      if (!query.tags.every((t) => tags.includes(t.toLowerCase()))) {
+        continue;
+      }
+      let score = 0;
+      let matched = true;
+      for (const term of query.terms) {
+        const s = matchTerm(prepared, entry, term);
+        if (s === undefined) {
+          matched = false;
+          break;
+        }
+        score += s;
+      }
+      if (matched) {
+        results.push({ doc: entry.doc, score });
+      }
+    }
+    results.sort((a, b) => {
+      if (a.score !== b.score) {
+        return b.score - a.score;
+      }
+      const da = a.doc.d || "";
+      const db = b.doc.d || "";
+      if (da !== db) {
+        return da < db ? 1 : -1;
+      }
+      return (a.doc.t || "") < (b.doc.t || "") ? -1 : 1;
+    });
+    return { query, results };
+  }
+
+  // Append text to an element, wrapping the words that match the query in <mark>
+  function appendHighlighted(el, lang, text, query) {
+    const stems = new Set();
+    const prefixes = [];
+    query.terms.forEach((term) => {
+      if (term.prefix) {
+        prefixes.push(term.stems[0]);
+      } else {
+        term.stems.forEach((s) => stems.add(s));
+      }
+    });
+    let pos = 0;
+    for (const t of tokenize(text)) {
+      const s = stem(lang, t.word);
+      if (!stems.has(s) && !prefixes.some((p) => s.startsWith(p) || t.word.startsWith(p))) {
+        continue;
+      }
+      el.appendChild(document.createTextNode(text.slice(pos, t.start)));
+      const mark = document.createElement("mark");
+      mark.textContent = text.slice(t.start, t.end);
+      el.appendChild(mark);
+      pos = t.end;
+    }
+    el.appendChild(document.createTextNode(text.slice(pos)));
+  }
+
+  function render(container, prepared, found) {
+    const { query, results } = found;
+    container.textContent = "";
+    if (results.length === 0) {
+      const empty = document.createElement("p");
+      empty.className = "no-posts";
+      empty.textContent = container.dataset.noResults;
+      container.appendChild(empty);
+      return;
+    }
+
+    const count = document.createElement("p");
+    count.className = "search-count";
+    count.textContent =
+      results.length === 1 ? container.dataset.countOne : container.dataset.countMany.replace("%d", results.length);
+    container.appendChild(count);
+
+    const list = document.createElement("div");
+    list.className = "posts-list";
+    for (const { doc } of results) {
+      const article = document.createElement("article");
+      article.className = "post-preview search-result";
+
+      const heading = document.createElement("h2");
+      const link = document.createElement("a");
+      link.href = doc.u || "#";
+      link.textContent = doc.t || doc.u;
+      heading.appendChild(link);
+      article.appendChild(heading);
+
+      if (doc.d) {
+        const date = document.createElement("p");
+        date.className = "post-date";
+        date.textContent = "📅 " + doc.d;
+        article.appendChild(date);
+      }
+      if (doc.s) {
+        const summary = document.createElement("p");
+        summary.className = "post-excerpt";
+        appendHighlighted(summary, prepared.lang, doc.s, query);
+        article.appendChild(summary);
+      }
+      if (doc.g && doc.g.length > 0) {
+        const tags = document.createElement("div");
+        tags.className = "tags-list";
+        for (const tag of doc.g) {
+          const a = document.createElement("a");
+          a.className = "tag";
+          a.href = container.dataset.langPrefix + "/tags/" + encodeURIComponent(tag);
+          a.textContent = tag;
+          tags.appendChild(a);
+        }
+        article.appendChild(tags);
+      }
+      list.appendChild(article);
+    }
+    container.appendChild(list);
+  }
+
+  let loaded;
+  // Fetch and prepare an index once
+  function load(url) {
+    if (!loaded) {
+      loaded = fetch(url)
+        .then((response) => {
+          if (!response.ok) {
+            throw new Error("search index: " + response.status);
+          }
+          return response.json();
+        })
+        .then(prepare);
+    }
+    return loaded;
+  }
+
+  window.podiumSearch = { tokenize, stem, parseQuery, prepare, search, load };
+
+  // On the search page, answer the query in the browser when the server did
+  // not (e.g. in a static export)
+  document.addEventListener("DOMContentLoaded", function () {
+    const container = document.querySelector("[data-search-results]");
+    if (!container || container.hasAttribute("data-searched")) {
+      return;
+    }
+    const params = new URLSearchParams(window.location.search);
+    const q = params.get("q") || "";
+    const tag = params.get("tag") || "";
+    if (!q.trim() && !tag) {
+      return;
+    }
+    const input = document.querySelector('.search-form input[name="q"]');
+    if (input) {
+      input.value = q;
+    }
+    load(container.dataset.index)
+      .then((prepared) => render(container, prepared, search(prepared, q, tag)))
+      .catch((err) => console.error(err));
+  });
+})();
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupManifestName is the manifest inside an export archive, listing the
+// checksum of every other file
+const backupManifestName = "podium-manifest.json"
+
+// backupFormat is the version of the archive layout, checked by restore
+const backupFormat = 1
+
+// backupManifest describes an export archive
+type backupManifest struct {
+	Format  int          `json:"format"`
+	Created time.Time    `json:"created"`
+	SiteURL string       `json:"site_url"`
+	Files   []backupFile `json:"files"`
+}
+
+// backupFile is a file in an export archive
+type backupFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// backupSource is a file or folder of the site that goes into an export.
+// Folders are stored under their archive name, so a data folder outside the
+// site is restored inside it.
+type backupSource struct {
+	Path string // on disk
+	Name string // in the archive
+}
+
+// backupSources lists everything a site needs to run: content, assets,
+// templates, config and the runtime state in the data folder. Generated
+// files (cache, public) are left out.
+func backupSources() []backupSource {
+	sources := []backupSource{
+		{"config.yaml", "config.yaml"},
+		{"robots.txt", "robots.txt"},
+		{"humans.txt", "humans.txt"},
+		{"posts", "posts"},
+		{"static", "static"},
+		{"templates", "templates"},
+		{"assets", "assets"},
+		{"archetypes", "archetypes"},
+		{appConfig.I18nFolder, "i18n"},
+		{appConfig.DataFolder, "data"},
+	}
+	for i, source := range sources {
+		// Folders inside the site keep their configured name
+		if name := filepath.ToSlash(filepath.Clean(source.Path)); !filepath.IsAbs(source.Path) && !strings.HasPrefix(name, "../") {
+			sources[i].Name = name
+		}
+	}
+	return sources
+}
+
+// isBackupJunk reports whether a file is left out of an export: temp files of
+// the JSON stores and of exports being written, and files operating systems
+// leave behind
+func isBackupJunk(name string) bool {
+	return strings.HasSuffix(name, ".tmp") || strings.HasPrefix(name, ".podium-export-") ||
+		name == ".DS_Store" || name == "Thumbs.db"
+}
+
+// runExportCommand writes the site to a tar.gz or zip archive
+func runExportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "tar.gz", "Archive format: tar.gz or zip")
+	out := fs.String("out", "", "Archive to write (default podium-<date>.<format>)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: podium export [-format tar.gz|zip] [-out file]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("export takes no arguments")
+	}
+	if *format != "tar.gz" && *format != "zip" {
+		return fmt.Errorf("unknown format %q, use tar.gz or zip", *format)
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("podium-%s.%s", time.Now().Format("2006-01-02-150405"), *format)
+	}
+
+	manifest, err := exportSite(*out, *format)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, f := range manifest.Files {
+		size += f.Size
+	}
+	fmt.Printf("Exported %d files (%.1f MB) to %s\n", len(manifest.Files), float64(size)/(1<<20), *out)
+	return nil
+}
+
+// exportSite writes every backup source to an archive, followed by the
+// manifest. The archive is written to a temp file first, so a failed export
+// never leaves a truncated archive under the final name.
+func exportSite(out, format string) (*backupManifest, error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(out), ".podium-export-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	// The archive holds secrets (SMTP password, keys), so only the owner may read it
+	if err := tmp.Chmod(0600); err != nil {
+		return nil, err
+	}
+
+	var archive archiveWriter
+	if format == "zip" {
+		archive = newZipArchive(tmp)
+	} else {
+		archive = newTarArchive(tmp)
+	}
+
+	manifest := &backupManifest{Format: backupFormat, Created: time.Now().UTC(), SiteURL: appConfig.SiteURL}
+	for _, source := range backupSources() {
+		err := filepath.Walk(source.Path, func(file string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) && file == source.Path {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() || isBackupJunk(info.Name()) {
+				return nil
+			}
+			rel, err := filepath.Rel(source.Path, file)
+			if err != nil {
+				return err
+			}
+			name := path.Join(source.Name, filepath.ToSlash(rel))
+			entry, err := exportFile(archive, file, name, info)
+			if err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			manifest.Files = append(manifest.Files, entry)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := archive.add(backupManifestName, 0644, time.Now(), bytes.NewReader(data), int64(len(data))); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, os.Rename(tmp.Name(), out)
+}
+
+// exportFile adds a file to the archive, hashing exactly what was written, as
+// files in the data folder may change while the server runs
+func exportFile(archive archiveWriter, file, name string, info os.FileInfo) (backupFile, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return backupFile{}, err
+	}
+	if err := archive.add(name, info.Mode().Perm(), info.ModTime(), bytes.NewReader(data), int64(len(data))); err != nil {
+		return backupFile{}, err
+	}
+	sum := sha256.Sum256(data)
+	return backupFile{Path: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+// archiveWriter writes the files of an export
+type archiveWriter interface {
+	add(name string, mode os.FileMode, modTime time.Time, r io.Reader, size int64) error
+	Close() error
+}
+
+// tarArchive writes a gzip-compressed tar archive
+type tarArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarArchive(w io.Writer) *tarArchive {
+	gz := gzip.NewWriter(w)
+	return &tarArchive{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (a *tarArchive) add(name string, mode os.FileMode, modTime time.Time, r io.Reader, size int64) error {
+	header := &tar.Header{Name: name, Mode: int64(mode), ModTime: modTime, Size: size, Typeflag: tar.TypeReg}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(a.tw, r)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// zipArchive writes a zip archive
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func newZipArchive(w io.Writer) *zipArchive {
+	return &zipArchive{zw: zip.NewWriter(w)}
+}
+
+func (a *zipArchive) add(name string, mode os.FileMode, modTime time.Time, r io.Reader, size int64) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+	header.SetMode(mode)
+	w, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+// runRestoreCommand unpacks an export archive into a site folder after
+// verifying it against its manifest
+func runRestoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	force := fs.Bool("force", false, "Restore into a folder that isn't empty, replacing the files in the archive")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: podium restore [-force] <archive> <folder>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("restore needs an archive and the folder to restore the site into")
+	}
+	archive, dir := fs.Arg(0), fs.Arg(1)
+
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 && !*force {
+		return fmt.Errorf("%s is not empty, use -force to restore into it anyway", dir)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Unpack next to the target, so moving the files into place is a rename
+	parent := filepath.Dir(filepath.Clean(dir))
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+	staging, err := ioutil.TempDir(parent, ".podium-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := unpackArchive(archive, staging); err != nil {
+		return fmt.Errorf("%s: %v", archive, err)
+	}
+	manifest, err := verifyBackup(staging)
+	if err != nil {
+		return fmt.Errorf("%s: %v", archive, err)
+	}
+	for _, f := range manifest.Files {
+		target := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(staging, filepath.FromSlash(f.Path)), target); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Restored %d files from %s (exported %s) into %s\n", len(manifest.Files), archive,
+		manifest.Created.Local().Format("2006-01-02 15:04"), dir)
+	if config, err := loadConfig(filepath.Join(dir, "config.yaml")); err == nil && filepath.IsAbs(config.DataFolder) {
+		fmt.Printf("The data folder was restored to %s; data_folder in config.yaml still points to %s\n",
+			filepath.Join(dir, "data"), config.DataFolder)
+	}
+	return nil
+}
+
+// unpackArchive extracts a tar.gz or zip archive, which is recognized by its
+// content, into a folder. Only regular files inside the folder are extracted,
+// with their permissions and modification times.
+func unpackArchive(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(4)
+
+	extract := func(name string, mode os.FileMode, modTime time.Time, content io.Reader) error {
+		clean, ok := safeArchivePath(name)
+		if !ok {
+			return fmt.Errorf("unsafe path %q", name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(clean))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, content); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		// Keep modification times, the sitemap falls back to them for lastmod
+		return os.Chtimes(target, modTime, modTime)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		tr := tar.NewReader(gz)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := extract(header.Name, os.FileMode(header.Mode), header.ModTime, tr); err != nil {
+				return err
+			}
+		}
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return err
+		}
+		for _, zf := range zr.File {
+			if !zf.Mode().IsRegular() {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			err = extract(zf.Name, zf.Mode(), zf.Modified, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.New("not a tar.gz or zip archive")
+}
+
+// safeArchivePath cleans a path from an archive or its manifest, refusing any
+// that would land outside the folder it is unpacked or restored into
+func safeArchivePath(name string) (string, bool) {
+	clean := path.Clean(name)
+	if name == "" || path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(clean, "\\") {
+		return "", false
+	}
+	return clean, true
+}
+
+// verifyBackup checks an unpacked archive against its manifest: every file
+// must be there with its size and checksum, and nothing else may be
+func verifyBackup(dir string) (*backupManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, backupManifestName))
+	if err != nil {
+		return nil, errors.New("no " + backupManifestName + ", not a Podium export")
+	}
+	var manifest backupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %v", backupManifestName, err)
+	}
+	if manifest.Format != backupFormat {
+		return nil, fmt.Errorf("archive format %d is not supported by this version of Podium", manifest.Format)
+	}
+
+	// The manifest paths are used to restore files, so check them all before
+	// reading anything
+	for _, f := range manifest.Files {
+		if clean, ok := safeArchivePath(f.Path); !ok || clean != f.Path {
+			return nil, fmt.Errorf("%s lists an unsafe path %q", backupManifestName, f.Path)
+		}
+	}
+
+	var problems []string
+	listed := map[string]bool{backupManifestName: true}
+	for _, f := range manifest.Files {
+		listed[f.Path] = true
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			problems = append(problems, f.Path+" is missing")
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != f.Size || hex.EncodeToString(sum[:]) != f.SHA256 {
+			problems = append(problems, f.Path+" doesn't match its checksum")
+		}
+	}
+	filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, file)
+			if !listed[filepath.ToSlash(rel)] {
+				problems = append(problems, filepath.ToSlash(rel)+" is not in the manifest")
+			}
+		}
+		return nil
+	})
+	if !listed["config.yaml"] {
+		problems = append(problems, "config.yaml is missing")
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("archive failed verification:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return &manifest, nil
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// siteBuilder renders every route of the site to files, through the same
+// router the server uses, so the files are byte-identical to the responses
+type siteBuilder struct {
+	out       string
+	force     bool // render every target, even when its inputs are unchanged
+	router    *gin.Engine
+	files     int
+	unchanged int
+	removed   int
+	errs      []string
+}
+
+// buildTarget is one URL of the site and the file it is written to
+type buildTarget struct {
+	URL    string
+	File   string
+	Status int      // expected status, 200 unless it is an error page
+	Deps   []string // the buildInputs keys the response is rendered from
+}
+
+// redirectTemplate stands in for a redirect, which static hosts can't send
+var redirectTemplate = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url={{.}}">
+<link rel="canonical" href="{{.}}">
+</head>
+<body><a href="{{.}}">{{.}}</a></body>
+</html>
+`))
+
+// runBuildCommand renders the whole site to static files
+func runBuildCommand(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	out := fs.String("out", "public", "Folder to write the site to")
+	force := fs.Bool("force", false, "Render every file, even when its inputs are unchanged")
+	watch := fs.Bool("watch", false, "Keep running and rebuild when content, templates, assets or config change")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: podium build [-out folder] [-force] [-watch]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("build takes no arguments")
+	}
+
+	if *watch {
+		return watchBuild(*out, *force)
+	}
+
+	started := time.Now()
+	b := &siteBuilder{out: *out, force: *force}
+	if err := b.build(); err != nil {
+		return err
+	}
+	fmt.Printf("%s in %s (%s)\n", b.summary(), b.out, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// summary describes what the last build did
+func (b *siteBuilder) summary() string {
+	return fmt.Sprintf("Built %d files, %d unchanged, %d removed", b.files, b.unchanged, b.removed)
+}
+
+// build checks the content, renders every target whose inputs changed since
+// the last build, removes the files of targets that are gone and reports all
+// problems at once
+func (b *siteBuilder) build() error {
+	b.checkMarkdown()
+
+	router, err := newRouter(b.recordErrors)
+	if err != nil {
+		return fmt.Errorf("templates: %w", err)
+	}
+	b.router = router
+
+	prev := loadBuildManifest(b.out)
+	if b.force {
+		prev.Outputs = map[string]buildOutput{}
+	}
+	inputs := newBuildInputs()
+	manifest := buildManifest{Inputs: map[string]string{}, Outputs: map[string]buildOutput{}}
+	current := map[string]bool{}
+	for _, target := range buildTargets() {
+		current[target.File] = true
+		file := filepath.Join(b.out, filepath.FromSlash(target.File))
+		if prev.upToDate(target, file, inputs) {
+			b.unchanged++
+		} else if !b.render(target, file) {
+			continue
+		}
+		manifest.Outputs[target.File] = buildOutput{URL: target.URL, Deps: target.Deps}
+		for _, dep := range target.Deps {
+			manifest.Inputs[dep] = inputs.hash(dep)
+		}
+	}
+	b.removeOrphans(prev, current)
+
+	// Saved even when the build failed, so the next one only retries what failed
+	if err := manifest.save(b.out); err != nil {
+		b.errs = append(b.errs, err.Error())
+	}
+
+	if len(b.errs) > 0 {
+		for _, msg := range b.errs {
+			fmt.Fprintln(os.Stderr, "error:", msg)
+		}
+		return fmt.Errorf("build failed with %d errors", len(b.errs))
+	}
+	return nil
+}
+
+// checkMarkdown loads every post and page, so unreadable files are reported
+// even when no route renders them
+func (b *siteBuilder) checkMarkdown() {
+	for _, folder := range []string{"posts", "static"} {
+		files, err := ioutil.ReadDir(folder)
+		if err != nil {
+			b.errs = append(b.errs, err.Error())
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), ".md") {
+				continue
+			}
+			if _, err := loadMarkdownFile(folder, strings.TrimSuffix(file.Name(), ".md")); err != nil {
+				b.errs = append(b.errs, fmt.Sprintf("%s: %v", filepath.Join(folder, file.Name()), err))
+			}
+		}
+	}
+}
+
+// recordErrors collects the errors handlers attach to a request, such as
+// template execution errors, which Gin would otherwise only log
+func (b *siteBuilder) recordErrors(c *gin.Context) {
+	c.Next()
+	for _, err := range c.Errors {
+		b.errs = append(b.errs, fmt.Sprintf("GET %s: %v", c.Request.URL.Path, err.Err))
+	}
+}
+
+// render requests one target from the router and writes the response to
+// file, reporting whether it succeeded
+func (b *siteBuilder) render(target buildTarget, file string) bool {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, target.URL, nil)
+	if target.Status == http.StatusInternalServerError {
+		// No route fails on purpose, so the error page is rendered directly
+		c := gin.CreateTestContextOnly(rec, b.router)
+		c.Request = req
+		renderError(c, http.StatusInternalServerError, "internal_error", "internal_error_message")
+	} else {
+		b.router.ServeHTTP(rec, req)
+	}
+
+	body := rec.Body.Bytes()
+	switch {
+	case rec.Code == target.Status:
+	case rec.Code == http.StatusMovedPermanently || rec.Code == http.StatusFound:
+		var page strings.Builder
+		if err := redirectTemplate.Execute(&page, rec.Header().Get("Location")); err != nil {
+			b.errs = append(b.errs, fmt.Sprintf("GET %s: %v", target.URL, err))
+			return false
+		}
+		body = []byte(page.String())
+	default:
+		b.errs = append(b.errs, fmt.Sprintf("GET %s: status %d", target.URL, rec.Code))
+		return false
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		b.errs = append(b.errs, err.Error())
+		return false
+	}
+	if err := ioutil.WriteFile(file, body, 0644); err != nil {
+		b.errs = append(b.errs, err.Error())
+		return false
+	}
+	b.files++
+	return true
+}
+
+// pageTarget is an HTML page, written as <path>/index.html so the URL works
+// without an extension on static hosts
+func pageTarget(urlPath string, deps []string) buildTarget {
+	file := urlPath
+	if unescaped, err := url.PathUnescape(urlPath); err == nil {
+		file = unescaped
+	}
+	return buildTarget{URL: urlPath, File: path.Join(file, "index.html"), Status: http.StatusOK, Deps: deps}
+}
+
+// fileTarget is a route that already ends in a file name (feed.xml, og.png, ...)
+func fileTarget(urlPath string, deps []string) buildTarget {
+	file := urlPath
+	if unescaped, err := url.PathUnescape(urlPath); err == nil {
+		file = unescaped
+	}
+	return buildTarget{URL: urlPath, File: file, Status: http.StatusOK, Deps: deps}
+}
+
+// paginatedTargets returns a list page and its /page/N pages
+func paginatedTargets(urlPath string, items int, deps []string) []buildTarget {
+	targets := []buildTarget{pageTarget(urlPath, deps)}
+	pages := (items + appConfig.PostsPerPage - 1) / appConfig.PostsPerPage
+	for page := 2; page <= pages; page++ {
+		targets = append(targets, pageTarget(urlPath+"/page/"+strconv.Itoa(page), deps))
+	}
+	return targets
+}
+
+// buildDeps returns the inputs of a target: the podium binary, which renders
+// every target, and the given inputs
+func buildDeps(deps ...string) []string {
+	return append([]string{"binary"}, deps...)
+}
+
+// htmlDeps returns the inputs of an HTML page of a language rendered from
+// a page template, plus the given inputs
+func htmlDeps(lang, tmpl string, deps ...string) []string {
+	return buildDeps(append([]string{"config:html", "year", "i18n", "templates:shared", "file:templates/" + tmpl, "nav:" + lang}, deps...)...)
+}
+
+// contentDeps returns the content inputs of every language, for the files
+// that list URLs of all languages or link translations
+func contentDeps() []string {
+	var deps []string
+	for _, language := range appConfig.Languages {
+		deps = append(deps, "content:"+language.Code)
+	}
+	return deps
+}
+
+// feedDeps returns the inputs of a feed: its post list and the posts it
+// includes (the newest feed_items of them)
+func feedDeps(lang, list string, posts []PageLink) []string {
+	deps := buildDeps("config:feed", list)
+	for i, post := range posts {
+		if i == appConfig.FeedItems {
+			break
+		}
+		deps = append(deps, "post:"+lang+":"+post.Slug)
+	}
+	return deps
+}
+
+// liveSlugs returns the slugs of a language's posts or pages that are
+// served: everything but drafts and posts scheduled for later, including
+// unlisted ones
+func liveSlugs(folder, lang string) []string {
+	files, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return nil
+	}
+	var slugs []string
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".md") {
+			continue
+		}
+		slug, fileLang := splitLangSlug(strings.TrimSuffix(file.Name(), ".md"))
+		if fileLang != lang {
+			continue
+		}
+		doc, err := loadMarkdownFile(folder, langFileSlug(slug, lang))
+		if err != nil || !isPostLive(doc) {
+			continue
+		}
+		slugs = append(slugs, slug)
+	}
+	return slugs
+}
+
+// buildTargets lists every URL a static copy of the site needs
+func buildTargets() []buildTarget {
+	var targets []buildTarget
+	for _, language := range appConfig.Languages {
+		targets = append(targets, languageTargets(language.Code)...)
+	}
+
+	robotsDeps := append(buildDeps("file:robots.txt", "config:robots"), contentDeps()...)
+	targets = append(targets, fileTarget("/robots.txt", robotsDeps))
+	if _, err := os.Stat("humans.txt"); err == nil {
+		targets = append(targets, fileTarget("/humans.txt", buildDeps("file:humans.txt")))
+	}
+	filepath.Walk("assets", func(file string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			file = filepath.ToSlash(file)
+			targets = append(targets, fileTarget("/"+file, buildDeps("file:"+file)))
+		}
+		return nil
+	})
+
+	// Old URLs become redirect pages, unless they are taken by a page of the site
+	files := map[string]bool{}
+	for _, target := range targets {
+		files[target.File] = true
+	}
+	aliases := siteAliases()
+	for _, alias := range sortedAliases(aliases) {
+		escaped := (&url.URL{Path: alias}).EscapedPath()
+		target := pageTarget(escaped, buildDeps(aliases[alias].Input))
+		if path.Ext(alias) != "" {
+			target = fileTarget(escaped, target.Deps)
+		}
+		if !files[target.File] {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// tagFolderSafe reports whether a tag can name the folder its pages are
+// written to. A slash makes nested folders (CI/CD becomes tags/CI/CD/), which
+// static hosts serve for /tags/CI%2FCD, but empty, . and .. parts would land
+// the files somewhere else.
+func tagFolderSafe(tag string) bool {
+	for _, part := range strings.Split(tag, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// languageTargets lists the URLs of one language
+func languageTargets(lang string) []buildTarget {
+	prefix := langPrefix(lang)
+	posts := getBlogPostsForLang(lang)
+	list := "list:" + lang
+
+	targets := []buildTarget{pageTarget(prefix+"/", htmlDeps(lang, "index.html"))}
+	targets = append(targets, paginatedTargets(prefix+"/posts", len(posts), htmlDeps(lang, "posts.html", list))...)
+
+	for _, slug := range liveSlugs("posts", lang) {
+		post := "post:" + lang + ":" + slug
+		targets = append(targets, pageTarget(prefix+"/posts/"+slug, htmlDeps(lang, "post.html", post, "data:comments.json", "data:webmentions.json")))
+		if doc, err := loadMarkdownFile("posts", langFileSlug(slug, lang)); err == nil && doc.Image == "" {
+			targets = append(targets, fileTarget(prefix+"/posts/"+slug+"/og.png", buildDeps("config:og", post)))
+		}
+	}
+	for _, slug := range liveSlugs("static", lang) {
+		targets = append(targets, pageTarget(prefix+"/page/"+slug, htmlDeps(lang, "page.html", "page:"+lang+":"+slug)))
+	}
+
+	// Tag pages are linked with the spelling of each post, and author feeds
+	// by the slug of the author's name
+	tagCounts := map[string]int{}
+	authorPosts := map[string][]PageLink{}
+	for _, post := range posts {
+		for _, tag := range post.Tags {
+			tagCounts[tag]++
+		}
+		author := post.Author
+		if author == "" {
+			author = appConfig.SiteAuthor
+		}
+		if author != "" {
+			authorPosts[slugify(author)] = append(authorPosts[slugify(author)], post)
+		}
+	}
+	var tags []string
+	for tag := range tagCounts {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		if !tagFolderSafe(tag) {
+			fmt.Fprintf(os.Stderr, "warning: tag %q can't be written as a folder, its pages are left out\n", tag)
+			continue
+		}
+		tagPath := prefix + "/tags/" + url.PathEscape(tag)
+		tagKey := "tag:" + lang + ":" + strings.ToLower(tag)
+		var tagged []PageLink
+		for _, post := range posts {
+			for _, postTag := range post.Tags {
+				if strings.EqualFold(postTag, tag) {
+					tagged = append(tagged, post)
+					break
+				}
+			}
+		}
+		targets = append(targets, paginatedTargets(tagPath, len(tagged), htmlDeps(lang, "posts.html", tagKey))...)
+		for _, format := range feedFormats {
+			targets = append(targets, fileTarget(tagPath+"/"+format.File, feedDeps(lang, tagKey, tagged)))
+		}
+	}
+	var authorSlugs []string
+	for slug := range authorPosts {
+		authorSlugs = append(authorSlugs, slug)
+	}
+	sort.Strings(authorSlugs)
+	for _, slug := range authorSlugs {
+		for _, format := range feedFormats {
+			targets = append(targets, fileTarget(prefix+"/authors/"+slug+"/"+format.File, feedDeps(lang, "author:"+lang+":"+slug, authorPosts[slug])))
+		}
+	}
+
+	for _, format := range feedFormats {
+		targets = append(targets, fileTarget(prefix+"/"+format.File, feedDeps(lang, list, posts)))
+	}
+	sitemapDeps := append(buildDeps("config:sitemap", list), contentDeps()...)
+	targets = append(targets, fileTarget(prefix+"/sitemap.xml", sitemapDeps))
+	if parts := sitemapParts(sitemapURLs(lang)); len(parts) > 1 {
+		for i := range parts {
+			targets = append(targets, fileTarget(prefix+"/sitemap-"+strconv.Itoa(i+1)+".xml", sitemapDeps))
+		}
+	}
+	notFound := buildTarget{URL: prefix + "/404", File: prefix + "/404.html", Status: http.StatusNotFound, Deps: htmlDeps(lang, "error.html")}
+	serverError := buildTarget{URL: prefix + "/500", File: prefix + "/500.html", Status: http.StatusInternalServerError, Deps: htmlDeps(lang, "error.html")}
+	targets = append(targets,
+		pageTarget(prefix+"/search", htmlDeps(lang, "search.html")),
+		fileTarget(prefix+"/search-index.json", buildDeps("config:search", list, "content:"+lang)),
+		notFound,
+		serverError,
+	)
+	return targets
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/html"
+)
+
+// diagnostic is one problem `podium check` found in a content file
+type diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Rule    string `json:"rule"` // e.g. "unknown-key", "dangling-link"
+	Message string `json:"message"`
+}
+
+// frontMatterNames are the spellings of the front matter keys used in the
+// docs, by normalized key
+var frontMatterNames = map[string]string{
+	"tags":        "Tags",
+	"date":        "Date",
+	"publishdate": "PublishDate",
+	"updated":     "Updated",
+	"lastmod":     "Lastmod",
+	"featured":    "Featured",
+	"draft":       "Draft",
+	"unlisted":    "Unlisted",
+	"description": "Description",
+	"image":       "Image",
+	"author":      "Author",
+	"comments":    "Comments",
+	"aliases":     "Aliases",
+}
+
+// frontMatterFormats are the formats of the front matter keys that aren't free text
+var frontMatterFormats = map[string]string{
+	"date":        "2006-01-02",
+	"publishdate": "2006-01-02 15:04",
+	"updated":     "2006-01-02 15:04",
+	"lastmod":     "2006-01-02 15:04",
+	"featured":    "bool",
+	"draft":       "bool",
+	"unlisted":    "bool",
+	"comments":    "bool",
+}
+
+// siteChecker checks the content of the site, resolving internal links
+// through the same router the server uses
+type siteChecker struct {
+	router   *gin.Engine
+	resolved map[string]int // status of every path requested so far
+	diags    []diagnostic
+}
+
+// runCheckCommand checks every post and page and exits non-zero when it
+// finds problems, so it can gate a CI pipeline
+func runCheckCommand(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	format := fs.String("format", "text", "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: podium check [-format text|json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("check takes no arguments")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q, use text or json", *format)
+	}
+
+	router, err := newRouter()
+	if err != nil {
+		return fmt.Errorf("templates: %w", err)
+	}
+	c := &siteChecker{router: router, resolved: map[string]int{}}
+	files := c.check()
+
+	if *format == "json" {
+		out, err := json.MarshalIndent(c.diags, "", "  ")
+		if err != nil {
+			return err
+		}
+		if c.diags == nil {
+			out = []byte("[]")
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, d := range c.diags {
+			fmt.Printf("%s:%d: %s [%s]\n", d.File, d.Line, d.Message, d.Rule)
+		}
+	}
+
+	if len(c.diags) > 0 {
+		return fmt.Errorf("%d problems in %d files", len(c.diags), countFiles(c.diags))
+	}
+	if *format == "text" {
+		fmt.Printf("Checked %d files, no problems found\n", files)
+	}
+	return nil
+}
+
+// countFiles counts the files diagnostics were reported for
+func countFiles(diags []diagnostic) int {
+	files := map[string]bool{}
+	for _, d := range diags {
+		files[d.File] = true
+	}
+	return len(files)
+}
+
+// check checks every Markdown file of the posts and static folders and
+// returns how many there were
+func (c *siteChecker) check() int {
+	// Requests for missing pages are expected here, and the handlers log them
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	checked := 0
+	for _, section := range []struct{ folder, route string }{{"posts", "/posts/"}, {"static", "/page/"}} {
+		entries, err := ioutil.ReadDir(section.folder)
+		if err != nil {
+			c.report(section.folder, 0, "read", err.Error())
+			continue
+		}
+		slugs := map[string]string{}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".md") {
+				continue
+			}
+			checked++
+			name := strings.TrimSuffix(entry.Name(), ".md")
+			file := filepath.Join(section.folder, entry.Name())
+
+			// Slugs that only differ in case clash on case-insensitive file systems
+			slug, lang := splitLangSlug(name)
+			key := lang + "/" + strings.ToLower(slug)
+			if other, ok := slugs[key]; ok {
+				c.report(file, 1, "duplicate-slug", fmt.Sprintf("slug %q clashes with %s", slug, other))
+			}
+			slugs[key] = file
+
+			c.checkFile(file, section.folder, langPrefix(lang)+section.route+slug)
+		}
+	}
+
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		if c.diags[i].File != c.diags[j].File {
+			return c.diags[i].File < c.diags[j].File
+		}
+		return c.diags[i].Line < c.diags[j].Line
+	})
+	return checked
+}
+
+func (c *siteChecker) report(file string, line int, rule, message string) {
+	c.diags = append(c.diags, diagnostic{File: file, Line: line, Rule: rule, Message: message})
+}
+
+// checkFile checks the front matter, title, links and images of one file
+// served at pagePath
+func (c *siteChecker) checkFile(file, folder, pagePath string) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		c.report(file, 0, "read", err.Error())
+		return
+	}
+	lines := strings.Split(string(content), "\n")
+
+	// Front matter is read up to the title, within the first lines, as
+	// loadMarkdownFile does. Unknown keys are only looked for in the block at
+	// the top of the file, so a sentence like "Note: ..." isn't taken for one.
+	titleLine := 0
+	inBlock := true
+	seen := map[string]int{}
+	var imageLine int
+	var image string
+	for i, line := range lines {
+		if strings.HasPrefix(line, "# ") || line == "#" {
+			titleLine = i + 1
+			if strings.TrimSpace(strings.TrimPrefix(line, "#")) == "" {
+				c.report(file, i+1, "title", "the title is empty")
+			}
+			break
+		}
+		if i > 20 {
+			break
+		}
+		if strings.TrimSpace(line) == "" {
+			inBlock = false
+			continue
+		}
+		key, value, ok := parseFrontMatterLine(line)
+		if !ok {
+			inBlock = false
+			continue
+		}
+		if !frontMatterKeys[key] {
+			if inBlock {
+				message := fmt.Sprintf("unknown front matter key %q", line[:strings.Index(line, ":")])
+				if suggestion := suggestFrontMatterKey(key); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				c.report(file, i+1, "unknown-key", message)
+			}
+			continue
+		}
+		if first, ok := seen[key]; ok {
+			c.report(file, i+1, "front-matter", fmt.Sprintf("%s is already set on line %d", frontMatterNames[key], first))
+		}
+		seen[key] = i + 1
+		if message := checkFrontMatterValue(key, value); message != "" {
+			rule := "front-matter"
+			if frontMatterFormats[key] != "bool" {
+				rule = "date"
+			}
+			c.report(file, i+1, rule, message)
+		}
+		if key == "image" {
+			image, imageLine = value, i+1
+		}
+	}
+	if titleLine == 0 {
+		c.report(file, 1, "title", "no title: start the content with a \"# Title\" heading")
+	}
+
+	doc, err := loadMarkdownFile(folder, strings.TrimSuffix(filepath.Base(file), ".md"))
+	if err != nil {
+		c.report(file, 0, "read", err.Error())
+		return
+	}
+	if image != "" {
+		c.checkLink(file, imageLine, pagePath, image, true)
+	}
+	c.checkHTML(file, lines, titleLine, pagePath, doc.HTML)
+}
+
+// checkFrontMatterValue returns what is wrong with a front matter value, if anything
+func checkFrontMatterValue(key, value string) string {
+	format, ok := frontMatterFormats[key]
+	if !ok || value == "" {
+		return ""
+	}
+	name := frontMatterNames[key]
+	if format == "bool" {
+		if v := strings.ToLower(value); v != "true" && v != "false" {
+			return fmt.Sprintf("%s must be true or false, not %q", name, value)
+		}
+		return ""
+	}
+	if _, err := time.Parse(format, value); err == nil {
+		return ""
+	}
+	// Updated and Lastmod may also be a plain date
+	if key == "updated" || key == "lastmod" {
+		if _, err := time.Parse("2006-01-02", value); err == nil {
+			return ""
+		}
+		return fmt.Sprintf("%s %q is not a date (YYYY-MM-DD or YYYY-MM-DD HH:MM)", name, value)
+	}
+	if key == "publishdate" {
+		return fmt.Sprintf("PublishDate %q is not a date and time (YYYY-MM-DD HH:MM), the post would be published right away", value)
+	}
+	return fmt.Sprintf("%s %q is not a date (YYYY-MM-DD)", name, value)
+}
+
+// suggestFrontMatterKey returns the known key closest to a misspelled one
+func suggestFrontMatterKey(key string) string {
+	best, bestDistance := "", 3
+	for known, name := range frontMatterNames {
+		if d := editDistance(key, known); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// checkHTML checks the links and images of a rendered file. Diagnostics are
+// reported on the source line that mentions the URL, looking from the line of
+// the previous link on, since the HTML follows the order of the source.
+func (c *siteChecker) checkHTML(file string, lines []string, titleLine int, pagePath, content string) {
+	from := titleLine
+	lineOf := func(target string) int {
+		for _, start := range []int{from, titleLine} {
+			for i := start; i < len(lines); i++ {
+				if strings.Contains(lines[i], target) {
+					from = i
+					return i + 1
+				}
+			}
+		}
+		return max(titleLine, 1)
+	}
+
+	z := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		token := z.Token()
+		attrs := map[string]string{}
+		hasAlt := false
+		for _, attr := range token.Attr {
+			attrs[attr.Key] = attr.Val
+			hasAlt = hasAlt || attr.Key == "alt"
+		}
+		switch token.Data {
+		case "a":
+			if href, ok := attrs["href"]; ok {
+				c.checkLink(file, lineOf(href), pagePath, href, false)
+			}
+		case "img":
+			src := attrs["src"]
+			if !hasAlt || strings.TrimSpace(attrs["alt"]) == "" {
+				c.report(file, lineOf(src), "alt-text", fmt.Sprintf("image %s has no alt text", src))
+			}
+			if src != "" {
+				c.checkLink(file, lineOf(src), pagePath, src, true)
+			}
+		}
+	}
+}
+
+// checkLink reports a link or image on the site that doesn't resolve. External
+// links aren't followed.
+func (c *siteChecker) checkLink(file string, line int, pagePath, target string, isImage bool) {
+	target = strings.TrimSpace(target)
+	if target == "" || strings.HasPrefix(target, "#") {
+		return
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		c.report(file, line, "dangling-link", fmt.Sprintf("malformed URL %q", target))
+		return
+	}
+	if u.Scheme != "" || u.Host != "" {
+		site, err := url.Parse(appConfig.SiteURL)
+		if err != nil || u.Scheme != site.Scheme && u.Scheme != "" || u.Host != site.Host {
+			return
+		}
+	}
+	u = (&url.URL{Path: pagePath}).ResolveReference(u)
+	if u.Path == "" {
+		return
+	}
+
+	status, ok := c.resolved[u.Path]
+	if !ok {
+		req, err := http.NewRequest(http.MethodGet, (&url.URL{Path: u.Path}).String(), nil)
+		if err != nil {
+			c.report(file, line, "dangling-link", fmt.Sprintf("malformed URL %q", target))
+			return
+		}
+		rec := httptest.NewRecorder()
+		c.router.ServeHTTP(rec, req)
+		status = rec.Code
+		c.resolved[u.Path] = status
+	}
+	if status < http.StatusBadRequest {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(u.Path, "/assets/"):
+		c.report(file, line, "missing-asset", fmt.Sprintf("%s does not exist", u.Path))
+	case isImage:
+		c.report(file, line, "dangling-link", fmt.Sprintf("image %s returns %d", u.Path, status))
+	default:
+		c.report(file, line, "dangling-link", fmt.Sprintf("link to %s returns %d", u.Path, status))
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CommentsConfig controls the built-in comment system
+type CommentsConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	Moderation bool `yaml:"moderation"` // hold new comments until approved with "podium comments approve"
+	MaxLinks   int  `yaml:"max_links"`
+	MaxLength  int  `yaml:"max_length"`
+	RateLimit  int  `yaml:"rate_limit"` // comments per IP per 10 minutes
+}
+
+// Comment is a reader comment on a post, stored in data/comments.json
+type Comment struct {
+	ID       string    `json:"id"`
+	Post     string    `json:"post"`
+	Lang     string    `json:"lang"`
+	ParentID string    `json:"parent_id,omitempty"`
+	Author   string    `json:"author"`
+	Website  string    `json:"website,omitempty"`
+	Body     string    `json:"body"`
+	Created  time.Time `json:"created"`
+	Approved bool      `json:"approved"`
+	IP       string    `json:"ip,omitempty"`
+}
+
+// CommentNode is an approved comment with its rendered body and replies
+type CommentNode struct {
+	Comment
+	HTML    template.HTML
+	Replies []*CommentNode
+}
+
+var (
+	commentStore   = newJSONStore("comments.json")
+	commentLimiter = newRateLimiter(10 * time.Minute)
+)
+
+// commentsEnabled reports whether a post accepts and shows comments
+func commentsEnabled(doc *MarkdownFile) bool {
+	return appConfig.Comments.Enabled && !doc.DisableComments
+}
+
+// postComments returns the approved comments of a post as a thread tree and their count
+func postComments(slug, lang string) ([]*CommentNode, int) {
+	var all []Comment
+	if err := commentStore.Read(&all); err != nil {
+		log.Printf("Warning: Failed to read comments: %v", err)
+		return nil, 0
+	}
+
+	nodes := map[string]*CommentNode{}
+	var ordered []*CommentNode
+	for _, comment := range all {
+		if comment.Post == slug && comment.Lang == lang && comment.Approved {
+			node := &CommentNode{Comment: comment, HTML: renderCommentBody(comment.Body)}
+			nodes[comment.ID] = node
+			ordered = append(ordered, node)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Created.Before(ordered[j].Created)
+	})
+
+	var roots []*CommentNode
+	for _, node := range ordered {
+		// Replies whose parent is gone or still pending are shown at the top level
+		if parent, ok := nodes[node.ParentID]; ok && node.ParentID != "" {
+			parent.Replies = append(parent.Replies, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots, len(ordered)
+}
+
+// commentStatuses are the ?comment= values shown as a notice above the comment form
+var commentStatuses = map[string]bool{
+	"posted":          true,
+	"pending":         true,
+	"rate_limited":    true,
+	"missing":         true,
+	"too_long":        true,
+	"invalid_website": true,
+	"too_many_links":  true,
+}
+
+// commentStatus returns a known comment status from the query string, or ""
+func commentStatus(status string) string {
+	if commentStatuses[status] {
+		return status
+	}
+	return ""
+}
+
+// findComment looks up a comment in a thread tree
+func findComment(nodes []*CommentNode, id string) *CommentNode {
+	for _, node := range nodes {
+		if node.ID == id {
+			return node
+		}
+		if found := findComment(node.Replies, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Comment submission route for a post
+func handleComment(c *gin.Context) {
+	slug := c.Param("slug")
+	lang := requestLang(c)
+	if isLocalizedSlug(slug) {
+		renderError(c, http.StatusNotFound, "post_not_found", "post_not_found_message")
+		return
+	}
+	doc, err := loadMarkdownFile("posts", langFileSlug(slug, lang))
+	if err != nil || !isPostLive(doc) || !commentsEnabled(doc) {
+		renderError(c, http.StatusNotFound, "post_not_found", "post_not_found_message")
+		return
+	}
+
+	postURL := langPrefix(lang) + "/posts/" + slug
+	redirect := func(status, anchor string) {
+		c.Redirect(http.StatusSeeOther, postURL+"?comment="+status+"#"+anchor)
+	}
+
+	if honeypotFilled(c) {
+		log.Printf("Dropped comment on %s: honeypot filled in", slug)
+		redirect("pending", "comments")
+		return
+	}
+	if !commentLimiter.Allow(c.ClientIP(), appConfig.Comments.RateLimit) {
+		log.Printf("Rate limited comment on %s from %s", slug, c.ClientIP())
+		redirect("rate_limited", "comment-form")
+		return
+	}
+
+	comment := Comment{
+		ID:       randomID(8),
+		Post:     slug,
+		Lang:     lang,
+		ParentID: c.PostForm("parent"),
+		Author:   strings.TrimSpace(c.PostForm("author")),
+		Website:  strings.TrimSpace(c.PostForm("website")),
+		Body:     strings.TrimSpace(c.PostForm("body")),
+		Created:  time.Now(),
+		Approved: !appConfig.Comments.Moderation,
+		IP:       c.ClientIP(),
+	}
+	if status := validateComment(&comment); status != "" {
+		redirect(status, "comment-form")
+		return
+	}
+
+	var all []Comment
+	err = commentStore.Update(&all, func() error {
+		// Only reply to approved comments on the same post
+		if comment.ParentID != "" {
+			found := false
+			for _, other := range all {
+				if other.ID == comment.ParentID && other.Post == slug && other.Lang == lang && other.Approved {
+					found = true
+					break
+				}
+			}
+			if !found {
+				comment.ParentID = ""
+			}
+		}
+		all = append(all, comment)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error saving comment on %s: %v", slug, err)
+		renderError(c, http.StatusInternalServerError, "internal_error", "internal_error_message")
+		return
+	}
+
+	if !comment.Approved {
+		log.Printf("New comment %s on %s awaiting moderation", comment.ID, slug)
+		redirect("pending", "comments")
+		return
+	}
+	log.Printf("New comment %s on %s", comment.ID, slug)
+	redirect("posted", "comment-"+comment.ID)
+}
+
+// validateComment checks a submitted comment and returns the status key of the
+// first problem, or "" when the comment is fine
+func validateComment(comment *Comment) string {
+	if comment.Author == "" || comment.Body == "" {
+		return "missing"
+	}
+	if len(comment.Author) > 100 || len(comment.Body) > appConfig.Comments.MaxLength {
+		return "too_long"
+	}
+	if comment.Website != "" {
+		u, err := url.Parse(comment.Website)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "invalid_website"
+		}
+	}
+	if countLinks(comment.Body) > appConfig.Comments.MaxLinks {
+		return "too_many_links"
+	}
+	return ""
+}
+
+var (
+	// Bare URLs stop at placeholders (\x00), ` and *, so a URL right before a
+	// code span or inside **bold** leaves the markup alone
+	commentURLRe    = regexp.MustCompile("https?://[^\\s<\\x00*`]+[^\\s<.,;:!?)'\"\\x00*`]")
+	commentLinkRe   = regexp.MustCompile(`\[([^\]\n]+)\]\((https?://[^\s)]+)\)`)
+	commentCodeRe   = regexp.MustCompile("`([^`\n]+)`")
+	commentBoldRe   = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	commentItalicRe = regexp.MustCompile(`\*([^*\n]+)\*`)
+	commentParaRe   = regexp.MustCompile(`\n\s*\n`)
+)
+
+// countLinks counts the URLs in a comment, including Markdown links
+func countLinks(text string) int {
+	return len(commentURLRe.FindAllString(text, -1))
+}
+
+// renderCommentBody renders the Markdown subset allowed in comments: paragraphs,
+// line breaks, `code`, **bold**, *italic*, [links](https://...) and bare URLs.
+// Everything else is shown as plain text.
+func renderCommentBody(body string) template.HTML {
+	var paragraphs []string
+	for _, para := range commentParaRe.Split(strings.TrimSpace(body), -1) {
+		// Code spans and links are swapped for placeholders so their text isn't formatted
+		var saved []string
+		hold := func(s string) string {
+			saved = append(saved, s)
+			return fmt.Sprintf("\x00%d\x00", len(saved)-1)
+		}
+
+		text := html.EscapeString(strings.TrimSpace(strings.Replace(para, "\x00", "", -1)))
+		text = commentCodeRe.ReplaceAllStringFunc(text, func(m string) string {
+			return hold("<code>" + commentCodeRe.FindStringSubmatch(m)[1] + "</code>")
+		})
+		text = commentLinkRe.ReplaceAllStringFunc(text, func(m string) string {
+			parts := commentLinkRe.FindStringSubmatch(m)
+			return hold(`<a href="` + parts[2] + `" rel="nofollow ugc noopener">` + parts[1] + `</a>`)
+		})
+		text = commentURLRe.ReplaceAllStringFunc(text, func(m string) string {
+			return hold(`<a href="` + m + `" rel="nofollow ugc noopener">` + m + `</a>`)
+		})
+		text = commentBoldRe.ReplaceAllString(text, "<strong>$1</strong>")
+		text = commentItalicRe.ReplaceAllString(text, "<em>$1</em>")
+		text = strings.Replace(text, "\n", "<br />\n", -1)
+		for i, s := range saved {
+			text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), s, 1)
+		}
+		paragraphs = append(paragraphs, "<p>"+text+"</p>")
+	}
+	return template.HTML(strings.Join(paragraphs, "\n"))
+}
+
+// runCommentsCommand lists and moderates comments from the command line
+func runCommentsCommand(args []string) error {
+	fs := flag.NewFlagSet("comments", flag.ExitOnError)
+	all := fs.Bool("all", false, "List approved comments as well as pending ones")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: podium comments list [-all]")
+		fmt.Fprintln(os.Stderr, "       podium comments approve <id>...")
+		fmt.Fprintln(os.Stderr, "       podium comments delete <id>...")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("comments needs an action")
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	var comments []Comment
+	switch action {
+	case "list":
+		if err := commentStore.Read(&comments); err != nil {
+			return err
+		}
+		shown := 0
+		for _, comment := range comments {
+			if comment.Approved && !*all {
+				continue
+			}
+			status := "pending"
+			if comment.Approved {
+				status = "approved"
+			}
+			fmt.Printf("%s  %-8s  %s  %s/%s  %s\n", comment.ID, status,
+				comment.Created.Format("2006-01-02 15:04"), comment.Lang, comment.Post, comment.Author)
+			fmt.Printf("    %s\n", generateExcerpt(strings.Join(strings.Fields(comment.Body), " "), 100))
+			shown++
+		}
+		if shown == 0 {
+			fmt.Println("No comments awaiting moderation")
+		}
+		return nil
+
+	case "approve", "delete":
+		if fs.NArg() == 0 {
+			fs.Usage()
+			return fmt.Errorf("comments %s needs at least one comment id", action)
+		}
+		ids := map[string]bool{}
+		for _, id := range fs.Args() {
+			ids[id] = true
+		}
+		return commentStore.Update(&comments, func() error {
+			matched := 0
+			var kept []Comment
+			for _, comment := range comments {
+				if !ids[comment.ID] {
+					kept = append(kept, comment)
+					continue
+				}
+				matched++
+				if action == "approve" {
+					comment.Approved = true
+					kept = append(kept, comment)
+				}
+			}
+			if matched != len(ids) {
+				return errors.New("unknown comment id")
+			}
+			comments = kept
+			if action == "approve" {
+				fmt.Printf("Approved %d comment(s)\n", matched)
+			} else {
+				fmt.Printf("Deleted %d comment(s)\n", matched)
+			}
+			return nil
+		})
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown comments action: %s", action)
+	}
+}
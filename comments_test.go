@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestRenderCommentBody(t *testing.T) {
+	const rel = ` rel="nofollow ugc noopener"`
+	tests := []struct {
+		name, body, want string
+	}{
+		{"plain text is escaped", `a <b> & "c"`, `<p>a &lt;b&gt; &amp; &#34;c&#34;</p>`},
+		{"paragraphs and line breaks", "one\ntwo\n\nthree", "<p>one<br />\ntwo</p>\n<p>three</p>"},
+		{"bare URL", "see https://a.com/x.", `<p>see <a href="https://a.com/x"` + rel + `>https://a.com/x</a>.</p>`},
+		{"URL before code span", "see https://a.com`x` now", `<p>see <a href="https://a.com"` + rel + `>https://a.com</a><code>x</code> now</p>`},
+		{"URL in bold", "**https://y.com**", `<p><strong><a href="https://y.com"` + rel + `>https://y.com</a></strong></p>`},
+		{"URL in italics", "*https://y.com*", `<p><em><a href="https://y.com"` + rel + `>https://y.com</a></em></p>`},
+		{"markdown link", "[site](https://a.com) **bold**", `<p><a href="https://a.com"` + rel + `>site</a> <strong>bold</strong></p>`},
+		{"code is not formatted", "`**x** https://a.com`", `<p><code>**x** https://a.com</code></p>`},
+		{"NUL bytes are dropped", "a\x000\x00b", `<p>a0b</p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(renderCommentBody(tt.body)); got != tt.want {
+				t.Errorf("renderCommentBody(%q)\n got %s\nwant %s", tt.body, got, tt.want)
+			}
+		})
+	}
+}
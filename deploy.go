@@ -0,0 +1,610 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeployTarget is a place `podium deploy <name>` uploads the built site to
+type DeployTarget struct {
+	Type   string `yaml:"type"`   // "s3", "rsync" or "local"
+	Folder string `yaml:"folder"` // the built site, "public" by default
+
+	// S3-compatible storage (AWS S3, MinIO, Cloudflare R2, ...)
+	Endpoint  string `yaml:"endpoint"` // e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Region    string `yaml:"region"`   // "us-east-1" by default
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`     // key prefix, e.g. "blog/"
+	PathStyle bool   `yaml:"path_style"` // address the bucket in the path instead of the host name, as MinIO expects
+	AccessKey string `yaml:"access_key"` // or AWS_ACCESS_KEY_ID
+	SecretKey string `yaml:"secret_key"` // or AWS_SECRET_ACCESS_KEY
+
+	// rsync over SSH
+	Destination string `yaml:"destination"` // e.g. deploy@example.com:/var/www/blog
+	SSHPort     int    `yaml:"ssh_port"`
+	SSHKey      string `yaml:"ssh_key"`
+
+	// Local directory
+	Path string `yaml:"path"`
+}
+
+// deployFile is a file of the built site
+type deployFile struct {
+	Path string // relative to the site folder, with forward slashes
+	File string // path on disk
+}
+
+// deployUpload is a file a deploy writes to the target
+type deployUpload struct {
+	Path string
+	New  bool // not at the target yet, as opposed to changed
+}
+
+// deployPlan is what a deploy changes at the target
+type deployPlan struct {
+	Uploads   []deployUpload
+	Deletes   []string
+	Unchanged int
+}
+
+// deployer compares the built site with a target and brings the target up to date
+type deployer interface {
+	plan(files []deployFile) (*deployPlan, error)
+	apply(plan *deployPlan, files []deployFile) error
+}
+
+// deployContentTypes are the Content-Type headers of the files the server
+// renders itself; other files get the type http.ServeFile would send
+var deployContentTypes = map[string]string{
+	".html": "text/html; charset=utf-8",
+	".xml":  "application/xml; charset=utf-8",
+	".json": "application/json; charset=utf-8",
+	".txt":  "text/plain; charset=utf-8",
+	".css":  "text/css; charset=utf-8",
+	".js":   "application/javascript; charset=utf-8",
+}
+
+// runDeployCommand uploads the built site to a target from the config
+func runDeployCommand(args []string) error {
+	fs := flag.NewFlagSet("deploy", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Print what would be uploaded and deleted without changing the target")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: podium deploy [-dry-run] <target>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("deploy needs a target")
+	}
+
+	name := fs.Arg(0)
+	target, ok := appConfig.Deploy[name]
+	if !ok && len(appConfig.Deploy) == 0 {
+		return fmt.Errorf("unknown deploy target %q, add it under deploy in config.yaml", name)
+	}
+	if !ok {
+		var names []string
+		for n := range appConfig.Deploy {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown deploy target %q (configured: %s)", name, strings.Join(names, ", "))
+	}
+	if target.Folder == "" {
+		target.Folder = "public"
+	}
+	d, err := newDeployer(target)
+	if err != nil {
+		return fmt.Errorf("deploy target %s: %w", name, err)
+	}
+
+	files, err := deployFiles(target.Folder)
+	if err != nil {
+		return err
+	}
+	plan, err := d.plan(files)
+	if err != nil {
+		return fmt.Errorf("deploy target %s: %w", name, err)
+	}
+
+	for _, upload := range plan.Uploads {
+		action := "update"
+		if upload.New {
+			action = "add"
+		}
+		fmt.Printf("%-7s %s\n", action, upload.Path)
+	}
+	for _, file := range plan.Deletes {
+		fmt.Printf("%-7s %s\n", "delete", file)
+	}
+	summary := fmt.Sprintf("%d to upload, %d to delete, %d unchanged", len(plan.Uploads), len(plan.Deletes), plan.Unchanged)
+	if *dryRun {
+		fmt.Printf("Dry run, %s was not changed: %s\n", name, summary)
+		return nil
+	}
+	if len(plan.Uploads) == 0 && len(plan.Deletes) == 0 {
+		fmt.Printf("%s is up to date\n", name)
+		return nil
+	}
+	if err := d.apply(plan, files); err != nil {
+		return fmt.Errorf("deploy target %s: %w", name, err)
+	}
+	fmt.Printf("Deployed to %s: %s\n", name, summary)
+	return nil
+}
+
+// newDeployer returns the deployer of a target's type
+func newDeployer(target DeployTarget) (deployer, error) {
+	switch target.Type {
+	case "s3":
+		if target.Endpoint == "" || target.Bucket == "" {
+			return nil, errors.New("s3 targets need an endpoint and a bucket")
+		}
+		if target.Region == "" {
+			target.Region = "us-east-1"
+		}
+		if target.AccessKey == "" {
+			target.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		}
+		if target.SecretKey == "" {
+			target.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		}
+		if target.AccessKey == "" || target.SecretKey == "" {
+			return nil, errors.New("s3 targets need access_key and secret_key (or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+		}
+		endpoint, err := url.Parse(strings.TrimSuffix(target.Endpoint, "/"))
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q", target.Endpoint)
+		}
+		return &s3Deployer{target: target, endpoint: endpoint, client: &http.Client{Timeout: 5 * time.Minute}}, nil
+	case "rsync":
+		if target.Destination == "" {
+			return nil, errors.New("rsync targets need a destination")
+		}
+		return &rsyncDeployer{target: target}, nil
+	case "local":
+		if target.Path == "" {
+			return nil, errors.New("local targets need a path")
+		}
+		return &localDeployer{dir: target.Path}, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q (use s3, rsync or local)", target.Type)
+	}
+}
+
+// deployFiles lists the files of a built site, except the build manifest
+func deployFiles(folder string) ([]deployFile, error) {
+	if _, err := os.Stat(folder); err != nil {
+		return nil, fmt.Errorf("%s not found, run podium build first", folder)
+	}
+	var files []deployFile
+	err := filepath.Walk(folder, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(folder, file)
+		if err != nil {
+			return err
+		}
+		if rel == buildManifestName {
+			return nil
+		}
+		files = append(files, deployFile{Path: filepath.ToSlash(rel), File: file})
+		return nil
+	})
+	return files, err
+}
+
+// deployContentType returns the Content-Type the server sends for a file
+func deployContentType(file string) string {
+	for _, format := range feedFormats {
+		if path.Base(file) == format.File {
+			return format.Type + "; charset=utf-8"
+		}
+	}
+	ext := strings.ToLower(path.Ext(file))
+	if contentType, ok := deployContentTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// localDeployer copies the site to a directory
+type localDeployer struct {
+	dir string
+}
+
+func (d *localDeployer) plan(files []deployFile) (*deployPlan, error) {
+	plan := &deployPlan{}
+	local := map[string]bool{}
+	for _, file := range files {
+		local[file.Path] = true
+		existing := filepath.Join(d.dir, filepath.FromSlash(file.Path))
+		if _, err := os.Stat(existing); err != nil {
+			plan.Uploads = append(plan.Uploads, deployUpload{Path: file.Path, New: true})
+		} else if hashFile(existing) != hashFile(file.File) {
+			plan.Uploads = append(plan.Uploads, deployUpload{Path: file.Path})
+		} else {
+			plan.Unchanged++
+		}
+	}
+
+	err := filepath.Walk(d.dir, func(file string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && file == d.dir {
+			return filepath.SkipDir
+		}
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(d.dir, file)
+		if err != nil {
+			return err
+		}
+		if !local[filepath.ToSlash(rel)] {
+			plan.Deletes = append(plan.Deletes, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return plan, err
+}
+
+func (d *localDeployer) apply(plan *deployPlan, files []deployFile) error {
+	sources := map[string]string{}
+	for _, file := range files {
+		sources[file.Path] = file.File
+	}
+	for _, upload := range plan.Uploads {
+		data, err := ioutil.ReadFile(sources[upload.Path])
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(d.dir, filepath.FromSlash(upload.Path))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(dest, data, 0644); err != nil {
+			return err
+		}
+	}
+	root := filepath.Clean(d.dir)
+	for _, file := range plan.Deletes {
+		dest := filepath.Join(d.dir, filepath.FromSlash(file))
+		if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		// Remove the folders that are now empty, up to the target directory
+		for dir := filepath.Dir(dest); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// rsyncDeployer syncs the site with rsync over SSH. rsync compares the files
+// by checksum; the web server at the destination sets the cache headers.
+type rsyncDeployer struct {
+	target DeployTarget
+}
+
+// command returns the rsync invocation, as a dry run when asked
+func (d *rsyncDeployer) command(dryRun bool) *exec.Cmd {
+	args := []string{"--recursive", "--times", "--checksum", "--delete", "--exclude=/" + buildManifestName, "--out-format=%i %n"}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+	if d.target.SSHPort != 0 || d.target.SSHKey != "" {
+		ssh := "ssh"
+		if d.target.SSHPort != 0 {
+			ssh += " -p " + strconv.Itoa(d.target.SSHPort)
+		}
+		if d.target.SSHKey != "" {
+			ssh += " -i " + d.target.SSHKey
+		}
+		args = append(args, "-e", ssh)
+	}
+	args = append(args, strings.TrimSuffix(d.target.Folder, "/")+"/", d.target.Destination)
+	return exec.Command("rsync", args...)
+}
+
+func (d *rsyncDeployer) plan(files []deployFile) (*deployPlan, error) {
+	out, err := d.command(true).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("rsync: %v: %s", err, bytes.TrimSpace(out))
+	}
+
+	// Each line is an itemized change (https://download.samba.org/pub/rsync/rsync.1#opt--itemize-changes):
+	// "<f+++++++++ new.html", "<f.st...... changed.html" or "*deleting   old.html"
+	plan := &deployPlan{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) < 2 {
+			continue
+		}
+		item, name := fields[0], strings.TrimSpace(fields[1])
+		switch {
+		case item == "*deleting":
+			if !strings.HasSuffix(name, "/") {
+				plan.Deletes = append(plan.Deletes, name)
+			}
+		case len(item) > 2 && (item[0] == '<' || item[0] == '>') && item[1] == 'f':
+			plan.Uploads = append(plan.Uploads, deployUpload{Path: name, New: strings.HasPrefix(item[2:], "+++")})
+		}
+	}
+	plan.Unchanged = len(files) - len(plan.Uploads)
+	return plan, nil
+}
+
+func (d *rsyncDeployer) apply(plan *deployPlan, files []deployFile) error {
+	if out, err := d.command(false).CombinedOutput(); err != nil {
+		return fmt.Errorf("rsync: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// s3Deployer uploads the site to an S3-compatible bucket, with requests
+// signed with AWS Signature Version 4
+// (https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html)
+type s3Deployer struct {
+	target   DeployTarget
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// s3ListResult is a page of a ListObjectsV2 response
+type s3ListResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// s3Error is the body of a failed S3 request
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3EmptyHash is the SHA-256 of an empty request body
+const s3EmptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (d *s3Deployer) plan(files []deployFile) (*deployPlan, error) {
+	// Single-part uploads have the MD5 of their content as ETag
+	remote := map[string]string{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {d.target.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		body, err := d.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("listing %s: %w", d.target.Bucket, err)
+		}
+		for _, object := range result.Contents {
+			remote[strings.TrimPrefix(object.Key, d.target.Prefix)] = strings.Trim(object.ETag, `"`)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	plan := &deployPlan{}
+	for _, file := range files {
+		etag, exists := remote[file.Path]
+		delete(remote, file.Path)
+		if exists {
+			data, err := ioutil.ReadFile(file.File)
+			if err != nil {
+				return nil, err
+			}
+			if sum := md5.Sum(data); hex.EncodeToString(sum[:]) == etag {
+				plan.Unchanged++
+				continue
+			}
+		}
+		plan.Uploads = append(plan.Uploads, deployUpload{Path: file.Path, New: !exists})
+	}
+	for key := range remote {
+		plan.Deletes = append(plan.Deletes, key)
+	}
+	sort.Strings(plan.Deletes)
+	return plan, nil
+}
+
+func (d *s3Deployer) apply(plan *deployPlan, files []deployFile) error {
+	sources := map[string]string{}
+	for _, file := range files {
+		sources[file.Path] = file.File
+	}
+	for _, upload := range plan.Uploads {
+		data, err := ioutil.ReadFile(sources[upload.Path])
+		if err != nil {
+			return err
+		}
+		md5sum := md5.Sum(data)
+		header := http.Header{
+			"Content-Type":  {deployContentType(upload.Path)},
+			"Cache-Control": {cacheControl("/" + upload.Path)},
+			"Content-Md5":   {base64.StdEncoding.EncodeToString(md5sum[:])},
+		}
+		if _, err := d.do(http.MethodPut, d.target.Prefix+upload.Path, nil, header, data); err != nil {
+			return err
+		}
+	}
+	for _, key := range plan.Deletes {
+		if _, err := d.do(http.MethodDelete, d.target.Prefix+key, nil, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// objectURL returns the URL of an object, or of the bucket when key is empty
+func (d *s3Deployer) objectURL(key string, query url.Values) *url.URL {
+	u := *d.endpoint
+	p := "/" + key
+	if d.target.PathStyle {
+		p = "/" + d.target.Bucket + p
+	} else {
+		u.Host = d.target.Bucket + "." + u.Host
+	}
+	u.Path = p
+	u.RawPath = s3Escape(p, false)
+	u.RawQuery = s3Query(query)
+	return &u
+}
+
+// do sends a signed request and returns the response body, or the error S3 reported
+func (d *s3Deployer) do(method, key string, query url.Values, header http.Header, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, d.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	d.sign(req, body, time.Now())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var s3Err s3Error
+		if xml.Unmarshal(respBody, &s3Err) == nil && s3Err.Code != "" {
+			return nil, fmt.Errorf("%s /%s: %s: %s", method, key, s3Err.Code, s3Err.Message)
+		}
+		return nil, fmt.Errorf("%s /%s: %s", method, key, resp.Status)
+	}
+	return respBody, nil
+}
+
+// sign adds the AWS Signature Version 4 Authorization header to a request,
+// signing the host and every header already set
+func (d *s3Deployer) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := s3EmptyHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + d.target.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + d.target.SecretKey)
+	for _, part := range []string{date, d.target.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+d.target.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape URI-encodes a string the way Signature Version 4 expects: every
+// byte but the unreserved characters, and slashes unless escapeSlash is set
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !escapeSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Query encodes a query string in the canonical form: sorted by key, with
+// keys and values URI-encoded
+func s3Query(query url.Values) string {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
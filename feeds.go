@@ -0,0 +1,637 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/html"
+)
+
+// FeedLink is a feed advertised to feed readers with <link rel="alternate">
+type FeedLink struct {
+	Type  string
+	Title string
+	URL   string
+}
+
+// feedItem is a post as it appears in every feed format
+type feedItem struct {
+	ID        string // tag URI, stable across URL and title changes of the site
+	Title     string
+	URL       string
+	Published time.Time
+	Updated   time.Time
+	Summary   string
+	Content   string // rendered HTML
+	Tags      []string
+	Author    string
+	AuthorURL string
+	Image     string
+	modTime   time.Time // of the post file
+}
+
+// rssFeed is an RSS 2.0 document
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	ContentNS string     `xml:"xmlns:content,attr,omitempty"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	Language      string      `xml:"language,omitempty"`
+	LastBuildDate string      `xml:"lastBuildDate,omitempty"`
+	AtomLink      rssAtomLink `xml:"atom:link"`
+	Items         []rssItem   `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Description string   `xml:"description,omitempty"`
+	Categories  []string `xml:"category"`
+	Content     string   `xml:"content:encoded,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// atomFeed is an Atom 1.0 (RFC 4287) document
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang     string      `xml:"xml:lang,attr,omitempty"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated,omitempty"`
+	Links    []atomLink  `xml:"link"`
+	Author   *atomPerson `xml:"author,omitempty"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Links      []atomLink     `xml:"link"`
+	Published  string         `xml:"published,omitempty"`
+	Updated    string         `xml:"updated"`
+	Author     *atomPerson    `xml:"author,omitempty"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+	Categories []atomCategory `xml:"category"`
+}
+
+// jsonFeed is a JSON Feed 1.1 document (https://jsonfeed.org/version/1.1)
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	ContentText   string           `json:"content_text,omitempty"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+}
+
+// feedChannel is one feed of the site: all posts, or the posts of a tag or author
+type feedChannel struct {
+	Lang        string
+	Title       string
+	Description string
+	Path        string    // site path the feed files live under, e.g. "/tags/go" ("" for the whole site)
+	HomeURL     string    // page the feed belongs to
+	Since       time.Time // date of the oldest post, so the Atom id stays the same as posts are added; zero when no post is dated
+	Items       []feedItem
+}
+
+// feedFormat is a feed file served for every channel
+type feedFormat struct {
+	File     string
+	Type     string
+	Name     string
+	Generate func(feedChannel) ([]byte, error)
+}
+
+var feedFormats = []feedFormat{
+	{File: "feed.xml", Type: "application/rss+xml", Name: "RSS", Generate: generateRSSFeed},
+	{File: "atom.xml", Type: "application/atom+xml", Name: "Atom", Generate: generateAtomFeed},
+	{File: "feed.json", Type: "application/feed+json", Name: "JSON", Generate: generateJSONFeed},
+}
+
+// registerFeedRoutes registers every feed format for the whole site, each tag and each author
+func registerFeedRoutes(r gin.IRoutes) {
+	for _, format := range feedFormats {
+		r.GET("/"+format.File, serveFeed(format, siteFeed))
+		r.GET("/tags/:tag/"+format.File, serveFeed(format, tagFeed))
+		r.GET("/authors/:author/"+format.File, serveFeed(format, authorFeed))
+	}
+}
+
+// feedLinks returns the feeds under a path for feed discovery in templates.
+// name is added to the site title for the feeds of a tag or author.
+func feedLinks(lang, path, name string) []FeedLink {
+	title := languageConfig(lang).SiteTitle
+	if name != "" {
+		title += " - " + name
+	}
+	var links []FeedLink
+	for _, format := range feedFormats {
+		links = append(links, FeedLink{
+			Type:  format.Type,
+			Title: title + " " + format.Name + " Feed",
+			URL:   langPrefix(lang) + path + "/" + format.File,
+		})
+	}
+	return links
+}
+
+// parsePostTime parses a front matter date ("2006-01-02") or date and time ("2006-01-02 15:04")
+func parsePostTime(value string) (time.Time, bool) {
+	if t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// tagURI returns a tag URI (RFC 4151) for a path on the site, e.g.
+// "tag:example.com,2025-11-01:/posts/first-post"
+func tagURI(date time.Time, path string) string {
+	host := appConfig.SiteURL
+	if u, err := url.Parse(appConfig.SiteURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	return "tag:" + host + "," + date.Format("2006-01-02") + ":" + path
+}
+
+// newFeedChannel builds a feed of the newest posts, limited to feed_items
+func newFeedChannel(lang, title, path, homeURL string, posts []PageLink) feedChannel {
+	site := languageConfig(lang)
+	ch := feedChannel{
+		Lang:        lang,
+		Title:       site.SiteTitle,
+		Description: site.SiteDescription,
+		Path:        path,
+		HomeURL:     homeURL,
+	}
+	if title != "" {
+		ch.Title += " - " + title
+	}
+	for _, post := range posts {
+		if t, ok := parsePostTime(post.Date); ok && (ch.Since.IsZero() || t.Before(ch.Since)) {
+			ch.Since = t
+		}
+	}
+	if len(posts) > appConfig.FeedItems {
+		posts = posts[:appConfig.FeedItems]
+	}
+	ch.Items = loadFeedItems(posts, lang)
+	return ch
+}
+
+// siteFeed is the feed of every post of a language
+func siteFeed(c *gin.Context) (feedChannel, bool) {
+	lang := requestLang(c)
+	return newFeedChannel(lang, "", "", appConfig.SiteURL+langPrefix(lang)+"/", getBlogPostsForLang(lang)), true
+}
+
+// tagFeed is the feed of the posts with a tag
+func tagFeed(c *gin.Context) (feedChannel, bool) {
+	lang := requestLang(c)
+	tag := c.Param("tag")
+	var posts []PageLink
+	for _, post := range getBlogPostsForLang(lang) {
+		for _, postTag := range post.Tags {
+			if strings.EqualFold(postTag, tag) {
+				posts = append(posts, post)
+				tag = postTag
+				break
+			}
+		}
+	}
+	path := "/tags/" + url.PathEscape(tag)
+	return newFeedChannel(lang, tag, path, appConfig.SiteURL+langPrefix(lang)+path, posts), len(posts) > 0
+}
+
+// authorFeed is the feed of the posts by an author, addressed by the slug of
+// their name (e.g. /authors/jane-doe/feed.xml)
+func authorFeed(c *gin.Context) (feedChannel, bool) {
+	lang := requestLang(c)
+	slug := c.Param("author")
+	var posts []PageLink
+	var name string
+	for _, post := range getBlogPostsForLang(lang) {
+		author := post.Author
+		if author == "" {
+			author = appConfig.SiteAuthor
+		}
+		if slugify(author) == slug {
+			posts = append(posts, post)
+			name = author
+		}
+	}
+	return newFeedChannel(lang, name, "/authors/"+slug, appConfig.SiteURL+langPrefix(lang)+"/", posts), len(posts) > 0
+}
+
+// loadFeedItems loads the posts of a feed
+func loadFeedItems(posts []PageLink, lang string) []feedItem {
+	baseURL := appConfig.SiteURL + langPrefix(lang)
+	var items []feedItem
+	for _, post := range posts {
+		fileSlug := langFileSlug(post.Slug, lang)
+		doc, err := loadMarkdownFile("posts", fileSlug)
+		if err != nil {
+			continue
+		}
+		path := langPrefix(lang) + "/posts/" + post.Slug
+		item := feedItem{
+			Title:     doc.Title,
+			URL:       baseURL + "/posts/" + post.Slug,
+			Summary:   postDescription(doc),
+			Tags:      doc.Tags,
+			Author:    doc.Author,
+			AuthorURL: appConfig.SiteAuthorURL,
+			Image:     absoluteURL(doc.Image),
+		}
+		item.Content = absoluteHTML(doc.HTML, item.URL)
+		if item.Author == "" {
+			item.Author = appConfig.SiteAuthor
+		} else if item.Author != appConfig.SiteAuthor {
+			item.AuthorURL = ""
+		}
+		if t, ok := parsePostTime(doc.PublishDate); ok {
+			item.Published = t
+		} else if t, ok := parsePostTime(doc.Date); ok {
+			item.Published = t
+		}
+		item.Updated = item.Published
+		if t, ok := parsePostTime(doc.Updated); ok && t.After(item.Published) {
+			item.Updated = t
+		}
+		if info, err := os.Stat(filepath.Join("posts", fileSlug+".md")); err == nil {
+			item.modTime = info.ModTime()
+		}
+		item.ID = tagURI(item.Published, path)
+		items = append(items, item)
+	}
+	return items
+}
+
+// absoluteHTML rewrites the relative links and image sources in rendered HTML
+// against the URL of the page, so they keep working in feed readers
+func absoluteHTML(content, pageURL string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return content
+	}
+	resolve := func(ref string) string {
+		u, err := url.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			return ref
+		}
+		return base.ResolveReference(u).String()
+	}
+
+	var out strings.Builder
+	z := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.Write(z.Raw())
+			continue
+		}
+		token := z.Token()
+		changed := false
+		for i, attr := range token.Attr {
+			switch attr.Key {
+			case "href", "src", "poster":
+				token.Attr[i].Val = resolve(attr.Val)
+				changed = true
+			case "srcset":
+				candidates := strings.Split(attr.Val, ",")
+				for j, candidate := range candidates {
+					fields := strings.Fields(candidate)
+					if len(fields) > 0 {
+						fields[0] = resolve(fields[0])
+						candidates[j] = strings.Join(fields, " ")
+					}
+				}
+				token.Attr[i].Val = strings.Join(candidates, ", ")
+				changed = true
+			}
+		}
+		if changed {
+			out.WriteString(token.String())
+		} else {
+			out.Write(z.Raw())
+		}
+	}
+	return out.String()
+}
+
+// feedUpdated returns the time of the most recent change in a feed. Without
+// dated posts it is the newest post file's modification time, and zero for a
+// feed without posts, never the current time: the feed must stay byte for
+// byte the same until a post changes, for ETags and incremental builds.
+func feedUpdated(items []feedItem) time.Time {
+	var updated time.Time
+	for _, item := range items {
+		if item.Updated.After(updated) {
+			updated = item.Updated
+		}
+	}
+	if updated.IsZero() {
+		for _, item := range items {
+			if item.modTime.After(updated) {
+				updated = item.modTime
+			}
+		}
+	}
+	return updated
+}
+
+// formatFeedTime formats a time for a feed, or returns "" for the zero time
+// so the element is left out
+func formatFeedTime(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// feedModified returns the time a feed last changed for Last-Modified,
+// counting edits to post files as well as front matter dates
+func feedModified(items []feedItem) time.Time {
+	modified := feedUpdated(items)
+	for _, item := range items {
+		if item.modTime.After(modified) {
+			modified = item.modTime
+		}
+	}
+	return modified
+}
+
+// generateRSSFeed builds an RSS 2.0 feed of posts. With feed_full_content the
+// whole post is added as content:encoded next to the summary.
+func generateRSSFeed(ch feedChannel) ([]byte, error) {
+	selfURL := appConfig.SiteURL + langPrefix(ch.Lang) + ch.Path + "/feed.xml"
+	feed := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         ch.Title,
+			Link:          ch.HomeURL,
+			Description:   ch.Description,
+			Language:      languageConfig(ch.Lang).Locale,
+			LastBuildDate: formatFeedTime(feedUpdated(ch.Items), time.RFC1123Z),
+			AtomLink:      rssAtomLink{Href: selfURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if appConfig.FeedFullContent {
+		feed.ContentNS = "http://purl.org/rss/1.0/modules/content/"
+	}
+	for _, item := range ch.Items {
+		rss := rssItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			GUID:        rssGUID{IsPermaLink: true, Value: item.URL},
+			Description: item.Summary,
+			Categories:  item.Tags,
+		}
+		if appConfig.FeedFullContent {
+			rss.Content = item.Content
+		}
+		if !item.Published.IsZero() {
+			rss.PubDate = item.Published.Format(time.RFC1123Z)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, rss)
+	}
+	return marshalXML(feed)
+}
+
+// atomFeedID returns the permanent id of a feed: a tag URI dated by its oldest
+// post, or the URL of the feed's folder when no post has a date
+func atomFeedID(ch feedChannel) string {
+	path := langPrefix(ch.Lang) + ch.Path + "/"
+	if ch.Since.IsZero() {
+		return strings.TrimSuffix(appConfig.SiteURL, "/") + path
+	}
+	return tagURI(ch.Since, path)
+}
+
+// generateAtomFeed builds an Atom 1.0 feed of posts. Entries carry the whole
+// post with feed_full_content, and only the summary otherwise.
+func generateAtomFeed(ch feedChannel) ([]byte, error) {
+	feed := atomFeed{
+		Lang:     languageConfig(ch.Lang).Locale,
+		Title:    ch.Title,
+		Subtitle: ch.Description,
+		ID:       atomFeedID(ch),
+		Updated:  formatFeedTime(feedUpdated(ch.Items), time.RFC3339),
+		Links: []atomLink{
+			{Href: appConfig.SiteURL + langPrefix(ch.Lang) + ch.Path + "/atom.xml", Rel: "self", Type: "application/atom+xml"},
+			{Href: ch.HomeURL, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	if appConfig.SiteAuthor != "" {
+		feed.Author = &atomPerson{Name: appConfig.SiteAuthor, URI: appConfig.SiteAuthorURL}
+	}
+	for _, item := range ch.Items {
+		entry := atomEntry{
+			Title:   item.Title,
+			ID:      item.ID,
+			Links:   []atomLink{{Href: item.URL, Rel: "alternate", Type: "text/html"}},
+			Updated: item.Updated.Format(time.RFC3339),
+			Summary: &atomText{Body: item.Summary},
+		}
+		if appConfig.FeedFullContent {
+			entry.Content = &atomText{Type: "html", Body: item.Content}
+		}
+		if !item.Published.IsZero() {
+			entry.Published = item.Published.Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			entry.Author = &atomPerson{Name: item.Author, URI: item.AuthorURL}
+		}
+		for _, tag := range item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshalXML(feed)
+}
+
+// generateJSONFeed builds a JSON Feed 1.1 of posts. Items carry the full post
+// with feed_full_content, and the summary as plain text otherwise.
+func generateJSONFeed(ch feedChannel) ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       ch.Title,
+		HomePageURL: ch.HomeURL,
+		FeedURL:     appConfig.SiteURL + langPrefix(ch.Lang) + ch.Path + "/feed.json",
+		Description: ch.Description,
+		Language:    languageConfig(ch.Lang).Locale,
+		Items:       []jsonFeedItem{},
+	}
+	if appConfig.SiteAuthor != "" {
+		feed.Authors = []jsonFeedAuthor{{Name: appConfig.SiteAuthor, URL: appConfig.SiteAuthorURL}}
+	}
+	for _, item := range ch.Items {
+		entry := jsonFeedItem{
+			ID:      item.ID,
+			URL:     item.URL,
+			Title:   item.Title,
+			Summary: item.Summary,
+			Image:   item.Image,
+			Tags:    item.Tags,
+		}
+		if appConfig.FeedFullContent {
+			entry.ContentHTML = item.Content
+		} else {
+			entry.ContentText = item.Summary
+		}
+		if !item.Published.IsZero() {
+			entry.DatePublished = item.Published.Format(time.RFC3339)
+		}
+		if item.Updated.After(item.Published) {
+			entry.DateModified = item.Updated.Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			entry.Authors = []jsonFeedAuthor{{Name: item.Author, URL: item.AuthorURL}}
+		}
+		feed.Items = append(feed.Items, entry)
+	}
+
+	// Keep HTML readable instead of escaping every < and > in content_html
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalXML encodes a feed or sitemap document with an XML declaration
+func marshalXML(feed interface{}) ([]byte, error) {
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// serveFeed returns a handler for one feed format of a channel. Feeds answer
+// conditional requests with 304, since feed readers poll them often.
+func serveFeed(format feedFormat, channel func(*gin.Context) (feedChannel, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ch, ok := channel(c)
+		if !ok {
+			renderError(c, http.StatusNotFound, "page_not_found", "page_not_found_message")
+			return
+		}
+		feed, err := format.Generate(ch)
+		if err != nil {
+			renderError(c, http.StatusInternalServerError, "internal_error", "internal_error_message")
+			return
+		}
+
+		sum := sha256.Sum256(feed)
+		etag := fmt.Sprintf("\"%x\"", sum[:16])
+		modified := feedModified(ch.Items).UTC().Truncate(time.Second)
+		c.Header("ETag", etag)
+		if !modified.IsZero() {
+			c.Header("Last-Modified", modified.Format(http.TimeFormat))
+		}
+		if notModified(c, etag, modified) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.Data(http.StatusOK, format.Type+"; charset=utf-8", feed)
+	}
+}
+
+// notModified reports whether a conditional request already has the current
+// version. If-None-Match takes precedence over If-Modified-Since (RFC 9110).
+func notModified(c *gin.Context, etag string, modified time.Time) bool {
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	return err == nil && !modified.IsZero() && !modified.After(since)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAtomFeedID(t *testing.T) {
+	lang := defaultLanguage()
+	dated := feedChannel{Lang: lang, Path: "/tags/go", Since: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	if got, want := atomFeedID(dated), tagURI(dated.Since, langPrefix(lang)+"/tags/go/"); got != want {
+		t.Errorf("dated feed: id = %q, want %q", got, want)
+	}
+
+	// Without dated posts the id must not depend on when the feed is read
+	undated := feedChannel{Lang: lang, Path: "/tags/go"}
+	if got, want := atomFeedID(undated), appConfig.SiteURL+langPrefix(lang)+"/tags/go/"; got != want {
+		t.Errorf("undated feed: id = %q, want %q", got, want)
+	}
+}
+
+func TestFeedUpdatedWithoutDates(t *testing.T) {
+	older := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC)
+	undated := []feedItem{{Title: "a", modTime: older}, {Title: "b", modTime: newer}}
+	if got := feedUpdated(undated); !got.Equal(newer) {
+		t.Errorf("undated posts: updated = %v, want the newest file time %v", got, newer)
+	}
+	if got := feedUpdated(nil); !got.IsZero() {
+		t.Errorf("no posts: updated = %v, want zero", got)
+	}
+
+	// A feed without posts leaves the dates out instead of using the clock
+	ch := feedChannel{Lang: defaultLanguage()}
+	rss, err := generateRSSFeed(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atom, err := generateAtomFeed(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(rss), "lastBuildDate") || strings.Contains(string(atom), "<updated>") {
+		t.Errorf("empty feed has a date:\n%s\n%s", rss, atom)
+	}
+}
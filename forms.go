@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FormConfig declares a form that pages can embed with {{< form name="..." >}}
+type FormConfig struct {
+	Fields    []FormField `yaml:"fields"`
+	Deliver   string      `yaml:"deliver"`    // "smtp", "webhook" or "file" (data/forms/<name>.jsonl)
+	To        string      `yaml:"to"`         // recipient for smtp delivery
+	Subject   string      `yaml:"subject"`    // subject for smtp delivery
+	Webhook   string      `yaml:"webhook"`    // URL that receives submissions as JSON
+	Submit    string      `yaml:"submit"`     // submit button label
+	Redirect  string      `yaml:"redirect"`   // thank-you page, defaults to /forms/<name>/thanks
+	RateLimit int         `yaml:"rate_limit"` // submissions per IP per 10 minutes
+}
+
+// FormField is one input of a form
+type FormField struct {
+	Name      string `yaml:"name"`
+	Label     string `yaml:"label"`
+	Type      string `yaml:"type"` // text, email, url or textarea
+	Required  bool   `yaml:"required"`
+	MaxLength int    `yaml:"max_length"`
+}
+
+// formSubmission is what gets delivered for a valid submission
+type formSubmission struct {
+	Form      string            `json:"form"`
+	Lang      string            `json:"lang"`
+	Submitted time.Time         `json:"submitted"`
+	Fields    map[string]string `json:"fields"`
+}
+
+const (
+	// formTokenMaxAge is how long a rendered form can be submitted
+	formTokenMaxAge = 24 * time.Hour
+	// formCookie holds a random value per browser that form tokens are bound
+	// to, so a token copied from a page works for nobody else (double submit)
+	formCookie = "podium_form"
+)
+
+var (
+	formShortcode = regexp.MustCompile(`(?m)^[ \t]*\{\{<\s*form\s+name="([A-Za-z0-9_-]+)"\s*>\}\}[ \t]*$`)
+	formMarker    = regexp.MustCompile(`<!-- podium-form:([A-Za-z0-9_-]+) -->`)
+	formLimiter   = newRateLimiter(10 * time.Minute)
+	formFileMu    sync.Mutex
+	formSecretMu  sync.Mutex
+	formSecretKey []byte
+
+	formWebhookClient = &http.Client{Timeout: 15 * time.Second}
+)
+
+var formTemplate = template.Must(template.New("form").Parse(`<form class="contact-form" id="form-{{.Name}}" method="post" action="{{.Action}}">
+{{- with .Status}}
+<p class="form-status form-error" role="alert">{{.}}</p>
+{{- end}}
+{{- range .Fields}}
+<label>{{.Label}}{{if not .Required}} <span class="form-optional">({{$.Optional}})</span>{{end}}
+{{- if eq .Type "textarea"}}
+<textarea name="{{.Name}}" rows="6" maxlength="{{.MaxLength}}"{{if .Required}} required{{end}}></textarea>
+{{- else}}
+<input type="{{.Type}}" name="{{.Name}}" maxlength="{{.MaxLength}}"{{if .Required}} required{{end}} />
+{{- end}}
+</label>
+{{- end}}
+<input type="hidden" name="_token" value="{{.Token}}" />
+<input type="hidden" name="_return" value="{{.Return}}" />
+<div class="form-hp" aria-hidden="true"><label>Company <input type="text" name="_company" tabindex="-1" autocomplete="off" /></label></div>
+<button type="submit">{{.Submit}}</button>
+</form>`))
+
+// expandFormShortcodes replaces {{< form name="..." >}} lines in markdown with
+// a marker that renderForms turns into the form when the page is served
+func expandFormShortcodes(markdown string) string {
+	return formShortcode.ReplaceAllString(markdown, "\n<!-- podium-form:$1 -->\n")
+}
+
+// renderForms replaces the form markers in a page's HTML with the forms,
+// each with a fresh token and the status of the last submission
+func renderForms(c *gin.Context, content string) string {
+	if !formMarker.MatchString(content) {
+		return content
+	}
+	lang := requestLang(c)
+	client := formClient(c)
+	// The tokens belong to this browser, so shared caches must not keep the page
+	c.Header("Cache-Control", "private, no-cache")
+	return formMarker.ReplaceAllStringFunc(content, func(marker string) string {
+		name := formMarker.FindStringSubmatch(marker)[1]
+		form, ok := appConfig.Forms[name]
+		if !ok {
+			log.Printf("Warning: Page embeds unknown form %q", name)
+			return ""
+		}
+
+		data := struct {
+			Name, Action, Token, Return, Submit, Status, Optional string
+			Fields                                                []FormField
+		}{
+			Name:     name,
+			Action:   langPrefix(lang) + "/forms/" + name,
+			Token:    formToken(name, client, time.Now()),
+			Return:   c.Request.URL.Path,
+			Submit:   form.Submit,
+			Optional: translate(lang, "form_optional"),
+			Fields:   form.Fields,
+		}
+		if data.Submit == "" {
+			data.Submit = translate(lang, "form_submit")
+		}
+		if status := c.Query("form"); status != "" && c.Query("form_name") == name && formStatuses[status] {
+			data.Status = translate(lang, "form_"+status)
+		}
+
+		var buf bytes.Buffer
+		if err := formTemplate.Execute(&buf, data); err != nil {
+			log.Printf("Error rendering form %s: %v", name, err)
+			return ""
+		}
+		return buf.String()
+	})
+}
+
+// formStatuses are the problems a submission can be sent back with
+var formStatuses = map[string]bool{
+	"missing":       true,
+	"too_long":      true,
+	"invalid_email": true,
+	"invalid_url":   true,
+	"expired":       true,
+	"rate_limited":  true,
+	"failed":        true,
+}
+
+// formSecret returns the key that signs form tokens, creating data/form-secret on first use
+func formSecret() ([]byte, error) {
+	formSecretMu.Lock()
+	defer formSecretMu.Unlock()
+	if formSecretKey != nil {
+		return formSecretKey, nil
+	}
+
+	path := filepath.Join(appConfig.DataFolder, "form-secret")
+	key, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key = []byte(randomID(32))
+		if err := os.MkdirAll(appConfig.DataFolder, 0755); err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(path, key, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	formSecretKey = key
+	return key, nil
+}
+
+// formClient returns the value of the browser's form cookie, creating one when
+// it has none. The cookie is sent again so it outlives the new tokens.
+func formClient(c *gin.Context) string {
+	client, err := c.Cookie(formCookie)
+	if err != nil || !validFormClient(client) {
+		client = randomID(16)
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(formCookie, client, int(formTokenMaxAge/time.Second), "/", "", strings.HasPrefix(appConfig.SiteURL, "https://"), true)
+	return client
+}
+
+// validFormClient reports whether a cookie value looks like one formClient set
+func validFormClient(client string) bool {
+	if len(client) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(client)
+	return err == nil
+}
+
+// formToken signs a form name, the browser's form cookie and the time the
+// form was rendered
+func formToken(name, client string, t time.Time) string {
+	key, err := formSecret()
+	if err != nil {
+		log.Printf("Warning: Failed to load form secret: %v", err)
+		return ""
+	}
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "|" + client + "|" + ts))
+	return ts + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validFormToken checks that a token was issued by this site for the form and
+// the browser's cookie, and has not expired
+func validFormToken(name, client, token string) bool {
+	if !validFormClient(client) {
+		return false
+	}
+	ts, _, ok := strings.Cut(token, ".")
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if !ok || err != nil {
+		return false
+	}
+	issued := time.Unix(unix, 0)
+	if time.Since(issued) > formTokenMaxAge || time.Until(issued) > time.Minute {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(formToken(name, client, issued)))
+}
+
+// handleFormSubmit validates a form submission, delivers it and redirects to the thank-you page
+func handleFormSubmit(c *gin.Context) {
+	name := c.Param("name")
+	lang := requestLang(c)
+	form, ok := appConfig.Forms[name]
+	if !ok {
+		renderError(c, http.StatusNotFound, "page_not_found", "page_not_found_message")
+		return
+	}
+
+	// Send problems back to the page the form is on; only local paths are accepted
+	back := c.PostForm("_return")
+	if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") || strings.ContainsAny(back, "\\?#") ||
+		strings.IndexFunc(back, unicode.IsControl) >= 0 {
+		back = langPrefix(lang) + "/"
+	}
+	fail := func(status string) {
+		c.Redirect(http.StatusSeeOther, back+"?form="+status+"&form_name="+url.QueryEscape(name)+"#form-"+name)
+	}
+	thanks := form.Redirect
+	if thanks == "" {
+		thanks = langPrefix(lang) + "/forms/" + name + "/thanks"
+	}
+
+	if honeypotFilled(c) {
+		log.Printf("Dropped %s form submission: honeypot filled in", name)
+		c.Redirect(http.StatusSeeOther, thanks)
+		return
+	}
+	client, _ := c.Cookie(formCookie)
+	if !validFormToken(name, client, c.PostForm("_token")) {
+		fail("expired")
+		return
+	}
+	if !formLimiter.Allow(name+"|"+c.ClientIP(), form.RateLimit) {
+		log.Printf("Rate limited %s form submission from %s", name, c.ClientIP())
+		fail("rate_limited")
+		return
+	}
+
+	sub := formSubmission{Form: name, Lang: lang, Submitted: time.Now(), Fields: map[string]string{}}
+	for _, field := range form.Fields {
+		value := strings.TrimSpace(c.PostForm(field.Name))
+		if status := validateFormField(field, value); status != "" {
+			fail(status)
+			return
+		}
+		sub.Fields[field.Name] = value
+	}
+
+	if err := deliverForm(name, form, sub); err != nil {
+		log.Printf("Error delivering %s form submission: %v", name, err)
+		fail("failed")
+		return
+	}
+	log.Printf("Delivered %s form submission (%s)", name, form.Deliver)
+	c.Redirect(http.StatusSeeOther, thanks)
+}
+
+// handleFormThanks is the default page readers see after submitting a form
+func handleFormThanks(c *gin.Context) {
+	if _, ok := appConfig.Forms[c.Param("name")]; !ok {
+		renderError(c, http.StatusNotFound, "page_not_found", "page_not_found_message")
+		return
+	}
+	renderMessage(c, http.StatusOK, "form_thanks_title", "form_thanks_message")
+}
+
+// validateFormField returns the status key of the problem with a value, or "" when it is fine
+func validateFormField(field FormField, value string) string {
+	if value == "" {
+		if field.Required {
+			return "missing"
+		}
+		return ""
+	}
+	if len([]rune(value)) > field.MaxLength {
+		return "too_long"
+	}
+	switch field.Type {
+	case "email":
+		if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+			return "invalid_email"
+		}
+	case "url":
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "invalid_url"
+		}
+	}
+	return ""
+}
+
+// deliverForm hands a submission to the form's delivery method
+func deliverForm(name string, form FormConfig, sub formSubmission) error {
+	switch form.Deliver {
+	case "smtp":
+		return mailForm(name, form, sub)
+	case "webhook":
+		return postFormWebhook(form, sub)
+	case "file":
+		return appendFormFile(name, sub)
+	}
+	return fmt.Errorf("unknown delivery method %q", form.Deliver)
+}
+
+// mailForm sends a submission by email, with Reply-To set to the first email field
+func mailForm(name string, form FormConfig, sub formSubmission) error {
+	if form.To == "" {
+		return errors.New("no recipient (to) configured")
+	}
+	subject := form.Subject
+	if subject == "" {
+		subject = fmt.Sprintf("New %s form submission", name)
+	}
+
+	var text, body strings.Builder
+	headers := map[string]string{}
+	for _, field := range form.Fields {
+		value := sub.Fields[field.Name]
+		fmt.Fprintf(&text, "%s:\n%s\n\n", field.Label, value)
+		fmt.Fprintf(&body, "<p><strong>%s</strong><br />%s</p>\n", html.EscapeString(field.Label),
+			strings.ReplaceAll(html.EscapeString(value), "\n", "<br />"))
+		if field.Type == "email" && value != "" && headers["Reply-To"] == "" {
+			if addr, err := mail.ParseAddress(value); err == nil {
+				headers["Reply-To"] = addr.String()
+			}
+		}
+	}
+	fmt.Fprintf(&text, "-- \nSent from %s (%s)\n", appConfig.SiteURL, sub.Lang)
+
+	return sendMail(mailMessage{
+		To:      form.To,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    "<!DOCTYPE html>\n<html><body>\n" + body.String() + "</body></html>\n",
+		Headers: headers,
+	})
+}
+
+// postFormWebhook posts a submission as JSON to the form's webhook URL
+func postFormWebhook(form FormConfig, sub formSubmission) error {
+	if form.Webhook == "" {
+		return errors.New("no webhook URL configured")
+	}
+	payload, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	resp, err := formWebhookClient.Post(form.Webhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// appendFormFile appends a submission as one JSON line to data/forms/<name>.jsonl
+func appendFormFile(name string, sub formSubmission) error {
+	line, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+
+	formFileMu.Lock()
+	defer formFileMu.Unlock()
+	dir := filepath.Join(appConfig.DataFolder, "forms")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, name+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormTokenIsBoundToClient(t *testing.T) {
+	useTestNetwork(t)
+	client, other := randomID(16), randomID(16)
+	token := formToken("contact", client, time.Now())
+
+	tests := []struct {
+		name         string
+		form, client string
+		token        string
+		want         bool
+	}{
+		{"same browser", "contact", client, token, true},
+		{"other browser", "contact", other, token, false},
+		{"no cookie", "contact", "", token, false},
+		{"other form", "signup", client, token, false},
+		{"expired", "contact", client, formToken("contact", client, time.Now().Add(-formTokenMaxAge-time.Minute)), false},
+		{"from the future", "contact", client, formToken("contact", client, time.Now().Add(time.Hour)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validFormToken(tt.form, tt.client, tt.token); got != tt.want {
+				t.Errorf("validFormToken = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// markdownConverter converts HTML to Markdown. Elements Markdown has no
+// syntax for are kept as HTML, which the Markdown renderer passes through;
+// the block elements among them (tables, embeds, ...) are listed in kept.
+type markdownConverter struct {
+	rewrite func(string) string // maps link and image URLs, when set
+	kept    map[string]bool
+}
+
+// markdownEscaper escapes the characters that would otherwise start Markdown markup
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`)
+
+// markdownBlockStart matches text at the start of a paragraph that Markdown
+// would read as a heading, quote, list item or rule
+var markdownBlockStart = regexp.MustCompile(`^(#|>|[-+*] |-{3,})`)
+
+// markdownOrderedStart matches a paragraph that would read as an ordered list item
+var markdownOrderedStart = regexp.MustCompile(`^(\d+)\. `)
+
+// keptBlocks are block elements without Markdown syntax, kept as HTML
+var keptBlocks = map[atom.Atom]bool{
+	atom.Table: true, atom.Iframe: true, atom.Video: true, atom.Audio: true, atom.Embed: true,
+	atom.Object: true, atom.Script: true, atom.Form: true, atom.Dl: true, atom.Details: true,
+	atom.Svg: true, atom.Math: true,
+}
+
+// keptInline are inline elements without Markdown syntax, kept as HTML
+var keptInline = map[atom.Atom]bool{
+	atom.Sup: true, atom.Sub: true, atom.U: true, atom.Mark: true, atom.Small: true,
+}
+
+// blockElements start a new block of Markdown
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Ul: true, atom.Ol: true, atom.Blockquote: true, atom.Pre: true,
+	atom.Hr: true, atom.Figure: true, atom.Figcaption: true, atom.Section: true, atom.Article: true,
+	atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Main: true, atom.Nav: true,
+	atom.Address: true, atom.Center: true,
+}
+
+// htmlToMarkdown converts an HTML fragment to Markdown
+func (mc *markdownConverter) htmlToMarkdown(source string) (string, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(source), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return "", err
+	}
+	if mc.kept == nil {
+		mc.kept = map[string]bool{}
+	}
+	return strings.TrimSpace(mc.blocks(nodes)) + "\n", nil
+}
+
+// keptTags returns the elements that were kept as HTML, sorted
+func (mc *markdownConverter) keptTags() []string {
+	var tags []string
+	for tag := range mc.kept {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// blocks converts a list of nodes to Markdown blocks separated by blank lines
+func (mc *markdownConverter) blocks(nodes []*html.Node) string {
+	var out []string
+	var inline strings.Builder
+	flush := func() {
+		if text := strings.TrimSpace(inline.String()); text != "" {
+			out = append(out, escapeBlockStart(text))
+		}
+		inline.Reset()
+	}
+	for _, n := range nodes {
+		if n.Type == html.ElementNode && (blockElements[n.DataAtom] || keptBlocks[n.DataAtom]) {
+			flush()
+			if block := strings.TrimSpace(mc.block(n)); block != "" {
+				out = append(out, block)
+			}
+			continue
+		}
+		inline.WriteString(mc.inline(n))
+	}
+	flush()
+	return strings.Join(out, "\n\n")
+}
+
+// block converts a block element
+func (mc *markdownConverter) block(n *html.Node) string {
+	if keptBlocks[n.DataAtom] {
+		mc.kept[n.Data] = true
+		return mc.keep(n)
+	}
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level, _ := strconv.Atoi(n.Data[1:])
+		return strings.Repeat("#", level) + " " + strings.TrimSpace(collapseLines(mc.children(n)))
+	case atom.P:
+		return escapeBlockStart(strings.TrimSpace(mc.children(n)))
+	case atom.Hr:
+		return "---"
+	case atom.Pre:
+		return mc.codeBlock(n)
+	case atom.Blockquote:
+		return prefixLines(mc.blocks(childNodes(n)), "> ", ">")
+	case atom.Ul, atom.Ol:
+		return mc.list(n)
+	case atom.Figcaption:
+		if caption := strings.TrimSpace(mc.children(n)); caption != "" {
+			return "*" + caption + "*"
+		}
+		return ""
+	default:
+		// Containers (div, figure, section, ...) are replaced by their content
+		return mc.blocks(childNodes(n))
+	}
+}
+
+// inline converts an inline node
+func (mc *markdownConverter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		text := strings.Join(strings.Fields(n.Data), " ")
+		if text == "" && n.Data != "" {
+			return " "
+		}
+		if startsWithSpace(n.Data) {
+			text = " " + text
+		}
+		if endsWithSpace(n.Data) && text != " " {
+			text += " "
+		}
+		return markdownEscaper.Replace(text)
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	if keptBlocks[n.DataAtom] {
+		mc.kept[n.Data] = true
+		return mc.keep(n)
+	}
+	if keptInline[n.DataAtom] {
+		return mc.keep(n)
+	}
+	switch n.DataAtom {
+	case atom.Br:
+		return "  \n"
+	case atom.Strong, atom.B:
+		return wrapInline(mc.children(n), "**")
+	case atom.Em, atom.I, atom.Cite:
+		return wrapInline(mc.children(n), "*")
+	case atom.Del, atom.S, atom.Strike:
+		return wrapInline(mc.children(n), "~~")
+	case atom.Code, atom.Kbd, atom.Samp:
+		code := textContent(n)
+		fence := "`"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+			return fence + " " + code + " " + fence
+		}
+		return fence + code + fence
+	case atom.A:
+		text := strings.TrimSpace(mc.children(n))
+		href := attrValue(n, "href")
+		if href == "" {
+			return text
+		}
+		if text == "" {
+			text = href
+		}
+		return "[" + text + "](" + mc.url(href) + markdownTitle(attrValue(n, "title")) + ")"
+	case atom.Img:
+		src := attrValue(n, "src")
+		if src == "" {
+			return ""
+		}
+		return "![" + markdownEscaper.Replace(attrValue(n, "alt")) + "](" + mc.url(src) + markdownTitle(attrValue(n, "title")) + ")"
+	default:
+		// span, abbr, font, ... are replaced by their content
+		return mc.children(n)
+	}
+}
+
+// children converts the children of a node as inline content
+func (mc *markdownConverter) children(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockElements[c.DataAtom] {
+			// A block inside inline content, e.g. a <p> in an <li>
+			b.WriteString(" " + collapseLines(mc.block(c)) + " ")
+			continue
+		}
+		b.WriteString(mc.inline(c))
+	}
+	return b.String()
+}
+
+// list converts a ul or ol, indenting the continuation lines of each item
+func (mc *markdownConverter) list(n *html.Node) string {
+	var items []string
+	number := 1
+	if start, err := strconv.Atoi(attrValue(n, "start")); err == nil {
+		number = start
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+			continue
+		}
+		content := mc.blocks(childNodes(c))
+		if content == "" {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		lines := strings.Split(content, "\n")
+		for i := 1; i < len(lines); i++ {
+			if lines[i] != "" {
+				lines[i] = strings.Repeat(" ", len(marker)) + lines[i]
+			}
+		}
+		items = append(items, marker+strings.Join(lines, "\n"))
+	}
+	return strings.Join(items, "\n")
+}
+
+// codeBlock converts a pre element to a fenced code block, with the
+// language of a "language-x" or "lang-x" class
+func (mc *markdownConverter) codeBlock(n *html.Node) string {
+	code := textContent(n)
+	lang := ""
+	for _, node := range []*html.Node{n, n.FirstChild} {
+		if node == nil || node.Type != html.ElementNode {
+			continue
+		}
+		for _, class := range strings.Fields(attrValue(node, "class")) {
+			for _, prefix := range []string{"language-", "lang-"} {
+				if strings.HasPrefix(class, prefix) {
+					lang = strings.TrimPrefix(class, prefix)
+				}
+			}
+		}
+	}
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + strings.TrimRight(code, "\n") + "\n" + fence
+}
+
+// keep renders a node as HTML
+func (mc *markdownConverter) keep(n *html.Node) string {
+	if mc.rewrite != nil {
+		for i, a := range n.Attr {
+			if a.Key == "src" || a.Key == "href" || a.Key == "poster" {
+				n.Attr[i].Val = mc.rewrite(a.Val)
+			}
+		}
+	}
+	var b bytes.Buffer
+	html.Render(&b, n)
+	return b.String()
+}
+
+// url maps a link or image URL and escapes it for a Markdown link
+func (mc *markdownConverter) url(u string) string {
+	if mc.rewrite != nil {
+		u = mc.rewrite(u)
+	}
+	u = strings.ReplaceAll(u, " ", "%20")
+	return strings.NewReplacer("(", "%28", ")", "%29").Replace(u)
+}
+
+func markdownTitle(title string) string {
+	if title == "" {
+		return ""
+	}
+	return ` "` + strings.ReplaceAll(title, `"`, `\"`) + `"`
+}
+
+// wrapInline wraps text in emphasis markers, keeping surrounding spaces
+// outside of them, as Markdown requires
+func wrapInline(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	return fmt.Sprintf("%s%s%s%s%s", leadingSpace(text), marker, trimmed, marker, trailingSpace(text))
+}
+
+func leadingSpace(s string) string {
+	if startsWithSpace(s) {
+		return " "
+	}
+	return ""
+}
+
+func trailingSpace(s string) string {
+	if endsWithSpace(s) {
+		return " "
+	}
+	return ""
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.TrimLeft(s[:1], " \t\r\n") == ""
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.TrimRight(s[len(s)-1:], " \t\r\n") == ""
+}
+
+// escapeBlockStart escapes the start of a paragraph that would otherwise be
+// read as other Markdown markup
+func escapeBlockStart(text string) string {
+	if markdownOrderedStart.MatchString(text) {
+		return markdownOrderedStart.ReplaceAllString(text, `$1\. `)
+	}
+	if markdownBlockStart.MatchString(text) {
+		return `\` + text
+	}
+	return text
+}
+
+// collapseLines joins the lines of a block into one
+func collapseLines(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// prefixLines prefixes every line of s, using emptyPrefix for empty lines
+func prefixLines(s, prefix, emptyPrefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = emptyPrefix
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func childNodes(n *html.Node) []*html.Node {
+	var nodes []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		nodes = append(nodes, c)
+	}
+	return nodes
+}
+
+func attrValue(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// textContent returns the text of a node and its descendants, as is
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// hugoSource reads the content folder of a Hugo site
+type hugoSource struct {
+	dir      string
+	sections []string // sections whose content are posts
+
+	config     frontMatter
+	contentDir string
+	staticDir  string
+	files      map[string]*importedItem // content files relative to contentDir, for ref
+	paths      map[*importedItem]string // content files of the items
+	bundles    map[*importedItem]string // folders of page bundles
+}
+
+// hugoConfigFiles are the names of the site configuration, in the order Hugo looks for them
+var hugoConfigFiles = []string{"hugo.toml", "hugo.yaml", "hugo.yml", "hugo.json", "config.toml", "config.yaml", "config.yml", "config.json"}
+
+// hugoShortcode matches a shortcode, {{< name params >}} or {{% name params %}}
+var hugoShortcode = regexp.MustCompile(`(?s)\{\{([<%])-?\s*(/?)(\w[\w/.-]*)(.*?)\s*-?[>%]\}\}`)
+
+// hugoEscapedShortcode matches a shortcode written out as text, {{</* name */>}}
+var hugoEscapedShortcode = regexp.MustCompile(`(?s)\{\{([<%])/\*(.*?)\*/([>%])\}\}`)
+
+// hugoParam matches a named shortcode parameter, or a positional one
+var hugoParam = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|'([^']*)'|(\S+))|"([^"]*)"|(\S+)`)
+
+// isHugoContent reports whether a file is a content file Hugo renders
+func isHugoContent(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown", ".html", ".htm":
+		return true
+	}
+	return false
+}
+
+// parseHugoFrontMatter splits a content file into its YAML, TOML or JSON
+// front matter and body. Keys are lowercased, as Hugo matches them without case.
+func parseHugoFrontMatter(content string) (frontMatter, string, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	fm := frontMatter{}
+	body := content
+	switch {
+	case strings.HasPrefix(content, "---"):
+		var err error
+		if fm, body, _, err = splitYAMLFrontMatter(content); err != nil {
+			return nil, "", err
+		}
+	case strings.HasPrefix(content, "+++"):
+		end := regexp.MustCompile(`(?m)^\+\+\+\s*$`).FindAllStringIndex(content, 2)
+		if len(end) < 2 {
+			return nil, "", errors.New("front matter is not closed with +++")
+		}
+		if err := toml.Unmarshal([]byte(content[end[0][1]:end[1][0]]), &fm); err != nil {
+			return nil, "", err
+		}
+		body = strings.TrimLeft(content[end[1][1]:], "\r\n")
+	case strings.HasPrefix(content, "{"):
+		dec := json.NewDecoder(strings.NewReader(content))
+		if err := dec.Decode(&fm); err != nil {
+			return nil, "", err
+		}
+		body = strings.TrimLeft(content[dec.InputOffset():], "\r\n")
+	}
+	lowered := frontMatter{}
+	for key, value := range fm {
+		lowered[strings.ToLower(key)] = value
+	}
+	return lowered, body, nil
+}
+
+// readConfig reads the site configuration, if there is one
+func (hs *hugoSource) readConfig() error {
+	hs.config = frontMatter{}
+	for _, name := range hugoConfigFiles {
+		data, err := ioutil.ReadFile(filepath.Join(hs.dir, name))
+		if err != nil {
+			continue
+		}
+		var config map[string]interface{}
+		switch filepath.Ext(name) {
+		case ".toml":
+			err = toml.Unmarshal(data, &config)
+		case ".json":
+			err = json.Unmarshal(data, &config)
+		default:
+			err = yaml.Unmarshal(data, &config)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		for key, value := range config {
+			hs.config[strings.ToLower(key)] = value
+		}
+		break
+	}
+	hs.contentDir = filepath.Join(hs.dir, "content")
+	if dir := hs.config.string("contentdir"); dir != "" {
+		hs.contentDir = filepath.Join(hs.dir, dir)
+	}
+	hs.staticDir = filepath.Join(hs.dir, "static")
+	if dir := hs.config.string("staticdir"); dir != "" {
+		hs.staticDir = filepath.Join(hs.dir, dir)
+	}
+	return nil
+}
+
+// items reads every page of the content folder; list pages (_index files)
+// are left out, as Podium generates its own
+func (hs *hugoSource) items(im *importer) ([]*importedItem, error) {
+	if err := hs.readConfig(); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(hs.contentDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a Hugo site folder, it has no content folder", hs.dir)
+	}
+	postSections := map[string]bool{}
+	for _, section := range hs.sections {
+		postSections[strings.TrimSpace(section)] = true
+	}
+	defaultLang := hs.config.string("defaultcontentlanguage")
+	if defaultLang == "" {
+		defaultLang = "en"
+	}
+	permalinks, _ := hs.config["permalinks"].(map[string]interface{})
+	hs.files = map[string]*importedItem{}
+	hs.paths = map[*importedItem]string{}
+	hs.bundles = map[*importedItem]string{}
+
+	var items []*importedItem
+	err := filepath.Walk(hs.contentDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isHugoContent(info.Name()) {
+			return nil
+		}
+		rel, _ := filepath.Rel(hs.contentDir, file)
+		rel = filepath.ToSlash(rel)
+		base := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+		lang := defaultLang
+		if ext := path.Ext(base); ext != "" {
+			lang, base = ext[1:], strings.TrimSuffix(base, ext)
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fm, body, err := parseHugoFrontMatter(string(data))
+		if err != nil {
+			im.note(rel, "not imported: %v", err)
+			return nil
+		}
+		if base == "_index" {
+			if strings.TrimSpace(body) != "" {
+				im.note(rel, "list page not imported, Podium generates its own")
+			}
+			return nil
+		}
+		if fm.bool("headless", false) {
+			return nil
+		}
+
+		// A page bundle is a folder with an index file and its resources
+		dir := path.Dir(rel)
+		name := base
+		if base == "index" {
+			name = path.Base(dir)
+			dir = path.Dir(dir)
+		}
+		section := strings.Split(rel, "/")[0]
+		if !strings.Contains(rel, "/") {
+			section = ""
+		}
+
+		item := &importedItem{
+			Kind:        "page",
+			Source:      rel,
+			Slug:        name,
+			Title:       fm.string("title"),
+			Draft:       fm.bool("draft", false),
+			Tags:        append(fm.strings("tags"), fm.strings("categories")...),
+			Description: fm.string("description"),
+			Author:      fm.string("author"),
+			Body:        body,
+		}
+		if postSections[section] {
+			item.Kind = "post"
+		}
+		if slug := fm.string("slug"); slug != "" {
+			item.Slug = slug
+		}
+		if item.Title == "" {
+			item.Title = titleFromSlug(name)
+		}
+		if item.Description == "" {
+			item.Description = fm.string("summary")
+		}
+		if authors := fm.strings("authors"); item.Author == "" && len(authors) > 0 {
+			item.Author = authors[0]
+		}
+		if images := fm.strings("images"); len(images) > 0 {
+			item.Image = images[0]
+		}
+		for _, key := range []string{"image", "featured_image", "cover"} {
+			if item.Image == "" {
+				item.Image = fm.string(key)
+			}
+		}
+		item.Date = fm.time("date")
+		if publish := fm.time("publishdate"); !publish.IsZero() && (item.Date.IsZero() || publish.After(item.Date)) {
+			item.Date = publish
+		}
+		item.Updated = fm.time("lastmod")
+		if !fm.time("expirydate").IsZero() {
+			im.note(rel, "expiryDate %s is not supported, the post stays published", fm.string("expirydate"))
+		}
+		if isLanguage(lang) {
+			item.Lang = lang
+		} else if lang != defaultLang {
+			im.note(rel, "language %q is not configured in Podium, imported in the default language", lang)
+		}
+
+		oldURL := fm.string("url")
+		if oldURL == "" {
+			if pattern, ok := permalinks[section].(string); ok && section != "" {
+				oldURL = hs.permalink(pattern, item, section, name, fm)
+			} else if dir == "." {
+				oldURL = "/" + item.Slug + "/"
+			} else {
+				oldURL = "/" + dir + "/" + item.Slug + "/"
+			}
+			if lang != defaultLang {
+				oldURL = "/" + lang + oldURL
+			}
+		}
+		item.Aliases = append(item.Aliases, oldURL)
+		for _, alias := range fm.strings("aliases") {
+			if !strings.HasPrefix(alias, "/") {
+				alias = path.Join(path.Dir(strings.TrimSuffix(oldURL, "/")), alias)
+			}
+			item.Aliases = append(item.Aliases, alias)
+		}
+
+		if base == "index" {
+			hs.bundles[item] = filepath.Dir(file)
+		}
+		hs.files[rel] = item
+		hs.paths[item] = file
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+// permalink expands a permalink pattern of the site configuration
+func (hs *hugoSource) permalink(pattern string, item *importedItem, section, name string, fm frontMatter) string {
+	d := item.Date
+	slug := fm.string("slug")
+	if slug == "" {
+		slug = slugify(item.Title)
+	}
+	link := strings.NewReplacer(
+		":year", d.Format("2006"),
+		":month", d.Format("01"),
+		":monthname", strings.ToLower(d.Format("January")),
+		":day", d.Format("02"),
+		":weekdayname", strings.ToLower(d.Format("Monday")),
+		":yearday", fmt.Sprint(d.YearDay()),
+		":section", section,
+		":sections", section,
+		":title", slugify(item.Title),
+		":slug", slug,
+		":contentbasename", name,
+		":filename", name,
+	).Replace(pattern)
+	return regexp.MustCompile(`/{2,}`).ReplaceAllString("/"+link, "/")
+}
+
+// convert converts the shortcodes of a post or page that have Markdown
+// equivalents, and HTML bodies to Markdown
+func (hs *hugoSource) convert(im *importer, item *importedItem) string {
+	file := hs.paths[item]
+	if item.Image != "" {
+		item.Image = hs.rewrite(im, item, item.Image)
+	}
+
+	// Shortcodes written out as text are set aside, so they stay as they are
+	var escaped []string
+	body := hugoEscapedShortcode.ReplaceAllStringFunc(item.Body, func(code string) string {
+		m := hugoEscapedShortcode.FindStringSubmatch(code)
+		escaped = append(escaped, "{{"+m[1]+m[2]+m[3]+"}}")
+		return fmt.Sprintf("\x00shortcode%d\x00", len(escaped)-1)
+	})
+	reported := map[string]bool{}
+	body = hugoShortcode.ReplaceAllStringFunc(body, func(code string) string {
+		m := hugoShortcode.FindStringSubmatch(code)
+		closing, name := m[2] == "/", m[3]
+		named, positional := hugoParams(m[4])
+		arg := func(key string, pos int) string {
+			if v, ok := named[key]; ok {
+				return v
+			}
+			if pos < len(positional) {
+				return positional[pos]
+			}
+			return ""
+		}
+		switch {
+		case name == "highlight" && closing:
+			return "```"
+		case name == "highlight":
+			return "```" + arg("lang", 0)
+		case name == "figure" && !closing:
+			alt := named["alt"]
+			if alt == "" {
+				alt = named["caption"]
+			}
+			figure := "![" + alt + "](" + named["src"]
+			if title := named["title"]; title != "" {
+				figure += ` "` + strings.ReplaceAll(title, `"`, `'`) + `"`
+			}
+			figure += ")"
+			if caption := named["caption"]; caption != "" {
+				figure += "\n\n*" + caption + "*"
+			}
+			return figure
+		case name == "ref" || name == "relref":
+			if target := hs.lookup(arg("path", 0)); target != nil {
+				return langPrefix(target.Lang) + map[string]string{"post": "/posts/", "page": "/page/"}[target.Kind] + target.Slug
+			}
+			im.note(item.file, "%s points to nothing that was imported", code)
+			return code
+		case name == "youtube" && !closing:
+			return "https://www.youtube.com/watch?v=" + arg("id", 0)
+		case name == "vimeo" && !closing:
+			return "https://vimeo.com/" + arg("id", 0)
+		}
+		if !closing && !reported[name] {
+			reported[name] = true
+			im.note(item.file, "shortcode %s left as text", name)
+		}
+		return code
+	})
+	for i, code := range escaped {
+		body = strings.Replace(body, fmt.Sprintf("\x00shortcode%d\x00", i), code, 1)
+	}
+
+	rewrite := func(u string) string { return hs.rewrite(im, item, u) }
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".html", ".htm":
+		return im.convertHTML(item, body, rewrite)
+	}
+	return rewriteMarkdownURLs(body, rewrite)
+}
+
+// hugoParams splits the parameters of a shortcode into named and positional ones
+func hugoParams(params string) (map[string]string, []string) {
+	named := map[string]string{}
+	var positional []string
+	for _, m := range hugoParam.FindAllStringSubmatch(params, -1) {
+		if m[1] != "" {
+			named[m[1]] = m[2] + m[3] + m[4]
+		} else {
+			positional = append(positional, m[5]+m[6])
+		}
+	}
+	return named, positional
+}
+
+// lookup finds the item of a ref shortcode path, which may leave out the
+// extension, the section or the index file of a bundle
+func (hs *hugoSource) lookup(ref string) *importedItem {
+	ref = strings.TrimPrefix(strings.SplitN(ref, "#", 2)[0], "/")
+	ref = strings.TrimSuffix(ref, "/")
+	var found *importedItem
+	for rel, item := range hs.files {
+		trimmed := strings.TrimSuffix(rel, path.Ext(rel))
+		trimmed = strings.TrimSuffix(trimmed, "/index")
+		if rel == ref || trimmed == ref || trimmed == strings.TrimSuffix(ref, path.Ext(ref)) {
+			return item
+		}
+		if path.Base(trimmed) == strings.TrimSuffix(ref, path.Ext(ref)) {
+			found = item
+		}
+	}
+	return found
+}
+
+// rewrite points a link at the new URL of the post or page it links to, or
+// copies the file it links to, from the page bundle or the static folder,
+// into assets/media
+func (hs *hugoSource) rewrite(im *importer, item *importedItem, raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Path == "" {
+		return raw
+	}
+	if isExternalURL(u) {
+		site, _ := url.Parse(hs.config.string("baseurl"))
+		if site == nil || site.Host == "" || u.Host != site.Host {
+			return raw
+		}
+	}
+	p := u.Path
+	if strings.HasPrefix(p, "/") {
+		if newPath, ok := im.movedPath(p); ok {
+			if u.Fragment != "" {
+				newPath += "#" + u.Fragment
+			}
+			return newPath
+		}
+		local := filepath.Join(hs.staticDir, filepath.FromSlash(p))
+		rel, ok := im.insideFolder(item.file, hs.staticDir, local, raw)
+		if !ok {
+			return raw
+		}
+		if sitePath, ok := im.localMedia(item.file, local, filepath.ToSlash(rel)); ok {
+			return sitePath
+		}
+		if !isExternalURL(u) {
+			im.note(item.file, "link to %s was not mapped", raw)
+		}
+		return raw
+	}
+	if bundle, ok := hs.bundles[item]; ok {
+		local := filepath.Join(bundle, filepath.FromSlash(p))
+		rel, ok := im.insideFolder(item.file, bundle, local, raw)
+		if !ok {
+			return raw
+		}
+		if sitePath, ok := im.localMedia(item.file, local, item.Slug+"/"+filepath.ToSlash(rel)); ok {
+			return sitePath
+		}
+	}
+	return raw
+}
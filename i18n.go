@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// LanguageConfig describes one language the site is published in
+type LanguageConfig struct {
+	Code            string `yaml:"code"`
+	Name            string `yaml:"name"`
+	Locale          string `yaml:"locale"`
+	SiteTitle       string `yaml:"site_title"`
+	SiteDescription string `yaml:"site_description"`
+	HomeIntro       string `yaml:"home_intro"`
+}
+
+// LanguageLink is one entry of the language switcher and the hreflang alternates
+type LanguageLink struct {
+	Code      string
+	Name      string
+	URL       string
+	AbsURL    string
+	Current   bool
+	Available bool
+}
+
+// Translated UI strings, keyed by language code and then by string key
+var (
+	i18nMu      sync.RWMutex
+	i18nStrings = map[string]map[string]string{}
+)
+
+// loadI18nStrings reads one <lang>.yaml string file per configured language
+func loadI18nStrings(folder string) (map[string]map[string]string, error) {
+	strs := map[string]map[string]string{}
+	for _, l := range appConfig.Languages {
+		data, err := ioutil.ReadFile(filepath.Join(folder, l.Code+".yaml"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values := map[string]string{}
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("%s.yaml: %v", l.Code, err)
+		}
+		strs[l.Code] = values
+	}
+	return strs, nil
+}
+
+// reloadI18n (re)loads the string files from the configured i18n folder
+func reloadI18n() {
+	strs, err := loadI18nStrings(appConfig.I18nFolder)
+	if err != nil {
+		log.Printf("Warning: Failed to load i18n strings: %v", err)
+		return
+	}
+	i18nMu.Lock()
+	i18nStrings = strs
+	i18nMu.Unlock()
+}
+
+// translate looks up a UI string for a language, falling back to the default
+// language and finally to the key itself. Extra arguments are applied with
+// fmt.Sprintf. It is exposed to templates as the "i18n" function.
+func translate(lang, key string, args ...interface{}) string {
+	i18nMu.RLock()
+	value, ok := i18nStrings[lang][key]
+	if !ok {
+		value, ok = i18nStrings[defaultLanguage()][key]
+	}
+	i18nMu.RUnlock()
+	if !ok {
+		value = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(value, args...)
+	}
+	return value
+}
+
+// defaultLanguage returns the code of the language served without a URL prefix
+func defaultLanguage() string {
+	if appConfig.DefaultLanguage != "" {
+		return appConfig.DefaultLanguage
+	}
+	if len(appConfig.Languages) > 0 {
+		return appConfig.Languages[0].Code
+	}
+	return "en"
+}
+
+// isLanguage reports whether code is one of the configured languages
+func isLanguage(code string) bool {
+	for _, l := range appConfig.Languages {
+		if l.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// languageConfig returns the configuration of a language with site-wide fallbacks
+func languageConfig(code string) LanguageConfig {
+	lang := LanguageConfig{Code: code, Name: code}
+	for _, l := range appConfig.Languages {
+		if l.Code == code {
+			lang = l
+			break
+		}
+	}
+	if lang.Locale == "" {
+		lang.Locale = code
+	}
+	if lang.SiteTitle == "" {
+		lang.SiteTitle = appConfig.SiteTitle
+	}
+	if lang.SiteDescription == "" {
+		lang.SiteDescription = appConfig.SiteDescription
+	}
+	if lang.HomeIntro == "" {
+		lang.HomeIntro = appConfig.HomeIntro
+	}
+	return lang
+}
+
+// langPrefix returns the URL prefix of a language ("" for the default language)
+func langPrefix(lang string) string {
+	if lang == "" || lang == defaultLanguage() {
+		return ""
+	}
+	return "/" + lang
+}
+
+// langFileSlug returns the file name (without .md) holding a slug in a language,
+// e.g. "first-post" for the default language and "first-post.nb" for Norwegian
+func langFileSlug(slug, lang string) string {
+	if lang == "" || lang == defaultLanguage() {
+		return slug
+	}
+	return slug + "." + lang
+}
+
+// splitLangSlug splits a file name (without .md) into its slug and language
+func splitLangSlug(name string) (string, string) {
+	if i := strings.LastIndex(name, "."); i > 0 {
+		if code := name[i+1:]; code != defaultLanguage() && isLanguage(code) {
+			return name[:i], code
+		}
+	}
+	return name, defaultLanguage()
+}
+
+// translationExists reports whether a slug has a markdown file in a language
+func translationExists(folder, slug, lang string) bool {
+	_, err := os.Stat(filepath.Join(folder, langFileSlug(slug, lang)+".md"))
+	return err == nil
+}
+
+// requestLang determines the language of a request from its URL prefix
+func requestLang(c *gin.Context) string {
+	path := c.Request.URL.Path
+	for _, l := range appConfig.Languages {
+		if l.Code == defaultLanguage() {
+			continue
+		}
+		if path == "/"+l.Code || strings.HasPrefix(path, "/"+l.Code+"/") {
+			return l.Code
+		}
+	}
+	return defaultLanguage()
+}
+
+// languageLinks builds the language switcher for a path relative to the
+// language prefix. Languages for which exists returns false link to their home
+// page and are left out of the hreflang alternates.
+func languageLinks(current, path string, exists func(lang string) bool) []LanguageLink {
+	var links []LanguageLink
+	for _, l := range appConfig.Languages {
+		available := exists == nil || exists(l.Code)
+		url := langPrefix(l.Code) + path
+		if !available {
+			url = langPrefix(l.Code) + "/"
+		}
+		links = append(links, LanguageLink{
+			Code:      l.Code,
+			Name:      l.Name,
+			URL:       url,
+			AbsURL:    appConfig.SiteURL + url,
+			Current:   l.Code == current,
+			Available: available,
+		})
+	}
+	return links
+}
+
+// requestPath returns the request path with the language prefix removed
+func requestPath(c *gin.Context, lang string) string {
+	path := strings.TrimPrefix(c.Request.URL.Path, langPrefix(lang))
+	if path == "" {
+		path = "/"
+	}
+	return path
+}
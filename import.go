@@ -0,0 +1,533 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// importedItem is a post or page read from another blog engine
+type importedItem struct {
+	Kind        string // "post" or "page"
+	Source      string // where it was read from, for the report
+	Slug        string
+	Lang        string
+	Title       string
+	Date        time.Time
+	Updated     time.Time
+	Draft       bool
+	Tags        []string
+	Description string
+	Image       string
+	Author      string
+	Aliases     []string // old URLs, redirected to the new one
+	Body        string   // as it is in the source until converted
+
+	file string // the Markdown file it is written to
+}
+
+// importSource reads the posts and pages of a blog engine
+type importSource interface {
+	// items reads the posts and pages, with their bodies as they are in the source
+	items(im *importer) ([]*importedItem, error)
+	// convert returns the body of an item as Podium Markdown. It runs once every
+	// item has its new URL, so links between them can be rewritten.
+	convert(im *importer, item *importedItem) string
+}
+
+// importer turns imported items into Podium Markdown files, stores their
+// media in assets/media and notes everything it couldn't convert
+type importer struct {
+	media   bool              // copy or download media, instead of keeping the old URLs
+	moved   map[string]string // old URLs (normalized as aliases) and new paths -> new paths
+	stored  map[string]string // media sources -> site paths
+	client  *http.Client
+	notes   []importNote
+	posts   int
+	pages   int
+	files   int
+	skipped int
+}
+
+// importNote is a line of the import report
+type importNote struct {
+	Item    string
+	Message string
+}
+
+// importMediaFolder is where imported media files are stored
+const importMediaFolder = "assets/media"
+
+// runImportCommand imports posts and pages from WordPress, Jekyll or Hugo
+func runImportCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	media := fs.Bool("media", true, "Copy or download images and other media into "+importMediaFolder)
+	report := fs.String("report", "import-report.txt", "File to write the import report to")
+	sections := fs.String("sections", "posts,post,blog", "Hugo sections that hold posts; other content becomes pages")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: podium import wordpress [flags] <export.xml>")
+		fmt.Fprintln(os.Stderr, "       podium import jekyll [flags] <site folder>")
+		fmt.Fprintln(os.Stderr, "       podium import hugo [flags] <site folder>")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("import needs a source: wordpress, jekyll or hugo")
+	}
+	kind := args[0]
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("import %s needs a file or folder to import", kind)
+	}
+	from := fs.Arg(0)
+
+	var source importSource
+	switch kind {
+	case "wordpress":
+		source = &wordpressSource{file: from}
+	case "jekyll":
+		source = &jekyllSource{dir: from}
+	case "hugo":
+		source = &hugoSource{dir: from, sections: strings.Split(*sections, ",")}
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown source %q, use wordpress, jekyll or hugo", kind)
+	}
+
+	im := &importer{
+		media:  *media,
+		moved:  map[string]string{},
+		stored: map[string]string{},
+		client: &http.Client{Timeout: time.Minute},
+	}
+	items, err := source.items(im)
+	if err != nil {
+		return err
+	}
+	im.assignFiles(items)
+	for _, item := range items {
+		item.Body = source.convert(im, item)
+		im.write(item)
+	}
+
+	if err := im.writeReport(*report, kind+" "+from); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d posts and %d pages with %d media files, skipped %d\n", im.posts, im.pages, im.files, im.skipped)
+	fmt.Printf("%d notes on what couldn't be converted are in %s\n", len(im.notes), *report)
+	return nil
+}
+
+// note adds a line to the report
+func (im *importer) note(item, format string, args ...interface{}) {
+	im.notes = append(im.notes, importNote{Item: item, Message: fmt.Sprintf(format, args...)})
+}
+
+// assignFiles gives every item a unique slug and file name and records where
+// its old URLs moved to
+func (im *importer) assignFiles(items []*importedItem) {
+	used := map[string]bool{}
+	for _, item := range items {
+		if item.Lang == "" {
+			item.Lang = defaultLanguage()
+		}
+		slug := slugify(item.Slug)
+		if slug == "" {
+			slug = slugify(item.Title)
+		}
+		if slug == "" {
+			slug = item.Kind
+		}
+		folder, route := "posts", "/posts/"
+		if item.Kind == "page" {
+			folder, route = "static", "/page/"
+		}
+		item.Slug = slug
+		for n := 2; used[folder+"/"+langFileSlug(item.Slug, item.Lang)]; n++ {
+			item.Slug = fmt.Sprintf("%s-%d", slug, n)
+		}
+		used[folder+"/"+langFileSlug(item.Slug, item.Lang)] = true
+		item.file = filepath.Join(folder, langFileSlug(item.Slug, item.Lang)+".md")
+
+		newPath := langPrefix(item.Lang) + route + item.Slug
+		im.moved[newPath] = newPath
+		var aliases []string
+		for _, alias := range item.Aliases {
+			if normalized := normalizeAlias(alias); normalized != "/" && normalized != newPath {
+				im.moved[normalized] = newPath
+				aliases = append(aliases, normalized)
+			}
+		}
+		item.Aliases = aliases
+	}
+}
+
+// movedPath returns the new path of an old (or already new) URL of an imported item
+func (im *importer) movedPath(oldPath string) (string, bool) {
+	newPath, ok := im.moved[normalizeAlias(oldPath)]
+	return newPath, ok
+}
+
+// write writes an item as a Podium Markdown file, leaving existing files alone
+func (im *importer) write(item *importedItem) {
+	title := strings.TrimSpace(item.Title)
+	if title == "" {
+		title = "Untitled"
+		im.note(item.file, "has no title, it is called %q", title)
+	}
+
+	var b strings.Builder
+	field := func(key, value string) {
+		if value = strings.Join(strings.Fields(value), " "); value != "" {
+			b.WriteString(key + ": " + value + "\n")
+		}
+	}
+	if item.Kind == "post" {
+		var tags []string
+		for _, tag := range item.Tags {
+			if tag = strings.TrimSpace(strings.ReplaceAll(tag, ",", " ")); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		field("Tags", strings.Join(tags, ", "))
+		if !item.Date.IsZero() {
+			field("Date", item.Date.Format("2006-01-02"))
+			if !item.Draft && item.Date.After(time.Now()) {
+				field("PublishDate", item.Date.Format("2006-01-02 15:04"))
+			}
+		}
+		if !item.Updated.IsZero() && item.Updated.Format("2006-01-02") > item.Date.Format("2006-01-02") {
+			field("Updated", item.Updated.Format("2006-01-02"))
+		}
+		if item.Author != appConfig.SiteAuthor {
+			field("Author", item.Author)
+		}
+	}
+	field("Description", item.Description)
+	field("Image", item.Image)
+	field("Aliases", strings.Join(item.Aliases, ", "))
+	if item.Draft {
+		field("Draft", "true")
+	}
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString("# " + title + "\n\n")
+	b.WriteString(strings.TrimSpace(item.Body) + "\n")
+
+	if err := writeNewFile(item.file, []byte(b.String())); err != nil {
+		im.skipped++
+		im.note(item.Source, "not imported: %v", err)
+		return
+	}
+	if item.Kind == "post" {
+		im.posts++
+	} else {
+		im.pages++
+	}
+}
+
+// storeMedia copies or downloads a media file into assets/media/<name> once,
+// and returns its path on the site, or "" when it couldn't be stored
+func (im *importer) storeMedia(item, source, name string, read func() ([]byte, error)) string {
+	if !im.media {
+		return ""
+	}
+	if sitePath, ok := im.stored[source]; ok {
+		return sitePath
+	}
+	data, err := read()
+	if err != nil {
+		im.note(item, "media %s was not imported: %v", source, err)
+		im.stored[source] = ""
+		return ""
+	}
+
+	// Keep the folders of the name, but nothing that climbs out of assets/media
+	var parts []string
+	for _, part := range strings.Split(path.Clean("/"+name), "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		parts = []string{"file"}
+	}
+	name = path.Join(parts...)
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 2; ; n++ {
+		file := filepath.Join(importMediaFolder, filepath.FromSlash(name))
+		existing, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			if err := writeNewFile(file, data); err != nil {
+				im.note(item, "media %s was not imported: %v", source, err)
+				return ""
+			}
+			im.files++
+			break
+		}
+		if err == nil && string(existing) == string(data) {
+			break
+		}
+		name = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	sitePath := "/" + importMediaFolder + "/" + name
+	im.stored[source] = sitePath
+	return sitePath
+}
+
+// downloadMedia downloads a media file
+func (im *importer) downloadMedia(item, rawURL, name string) string {
+	return im.storeMedia(item, rawURL, name, func() ([]byte, error) {
+		resp, err := im.client.Get(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s", resp.Status)
+		}
+		return readLimited(resp.Body, 100<<20)
+	})
+}
+
+// copyMedia copies a local media file
+func (im *importer) copyMedia(item, file, name string) string {
+	return im.storeMedia(item, file, name, func() ([]byte, error) {
+		return ioutil.ReadFile(file)
+	})
+}
+
+// writeReport writes what was imported and every note
+func (im *importer) writeReport(file, source string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Podium import report\n\n")
+	fmt.Fprintf(&b, "Source:   %s\n", source)
+	fmt.Fprintf(&b, "Date:     %s\n", time.Now().Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "Imported: %d posts, %d pages, %d media files\n", im.posts, im.pages, im.files)
+	fmt.Fprintf(&b, "Skipped:  %d\n\n", im.skipped)
+	if len(im.notes) == 0 {
+		b.WriteString("Everything was converted.\n")
+	} else {
+		b.WriteString("Not converted, check these by hand:\n\n")
+		sort.SliceStable(im.notes, func(i, j int) bool { return im.notes[i].Item < im.notes[j].Item })
+		for _, n := range im.notes {
+			fmt.Fprintf(&b, "%s: %s\n", n.Item, n.Message)
+		}
+	}
+	return ioutil.WriteFile(file, []byte(b.String()), 0644)
+}
+
+// markdownLinkPattern matches the URL of a Markdown link or image, and
+// markdownRefPattern the URL of a reference definition
+var (
+	markdownLinkPattern = regexp.MustCompile(`(\]\(\s*)(<[^>]*>|[^)\s]+)`)
+	markdownRefPattern  = regexp.MustCompile(`(?m)^( {0,3}\[[^\]]+\]:\s*)(\S+)`)
+	htmlURLPattern      = regexp.MustCompile(`((?:src|href|poster)\s*=\s*")([^"]*)`)
+)
+
+// rewriteMarkdownURLs maps the URLs of the links and images of a Markdown
+// document, including those in inline HTML
+func rewriteMarkdownURLs(body string, rewrite func(string) string) string {
+	replace := func(pattern *regexp.Regexp) {
+		body = pattern.ReplaceAllStringFunc(body, func(match string) string {
+			m := pattern.FindStringSubmatch(match)
+			u := strings.TrimSuffix(strings.TrimPrefix(m[2], "<"), ">")
+			return m[1] + rewrite(u)
+		})
+	}
+	replace(markdownLinkPattern)
+	replace(markdownRefPattern)
+	replace(htmlURLPattern)
+	return body
+}
+
+// frontMatter is the YAML, TOML or JSON front matter of a Jekyll or Hugo file
+type frontMatter map[string]interface{}
+
+// splitYAMLFrontMatter splits a file into its YAML front matter (between
+// "---" lines) and body, reporting whether it had front matter
+func splitYAMLFrontMatter(content string) (frontMatter, string, bool, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	if !strings.HasPrefix(content, "---") {
+		return frontMatter{}, content, false, nil
+	}
+	rest := strings.TrimLeft(content[3:], " \t")
+	if !strings.HasPrefix(rest, "\n") && !strings.HasPrefix(rest, "\r\n") {
+		return frontMatter{}, content, false, nil
+	}
+	end := regexp.MustCompile(`(?m)^---\s*$`).FindStringIndex(rest)
+	if end == nil {
+		return nil, "", true, errors.New("front matter is not closed with ---")
+	}
+	fm := frontMatter{}
+	if err := yaml.Unmarshal([]byte(rest[:end[0]]), &fm); err != nil {
+		return nil, "", true, err
+	}
+	return fm, strings.TrimLeft(rest[end[1]:], "\r\n"), true, nil
+}
+
+// string returns a front matter value as a string
+func (fm frontMatter) string(key string) string {
+	switch v := fm[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case map[string]interface{}:
+		// e.g. image: {path: ...} or author: {name: ...}
+		for _, k := range []string{"path", "src", "url", "name"} {
+			if s, ok := v[k].(string); ok {
+				return s
+			}
+		}
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// strings returns a front matter list, or a string split at spaces (or at
+// commas, when it has any)
+func (fm frontMatter) strings(key string) []string {
+	var values []string
+	switch v := fm[key].(type) {
+	case []interface{}:
+		for _, value := range v {
+			if s := strings.TrimSpace(fmt.Sprint(value)); s != "" {
+				values = append(values, s)
+			}
+		}
+	case string:
+		sep := " "
+		if strings.Contains(v, ",") {
+			sep = ","
+		}
+		for _, value := range strings.Split(v, sep) {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// bool returns a front matter boolean, or def when it isn't set
+func (fm frontMatter) bool(key string, def bool) bool {
+	switch v := fm[key].(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return def
+}
+
+// time returns a front matter date, in any of the formats blog engines write
+func (fm frontMatter) time(key string) time.Time {
+	switch v := fm[key].(type) {
+	case time.Time:
+		return v
+	case string:
+		return parseImportedTime(v)
+	case nil:
+		return time.Time{}
+	default:
+		// TOML local dates and times
+		return parseImportedTime(fmt.Sprint(v))
+	}
+}
+
+// parseImportedTime parses a date in the formats of WordPress, Jekyll and Hugo
+func parseImportedTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02 15:04:05 -07:00",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04 -0700",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// localMedia copies a file of a Jekyll or Hugo site that a post links to,
+// when it exists and isn't content, and returns its new path
+func (im *importer) localMedia(item, file, name string) (string, bool) {
+	info, err := os.Stat(file)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".md", ".markdown", ".html", ".htm":
+		return "", false
+	}
+	if sitePath := im.copyMedia(item, file, name); sitePath != "" {
+		return sitePath, true
+	}
+	return "", false
+}
+
+// insideFolder returns the path of a linked file relative to the folder it
+// must stay in. Links that climb out of it (../../.ssh/id_rsa) are refused
+// and noted, so nothing outside the imported site is ever published.
+func (im *importer) insideFolder(item, dir, file, link string) (string, bool) {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		im.note(item, "link to %s points outside the site folder, not imported", link)
+		return "", false
+	}
+	return rel, true
+}
+
+// isExternalURL reports whether a link points to another site
+func isExternalURL(u *url.URL) bool {
+	return u.Scheme != "" || u.Host != ""
+}
+
+// convertHTML converts an HTML body to Markdown, noting the elements it kept
+// as HTML
+func (im *importer) convertHTML(item *importedItem, body string, rewrite func(string) string) string {
+	mc := &markdownConverter{rewrite: rewrite}
+	markdown, err := mc.htmlToMarkdown(body)
+	if err != nil {
+		im.note(item.file, "body kept as HTML: %v", err)
+		return body
+	}
+	for _, tag := range mc.keptTags() {
+		im.note(item.file, "<%s> kept as HTML", tag)
+	}
+	return markdown
+}
+
+// titleFromSlug makes a title of a file name, for content without one
+func titleFromSlug(slug string) string {
+	words := strings.FieldsFunc(slug, func(r rune) bool { return r == '-' || r == '_' })
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// buildManifestName is the file in the output folder that records what the
+// last build rendered and from which inputs
+const buildManifestName = ".podium-build.json"
+
+// buildManifest records the inputs of every output of a build, so the next
+// build can skip outputs whose inputs are unchanged and delete the outputs
+// that no longer exist
+type buildManifest struct {
+	Inputs  map[string]string      `json:"inputs"`  // input key -> content hash
+	Outputs map[string]buildOutput `json:"outputs"` // file (relative to the output folder) -> output
+}
+
+type buildOutput struct {
+	URL  string   `json:"url"`
+	Deps []string `json:"deps"`
+}
+
+// buildConfigGroups are the config keys each kind of output depends on.
+// HTML pages depend on every key except htmlIgnoredConfig.
+var buildConfigGroups = map[string][]string{
+	"feed":    {"site_title", "site_description", "site_author", "site_author_url", "site_url", "languages", "default_language", "feed_items", "feed_full_content"},
+	"sitemap": {"site_url", "languages", "default_language"},
+	"search":  {"site_url", "languages", "default_language", "search_index"},
+	"robots":  {"site_url", "languages", "default_language", "robots"},
+	"og":      {"site_title", "languages", "default_language", "og_image"},
+}
+
+// htmlIgnoredConfig are the config keys no HTML page depends on
+var htmlIgnoredConfig = map[string]bool{
+	"port":              true,
+	"read_timeout":      true,
+	"write_timeout":     true,
+	"idle_timeout":      true,
+	"shutdown_timeout":  true,
+	"feed_items":        true,
+	"feed_full_content": true,
+	"search_index":      true,
+	"robots":            true,
+	"smtp":              true,
+	"cache_folder":      true,
+}
+
+// pageTemplates are the templates that render a whole page; every other
+// template is a partial that all pages may include
+var pageTemplates = map[string]bool{
+	"index.html":  true,
+	"posts.html":  true,
+	"post.html":   true,
+	"page.html":   true,
+	"search.html": true,
+	"error.html":  true,
+}
+
+// buildInputs hashes the inputs outputs depend on, each at most once per build.
+// Keys are:
+//
+//	binary                 the podium executable
+//	file:<path>            a file, e.g. file:assets/style.css
+//	data:<name>            a file in the data folder, e.g. data:comments.json
+//	config:<group>         a group of config keys (see buildConfigGroups, and "html")
+//	year                   the current year, shown in page footers
+//	templates:shared       the partial templates
+//	i18n                   the translated UI strings
+//	nav:<lang>             the static pages listed in the navigation
+//	list:<lang>            the listed posts with their titles, tags, dates and excerpts
+//	tag:<lang>:<tag>       the listed posts with a tag
+//	author:<lang>:<slug>   the listed posts by an author
+//	post:<lang>:<slug>     a post and the languages it is translated into
+//	page:<lang>:<slug>     a static page and the languages it is translated into
+//	content:<lang>         every post and page file of a language with its modification time
+type buildInputs struct {
+	hashes map[string]string
+	config map[string]interface{}
+}
+
+func newBuildInputs() *buildInputs {
+	return &buildInputs{hashes: map[string]string{}}
+}
+
+// hash returns the hash of an input, computing it on first use
+func (in *buildInputs) hash(key string) string {
+	if h, ok := in.hashes[key]; ok {
+		return h
+	}
+	h := in.compute(key)
+	in.hashes[key] = h
+	return h
+}
+
+func (in *buildInputs) compute(key string) string {
+	kind, arg := key, ""
+	if i := strings.Index(key, ":"); i >= 0 {
+		kind, arg = key[:i], key[i+1:]
+	}
+	lang, name := arg, ""
+	if i := strings.Index(arg, ":"); i >= 0 {
+		lang, name = arg[:i], arg[i+1:]
+	}
+
+	switch kind {
+	case "binary":
+		exe, err := os.Executable()
+		if err != nil {
+			return ""
+		}
+		info, err := os.Stat(exe)
+		if err != nil {
+			return ""
+		}
+		return hashValue(info.Size(), info.ModTime().UnixNano())
+	case "year":
+		return hashValue(getCurrentYear())
+	case "file":
+		return hashFile(arg)
+	case "data":
+		return hashFile(filepath.Join(appConfig.DataFolder, arg))
+	case "config":
+		return in.configHash(arg)
+	case "templates":
+		files, _ := filepath.Glob("templates/*.html")
+		var shared []string
+		for _, file := range files {
+			if !pageTemplates[filepath.Base(file)] {
+				shared = append(shared, file+"="+hashFile(file))
+			}
+		}
+		return hashValue(shared)
+	case "i18n":
+		files, _ := filepath.Glob(filepath.Join(appConfig.I18nFolder, "*.yaml"))
+		var strs []string
+		for _, file := range files {
+			strs = append(strs, file+"="+hashFile(file))
+		}
+		return hashValue(strs)
+	case "nav":
+		return hashValue(getStaticPagesForLang(arg))
+	case "list":
+		return hashValue(getBlogPostsForLang(arg))
+	case "tag":
+		var tagged []PageLink
+		for _, post := range getBlogPostsForLang(lang) {
+			for _, tag := range post.Tags {
+				if strings.EqualFold(tag, name) {
+					tagged = append(tagged, post)
+					break
+				}
+			}
+		}
+		return hashValue(tagged)
+	case "author":
+		var posts []PageLink
+		for _, post := range getBlogPostsForLang(lang) {
+			author := post.Author
+			if author == "" {
+				author = appConfig.SiteAuthor
+			}
+			if slugify(author) == name {
+				posts = append(posts, post)
+			}
+		}
+		return hashValue(posts)
+	case "post", "page":
+		folder := "posts"
+		if kind == "page" {
+			folder = "static"
+		}
+		var translations []string
+		for _, l := range appConfig.Languages {
+			if translationExists(folder, name, l.Code) {
+				translations = append(translations, l.Code)
+			}
+		}
+		return hashValue(hashFile(filepath.Join(folder, langFileSlug(name, lang)+".md")), translations)
+	case "content":
+		var files []string
+		for _, folder := range []string{"posts", "static"} {
+			entries, _ := ioutil.ReadDir(folder)
+			for _, entry := range entries {
+				if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".md") {
+					continue
+				}
+				if _, fileLang := splitLangSlug(strings.TrimSuffix(entry.Name(), ".md")); fileLang != arg {
+					continue
+				}
+				file := filepath.Join(folder, entry.Name())
+				files = append(files, fmt.Sprintf("%s=%s@%d", file, hashFile(file), entry.ModTime().UnixNano()))
+			}
+		}
+		return hashValue(files)
+	}
+	return ""
+}
+
+// configHash hashes the config keys of a group
+func (in *buildInputs) configHash(group string) string {
+	if in.config == nil {
+		in.config = map[string]interface{}{}
+		if data, err := yaml.Marshal(appConfig); err == nil {
+			yaml.Unmarshal(data, &in.config)
+		}
+	}
+	var keys []string
+	if group == "html" {
+		for key := range in.config {
+			if !htmlIgnoredConfig[key] {
+				keys = append(keys, key)
+			}
+		}
+	} else {
+		keys = buildConfigGroups[group]
+	}
+	sort.Strings(keys)
+	values := map[string]interface{}{}
+	for _, key := range keys {
+		values[key] = in.config[key]
+	}
+	return hashValue(values)
+}
+
+// hashFile hashes the contents of a file, or returns "" when it doesn't exist
+func hashFile(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// hashValue hashes the JSON encoding of values
+func hashValue(values ...interface{}) string {
+	data, _ := json.Marshal(values)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// loadBuildManifest reads the manifest of the previous build into an output
+// folder, or returns an empty one
+func loadBuildManifest(out string) buildManifest {
+	manifest := buildManifest{Inputs: map[string]string{}, Outputs: map[string]buildOutput{}}
+	data, err := ioutil.ReadFile(filepath.Join(out, buildManifestName))
+	if err != nil {
+		return manifest
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		log.Printf("Warning: ignoring unreadable %s: %v", buildManifestName, err)
+		return buildManifest{Inputs: map[string]string{}, Outputs: map[string]buildOutput{}}
+	}
+	if manifest.Inputs == nil {
+		manifest.Inputs = map[string]string{}
+	}
+	if manifest.Outputs == nil {
+		manifest.Outputs = map[string]buildOutput{}
+	}
+	return manifest
+}
+
+// save writes the manifest to an output folder
+func (m buildManifest) save(out string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(out, buildManifestName), data, 0644)
+}
+
+// upToDate reports whether an output of the previous build can be kept: it
+// was rendered from the same URL, its file still exists and none of its
+// inputs changed
+func (m buildManifest) upToDate(target buildTarget, file string, inputs *buildInputs) bool {
+	prev, ok := m.Outputs[target.File]
+	if !ok || prev.URL != target.URL || len(prev.Deps) != len(target.Deps) {
+		return false
+	}
+	if _, err := os.Stat(file); err != nil {
+		return false
+	}
+	for i, dep := range target.Deps {
+		if prev.Deps[i] != dep {
+			return false
+		}
+		if h, ok := m.Inputs[dep]; !ok || h != inputs.hash(dep) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeOrphans deletes the outputs of the previous build that this build no
+// longer produces, along with the folders they leave empty
+func (b *siteBuilder) removeOrphans(prev buildManifest, current map[string]bool) {
+	for file := range prev.Outputs {
+		if current[file] {
+			continue
+		}
+		path := filepath.Join(b.out, filepath.FromSlash(file))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			b.errs = append(b.errs, err.Error())
+			continue
+		}
+		b.removed++
+		// Remove the folders that are now empty, up to the output folder
+		root := filepath.Clean(b.out)
+		for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+}
+
+// watchBuild rebuilds the site whenever its content, templates, assets,
+// config or data change, until the process is stopped
+func watchBuild(out string, force bool) error {
+	watcher, err := newContentWatcher(appConfig.DataFolder)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	rebuild := func() {
+		started := time.Now()
+		b := &siteBuilder{out: out, force: force}
+		if err := b.build(); err != nil {
+			log.Printf("✗ %v", err)
+			return
+		}
+		log.Printf("✓ %s (%s)", b.summary(), time.Since(started).Round(time.Millisecond))
+		force = false
+	}
+	rebuild()
+
+	log.Printf("Watching for changes - %s is rebuilt on every save", out)
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+				debounce.Reset(500 * time.Millisecond)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Println("Watcher error:", err)
+		case <-debounce.C:
+			reloadSiteConfig()
+			rebuild()
+		}
+	}
+}
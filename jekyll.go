@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// jekyllSource reads the posts, drafts and pages of a Jekyll site folder
+type jekyllSource struct {
+	dir    string
+	config struct {
+		URL       string   `yaml:"url"`
+		BaseURL   string   `yaml:"baseurl"`
+		Permalink string   `yaml:"permalink"`
+		Exclude   []string `yaml:"exclude"`
+	}
+	posts map[string]*importedItem // post file names without extension, for post_url
+	files map[string]*importedItem // content files relative to the site, for link
+	paths map[*importedItem]string // content files of the items
+}
+
+// jekyllPermalinkStyles are the built-in permalink styles of Jekyll
+var jekyllPermalinkStyles = map[string]string{
+	"date":    "/:categories/:year/:month/:day/:title:output_ext",
+	"pretty":  "/:categories/:year/:month/:day/:title/",
+	"ordinal": "/:categories/:year/:y_day/:title:output_ext",
+	"none":    "/:categories/:title:output_ext",
+}
+
+// jekyllPostName matches the name of a post file, e.g. 2019-05-01-hello-world.md
+var jekyllPostName = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+
+// Liquid tags the importer converts, and any others, which it reports
+var (
+	liquidRaw       = regexp.MustCompile(`(?s)\{%-?\s*raw\s*-?%\}(.*?)\{%-?\s*endraw\s*-?%\}`)
+	liquidHighlight = regexp.MustCompile(`\{%-?\s*highlight\s+(\w+)[^%]*-?%\}`)
+	liquidEndHigh   = regexp.MustCompile(`\{%-?\s*endhighlight\s*-?%\}`)
+	liquidSiteURL   = regexp.MustCompile(`\{\{-?\s*site\.(baseurl|url)\s*-?\}\}`)
+	liquidLink      = regexp.MustCompile(`\{%-?\s*(post_url|link)\s+(\S+)\s*-?%\}`)
+	liquidAny       = regexp.MustCompile(`\{%-?\s*(\w+).*?%\}|\{\{.*?\}\}`)
+	kramdownIAL     = regexp.MustCompile(`(?m)[ \t]*\{:[^}\n]*\}[ \t]*$\n?`)
+)
+
+// isJekyllContent reports whether a file name is a Markdown or HTML file
+func isJekyllContent(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown", ".mkd", ".html", ".htm":
+		return true
+	}
+	return false
+}
+
+// items reads _posts, _drafts and every page with front matter
+func (js *jekyllSource) items(im *importer) ([]*importedItem, error) {
+	if info, err := os.Stat(js.dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a Jekyll site folder", js.dir)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(js.dir, "_config.yml")); err == nil {
+		if err := yaml.Unmarshal(data, &js.config); err != nil {
+			return nil, fmt.Errorf("_config.yml: %v", err)
+		}
+	}
+	js.config.BaseURL = strings.TrimSuffix(js.config.BaseURL, "/")
+	permalink := js.config.Permalink
+	if permalink == "" {
+		permalink = "date"
+	}
+	if style, ok := jekyllPermalinkStyles[permalink]; ok {
+		permalink = style
+	}
+	js.posts = map[string]*importedItem{}
+	js.files = map[string]*importedItem{}
+	js.paths = map[*importedItem]string{}
+
+	excluded := map[string]bool{"node_modules": true, "vendor": true}
+	for _, name := range js.config.Exclude {
+		excluded[strings.Trim(name, "/")] = true
+	}
+
+	var items []*importedItem
+	err := filepath.Walk(js.dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(js.dir, file)
+		rel = filepath.ToSlash(rel)
+		name := info.Name()
+		if info.IsDir() {
+			if rel != "." && rel != "_posts" && rel != "_drafts" && !strings.HasPrefix(rel, "_posts/") &&
+				!strings.HasPrefix(rel, "_drafts/") && (strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") || excluded[rel]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isJekyllContent(name) || excluded[rel] {
+			return nil
+		}
+		inPosts := strings.HasPrefix(rel, "_posts/")
+		inDrafts := strings.HasPrefix(rel, "_drafts/")
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fm, body, ok, err := splitYAMLFrontMatter(string(data))
+		if err != nil {
+			im.note(rel, "not imported: %v", err)
+			return nil
+		}
+		if !ok && !inPosts && !inDrafts {
+			// Files without front matter are copied as they are by Jekyll
+			return nil
+		}
+
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		item := &importedItem{
+			Kind:        "post",
+			Source:      rel,
+			Title:       fm.string("title"),
+			Draft:       inDrafts || !fm.bool("published", true),
+			Tags:        append(fm.strings("tags"), fm.strings("categories")...),
+			Description: fm.string("description"),
+			Image:       fm.string("image"),
+			Author:      fm.string("author"),
+			Body:        body,
+		}
+		if item.Description == "" {
+			item.Description = stripHTML(fm.string("excerpt"))
+		}
+		if lang := fm.string("lang"); isLanguage(lang) {
+			item.Lang = lang
+		}
+
+		switch {
+		case inPosts || inDrafts:
+			title := base
+			if m := jekyllPostName.FindStringSubmatch(base); m != nil {
+				item.Date = parseImportedTime(m[1])
+				title = m[2]
+			}
+			if date := fm.time("date"); !date.IsZero() {
+				item.Date = date
+			}
+			if item.Date.IsZero() {
+				info, _ := os.Stat(file)
+				item.Date = info.ModTime()
+			}
+			item.Slug = title
+			if slug := fm.string("slug"); slug != "" {
+				item.Slug = slug
+			}
+			if item.Title == "" {
+				item.Title = titleFromSlug(title)
+			}
+			item.Updated = fm.time("last_modified_at")
+			if !inDrafts {
+				pattern := permalink
+				if p := fm.string("permalink"); p != "" {
+					pattern = p
+				}
+				item.Aliases = append(item.Aliases, js.postURL(pattern, item, fm, title))
+			}
+			js.posts[base] = item
+		default:
+			if base == "index" && path.Dir(rel) == "." || base == "404" {
+				im.note(rel, "not imported, Podium has its own home and error pages")
+				return nil
+			}
+			item.Kind = "page"
+			item.Slug = base
+			if base == "index" {
+				item.Slug = path.Base(path.Dir(rel))
+			}
+			if item.Title == "" {
+				item.Title = titleFromSlug(item.Slug)
+			}
+			if p := fm.string("permalink"); p != "" {
+				item.Aliases = append(item.Aliases, p)
+			} else {
+				item.Aliases = append(item.Aliases, js.pageURL(rel, permalink))
+			}
+		}
+		item.Aliases = append(item.Aliases, fm.strings("redirect_from")...)
+		for i, alias := range item.Aliases {
+			// URLs of the old site start with its baseurl
+			item.Aliases[i] = js.config.BaseURL + "/" + strings.TrimPrefix(alias, "/")
+		}
+		js.files[rel] = item
+		js.paths[item] = file
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+// postURL expands a permalink pattern for a post
+func (js *jekyllSource) postURL(pattern string, item *importedItem, fm frontMatter, title string) string {
+	var categories []string
+	for _, c := range fm.strings("categories") {
+		categories = append(categories, slugify(c))
+	}
+	d := item.Date
+	link := strings.NewReplacer(
+		":categories", strings.Join(categories, "/"),
+		":year", d.Format("2006"),
+		":short_year", d.Format("06"),
+		":i_month", fmt.Sprint(int(d.Month())),
+		":month", d.Format("01"),
+		":i_day", fmt.Sprint(d.Day()),
+		":day", d.Format("02"),
+		":y_day", fmt.Sprintf("%03d", d.YearDay()),
+		":title", title,
+		":slug", title,
+		":output_ext", ".html",
+	).Replace(pattern)
+	return regexp.MustCompile(`/{2,}`).ReplaceAllString("/"+link, "/")
+}
+
+// pageURL returns the URL Jekyll gives a page without a permalink
+func (js *jekyllSource) pageURL(rel, permalink string) string {
+	page := strings.TrimSuffix(rel, path.Ext(rel))
+	if path.Base(page) == "index" {
+		return "/" + path.Dir(page) + "/"
+	}
+	if strings.HasSuffix(permalink, "/") {
+		return "/" + page + "/"
+	}
+	return "/" + page + ".html"
+}
+
+// convert converts the Liquid tags of a post or page that have Markdown
+// equivalents, and HTML bodies to Markdown
+func (js *jekyllSource) convert(im *importer, item *importedItem) string {
+	file := js.paths[item]
+	if item.Image != "" {
+		item.Image = js.rewrite(im, item, file, item.Image)
+	}
+
+	// Raw blocks are set aside, so the Liquid in them is kept as text
+	var raws []string
+	body := liquidRaw.ReplaceAllStringFunc(item.Body, func(block string) string {
+		raws = append(raws, liquidRaw.FindStringSubmatch(block)[1])
+		return fmt.Sprintf("\x00raw%d\x00", len(raws)-1)
+	})
+	body = liquidHighlight.ReplaceAllString(body, "```$1")
+	body = liquidEndHigh.ReplaceAllString(body, "```")
+	body = liquidSiteURL.ReplaceAllString(body, "")
+	body = liquidLink.ReplaceAllStringFunc(body, func(tag string) string {
+		m := liquidLink.FindStringSubmatch(tag)
+		var target *importedItem
+		if m[1] == "post_url" {
+			target = js.posts[path.Base(m[2])]
+		} else {
+			target = js.files[strings.TrimPrefix(m[2], "/")]
+		}
+		if target == nil {
+			im.note(item.file, "{%% %s %s %%} points to nothing that was imported", m[1], m[2])
+			return tag
+		}
+		return js.newPath(target)
+	})
+	reported := map[string]bool{}
+	body = liquidAny.ReplaceAllStringFunc(body, func(tag string) string {
+		if !reported[tag] {
+			reported[tag] = true
+			im.note(item.file, "Liquid %s left as text", tag)
+		}
+		return tag
+	})
+	if kramdownIAL.MatchString(body) {
+		body = kramdownIAL.ReplaceAllString(body, "")
+		im.note(item.file, "kramdown attribute lists ({: ...}) removed")
+	}
+	for i, raw := range raws {
+		body = strings.Replace(body, fmt.Sprintf("\x00raw%d\x00", i), raw, 1)
+	}
+
+	rewrite := func(u string) string { return js.rewrite(im, item, file, u) }
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".html", ".htm":
+		return im.convertHTML(item, body, rewrite)
+	}
+	return rewriteMarkdownURLs(body, rewrite)
+}
+
+// newPath returns the path an imported item is published at
+func (js *jekyllSource) newPath(item *importedItem) string {
+	if item.Kind == "page" {
+		return langPrefix(item.Lang) + "/page/" + item.Slug
+	}
+	return langPrefix(item.Lang) + "/posts/" + item.Slug
+}
+
+// rewrite points a link at the new URL of the post or page it links to, or
+// copies the file it links to into assets/media
+func (js *jekyllSource) rewrite(im *importer, item *importedItem, file, raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Path == "" {
+		return raw
+	}
+	if isExternalURL(u) {
+		site, _ := url.Parse(js.config.URL)
+		if site == nil || site.Host == "" || u.Host != site.Host {
+			return raw
+		}
+	}
+	p := u.Path
+	if newPath, ok := im.movedPath(p); ok && strings.HasPrefix(p, "/") {
+		if u.Fragment != "" {
+			newPath += "#" + u.Fragment
+		}
+		return newPath
+	}
+	if js.config.BaseURL != "" && strings.HasPrefix(p, js.config.BaseURL+"/") {
+		p = strings.TrimPrefix(p, js.config.BaseURL)
+	}
+
+	local := filepath.Join(js.dir, filepath.FromSlash(p))
+	if !strings.HasPrefix(p, "/") {
+		local = filepath.Join(filepath.Dir(file), filepath.FromSlash(p))
+	}
+	rel, ok := im.insideFolder(item.file, js.dir, local, raw)
+	if !ok {
+		return raw
+	}
+	name := strings.TrimPrefix(filepath.ToSlash(rel), "assets/")
+	if sitePath, ok := im.localMedia(item.file, local, name); ok {
+		return sitePath
+	}
+	if strings.HasPrefix(p, "/") && !isExternalURL(u) {
+		im.note(item.file, "link to %s was not mapped", raw)
+	}
+	return raw
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// SMTPConfig is the mail server used for outgoing email (newsletter, forms)
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"` // 587 for STARTTLS, 465 for implicit TLS, 25 for plain
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"` // e.g. "My Blog <blog@example.com>"
+}
+
+// mailMessage is an outgoing email with a plain-text and an HTML body
+type mailMessage struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+// renderMailTemplates renders templates/email/<name>.txt and <name>.html into a
+// message's plain-text and HTML bodies
+func renderMailTemplates(msg *mailMessage, name string, data interface{}) error {
+	funcs := map[string]interface{}{"i18n": translate}
+	dir := filepath.Join("templates", "email")
+
+	text, err := texttemplate.New(name + ".txt").Funcs(funcs).ParseFiles(filepath.Join(dir, name+".txt"))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := text.Execute(&buf, data); err != nil {
+		return err
+	}
+	msg.Text = buf.String()
+
+	html, err := htmltemplate.New(name + ".html").Funcs(funcs).ParseFiles(filepath.Join(dir, name+".html"))
+	if err != nil {
+		return err
+	}
+	buf.Reset()
+	if err := html.Execute(&buf, data); err != nil {
+		return err
+	}
+	msg.HTML = buf.String()
+	return nil
+}
+
+// buildMail encodes a message as a multipart/alternative MIME email
+func buildMail(from string, msg mailMessage) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		qp.Close()
+	}
+	parts.Close()
+
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+
+	var out bytes.Buffer
+	headers := []string{
+		"From: " + from,
+		"To: " + msg.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		fmt.Sprintf("Message-ID: <%s@%s>", randomID(12), domain),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + parts.Boundary(),
+	}
+	for key, value := range msg.Headers {
+		headers = append(headers, key+": "+value)
+	}
+	out.WriteString(strings.Join(headers, "\r\n"))
+	out.WriteString("\r\n\r\n")
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+// sendMail delivers a message through the configured SMTP server. It uses
+// STARTTLS when the server offers it and implicit TLS on port 465.
+func sendMail(msg mailMessage) error {
+	cfg := appConfig.SMTP
+	if cfg.Host == "" || cfg.From == "" {
+		return errors.New("smtp host and from are not configured")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("smtp from: %v", err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("recipient: %v", err)
+	}
+	data, err := buildMail(cfg.From, msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(cfg.Host, fmt.Sprint(cfg.Port))
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	var conn net.Conn
+	if cfg.Port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: cfg.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && cfg.Port != 465 {
+		if err := client.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if cfg.Username != "" {
+		// PlainAuth refuses to send the password over an unencrypted
+		// connection, except to localhost
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"html"
@@ -11,13 +12,17 @@ import (
 	_ "image/png"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/disintegration/imaging"
 	"github.com/fsnotify/fsnotify"
@@ -41,12 +46,17 @@ type Config struct {
 	ShowQuickLinks  bool   `yaml:"show_quick_links"`
 	DisableLandingPage bool `yaml:"disable_landing_page"`
 	Port            int    `yaml:"port"`
+	ReadTimeout     int    `yaml:"read_timeout"`     // seconds
+	WriteTimeout    int    `yaml:"write_timeout"`    // seconds
+	IdleTimeout     int    `yaml:"idle_timeout"`     // seconds
+	ShutdownTimeout int    `yaml:"shutdown_timeout"` // seconds
 	PostsFolder     string `yaml:"posts_folder"`
 	StaticFolder    string `yaml:"static_folder"`
 	TemplatesFolder string `yaml:"templates_folder"`
 	AssetsFolder    string `yaml:"assets_folder"`
 	PostsPerPage    int    `yaml:"posts_per_page"`
 	FeedItems       int    `yaml:"feed_items"`
+	FeedFullContent bool   `yaml:"feed_full_content"`
 	ExcerptLength   int    `yaml:"excerpt_length"`
 	ShowSocialLinks bool   `yaml:"show_social_links"`
 	SocialTwitter   string `yaml:"social_twitter"`
@@ -57,6 +67,22 @@ type Config struct {
 	SocialFacebook  string `yaml:"social_facebook"`
 	UmamiScriptURL  string `yaml:"umami_script_url"`
 	UmamiWebsiteID  string `yaml:"umami_website_id"`
+	PreviewSecret   string `yaml:"preview_secret"`
+	DefaultLanguage string            `yaml:"default_language"`
+	Languages       []LanguageConfig  `yaml:"languages"`
+	I18nFolder      string            `yaml:"i18n_folder"`
+	CacheFolder     string            `yaml:"cache_folder"`
+	OGImage         OGImageConfig     `yaml:"og_image"`
+	DataFolder      string            `yaml:"data_folder"`
+	Comments        CommentsConfig    `yaml:"comments"`
+	Webmention      WebmentionConfig  `yaml:"webmention"`
+	ActivityPub     ActivityPubConfig `yaml:"activitypub"`
+	SMTP            SMTPConfig        `yaml:"smtp"`
+	Newsletter      NewsletterConfig  `yaml:"newsletter"`
+	Forms           map[string]FormConfig `yaml:"forms"`
+	SearchIndex     SearchIndexConfig `yaml:"search_index"`
+	Robots          RobotsConfig      `yaml:"robots"`
+	Deploy          map[string]DeployTarget `yaml:"deploy"`
 }
 
 // Global config variable
@@ -71,18 +97,114 @@ func loadConfig(path string) (Config, error) {
 		return config, err
 	}
 	err = yaml.Unmarshal(data, &config)
+	applyConfigDefaults(&config)
 	return config, err
 }
 
+// applyConfigDefaults fills in defaults for optional fields that were not provided
+func applyConfigDefaults(config *Config) {
+	if config.PostsPerPage == 0 {
+		config.PostsPerPage = 10
+	}
+	if config.FeedItems == 0 {
+		config.FeedItems = 20
+	}
+	if config.SiteURL == "" {
+		config.SiteURL = fmt.Sprintf("http://localhost:%d", config.Port)
+	}
+	if config.ReadTimeout == 0 {
+		config.ReadTimeout = 15
+	}
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = 30
+	}
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = 120
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = 20
+	}
+	if len(config.Languages) == 0 {
+		config.Languages = []LanguageConfig{{Code: "en", Name: "English", Locale: "en-us"}}
+	}
+	if config.I18nFolder == "" {
+		config.I18nFolder = "i18n"
+	}
+	if config.CacheFolder == "" {
+		config.CacheFolder = "cache"
+	}
+	if config.DataFolder == "" {
+		config.DataFolder = "data"
+	}
+	if config.ActivityPub.Username == "" {
+		config.ActivityPub.Username = "blog"
+	}
+	if config.Comments.MaxLinks == 0 {
+		config.Comments.MaxLinks = 2
+	}
+	if config.Comments.MaxLength == 0 {
+		config.Comments.MaxLength = 5000
+	}
+	if config.Comments.RateLimit == 0 {
+		config.Comments.RateLimit = 5
+	}
+	if config.SMTP.Port == 0 {
+		config.SMTP.Port = 587
+	}
+	if config.Newsletter.Mode == "" {
+		config.Newsletter.Mode = "post"
+	}
+	if config.Newsletter.DigestDay == "" {
+		config.Newsletter.DigestDay = "monday"
+	}
+	if len(config.SearchIndex.Fields) == 0 {
+		config.SearchIndex.Fields = searchIndexFields
+	}
+	if config.SearchIndex.BodyTokens == 0 {
+		config.SearchIndex.BodyTokens = 500
+	}
+	if config.SearchIndex.SummaryLength == 0 {
+		config.SearchIndex.SummaryLength = 160
+	}
+	for name, form := range config.Forms {
+		if form.Deliver == "" {
+			form.Deliver = "file"
+		}
+		if form.RateLimit == 0 {
+			form.RateLimit = 5
+		}
+		for i, field := range form.Fields {
+			switch field.Type {
+			case "text", "email", "url", "textarea":
+			default:
+				field.Type = "text"
+			}
+			if field.Label == "" {
+				field.Label = field.Name
+			}
+			if field.MaxLength == 0 {
+				field.MaxLength = 1000
+				if field.Type == "textarea" {
+					field.MaxLength = 5000
+				}
+			}
+			form.Fields[i] = field
+		}
+		config.Forms[name] = form
+	}
+}
+
 type Page struct {
 	Title            string
 	Content          template.HTML
+	Meta             template.HTML
 	Pages            []PageLink
 	SiteTitle        string
 	SiteDesc         string
 	SiteAuthor       string
 	SiteAuthorURL    string
 	IsDraft          bool
+	NoIndex          bool
 	CurrentYear      string
 	ShowSocialLinks  bool
 	SocialTwitter    string
@@ -94,6 +216,10 @@ type Page struct {
 	UmamiScriptURL   string
 	UmamiWebsiteID   string
 	DisableLandingPage bool
+	Lang             string
+	LangPrefix       string
+	Languages        []LanguageLink
+	Feeds            []FeedLink
 }
 
 type PageLink struct {
@@ -105,12 +231,15 @@ type PageLink struct {
 	Excerpt     string
 	ReadingTime string
 	Featured    bool
+	Lang        string
+	Author      string
 }
 
 type Post struct {
 	Title            string
 	Slug             string
 	Content          template.HTML
+	Meta             template.HTML
 	Pages            []PageLink
 	Tags             []string
 	SiteTitle        string
@@ -120,6 +249,8 @@ type Post struct {
 	Date             string
 	PublishDate      string
 	IsDraft          bool
+	IsPreview        bool
+	NoIndex          bool
 	ReadingTime      string
 	CurrentYear      string
 	Featured         bool
@@ -133,12 +264,55 @@ type Post struct {
 	UmamiScriptURL   string
 	UmamiWebsiteID   string
 	DisableLandingPage bool
+	Lang             string
+	LangPrefix       string
+	Languages        []LanguageLink
+	Feeds            []FeedLink
+	CommentsEnabled  bool
+	Comments         []*CommentNode
+	CommentCount     int
+	CommentStatus    string
+	ReplyTo          *CommentNode
+	Webmentions      *WebmentionGroups
+	WebmentionURL    string
+	NewsletterEnabled bool
 }
 
 // program implements the service.Interface
 type program struct {
 	router *gin.Engine
-	exit   chan struct{}
+	server *http.Server
+	ctx    context.Context // cancelled when the service stops
+	cancel context.CancelFunc
+	loops  sync.WaitGroup // watchers and schedulers started by Start
+}
+
+// newProgram returns a program whose background goroutines stop with its context
+func newProgram() *program {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &program{ctx: ctx, cancel: cancel}
+}
+
+// loop runs a watcher or scheduler until the program's context is cancelled
+func (p *program) loop(fn func()) {
+	p.loops.Add(1)
+	go func() {
+		defer p.loops.Done()
+		fn()
+	}()
+}
+
+// backgroundTasks counts the one-off jobs started outside a request, such as
+// deliveries to other sites and newsletters, so a stop can let them finish
+var backgroundTasks sync.WaitGroup
+
+// goBackground runs fn as a background task
+func goBackground(fn func()) {
+	backgroundTasks.Add(1)
+	go func() {
+		defer backgroundTasks.Done()
+		fn()
+	}()
 }
 
 // cacheMiddleware adds appropriate caching headers based on content type
@@ -153,25 +327,10 @@ func cacheMiddleware() gin.HandlerFunc {
 			return
 		}
 		
-		// Cache static assets for longer periods
+		c.Header("Cache-Control", cacheControl(path))
+
+		// Let browsers revalidate assets with an ETag
 		if strings.HasPrefix(path, "/assets/") {
-			// Determine cache duration based on file type
-			ext := filepath.Ext(path)
-			var maxAge int
-			
-			switch ext {
-			case ".css", ".js":
-				maxAge = 86400 * 7 // 7 days for CSS/JS
-			case ".png", ".jpg", ".jpeg", ".gif", ".svg", ".ico", ".webp":
-				maxAge = 86400 * 30 // 30 days for images
-			case ".woff", ".woff2", ".ttf", ".eot":
-				maxAge = 86400 * 365 // 1 year for fonts
-			default:
-				maxAge = 86400 // 1 day for other assets
-			}
-			
-			c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
-			
 			// Try to get file modification time for ETag
 			filePath := filepath.Join(".", path)
 			if info, err := os.Stat(filePath); err == nil {
@@ -184,15 +343,35 @@ func cacheMiddleware() gin.HandlerFunc {
 					return
 				}
 			}
-		} else {
-			// For HTML pages, use shorter cache with revalidation
-			c.Header("Cache-Control", "public, max-age=300, must-revalidate")
 		}
 		
 		c.Next()
 	}
 }
 
+// cacheControl returns the Cache-Control header of a path: assets are cached
+// for a period that depends on their type, everything else briefly
+func cacheControl(path string) string {
+	if !strings.HasPrefix(path, "/assets/") {
+		// For HTML pages, use shorter cache with revalidation
+		return "public, max-age=300, must-revalidate"
+	}
+
+	// Determine cache duration based on file type
+	var maxAge int
+	switch filepath.Ext(path) {
+	case ".css", ".js":
+		maxAge = 86400 * 7 // 7 days for CSS/JS
+	case ".png", ".jpg", ".jpeg", ".gif", ".svg", ".ico", ".webp":
+		maxAge = 86400 * 30 // 30 days for images
+	case ".woff", ".woff2", ".ttf", ".eot":
+		maxAge = 86400 * 365 // 1 year for fonts
+	default:
+		maxAge = 86400 // 1 day for other assets
+	}
+	return fmt.Sprintf("public, max-age=%d", maxAge)
+}
+
 // minifyAsset minifies CSS and JS files on-the-fly
 func minifyAsset(filePath string) ([]byte, error) {
 	// Read the original file
@@ -329,17 +508,53 @@ func resizeImage(sourcePath string, width, height int) (image.Image, error) {
 
 func (p *program) Start(s service.Service) error {
 	log.Println("Podium service starting...")
-	go p.run()
+	router, err := newRouter(gin.Logger())
+	if err != nil {
+		return fmt.Errorf("loading templates: %v", err)
+	}
+	p.router = router
+	p.server = &http.Server{
+		Addr:              fmt.Sprintf(":%d", appConfig.Port),
+		Handler:           router,
+		ReadHeaderTimeout: time.Duration(appConfig.ReadTimeout) * time.Second,
+		ReadTimeout:       time.Duration(appConfig.ReadTimeout) * time.Second,
+		WriteTimeout:      time.Duration(appConfig.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(appConfig.IdleTimeout) * time.Second,
+	}
+	// Bind here rather than in run, so a port that is already in use fails
+	// the start instead of leaving a service running that serves nothing
+	ln, err := net.Listen("tcp", p.server.Addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %v", p.server.Addr, err)
+	}
+	go p.run(ln)
+	p.loop(p.processWebmentions)
 	
 	// Start config file watcher in production mode
 	if !isDevMode {
-		go p.watchConfigFile()
+		p.loop(p.watchConfigFile)
+	}
+
+	// Announce newly published posts (webmentions, ...) in production mode only,
+	// so local edits never notify other sites
+	if !isDevMode {
+		p.loop(p.watchPublished)
+		p.loop(p.watchDigests)
 	}
 	
 	return nil
 }
 
-func (p *program) run() {
+func (p *program) run(ln net.Listener) {
+	log.Printf("Starting Podium server on %s", p.server.Addr)
+	if err := p.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+		log.Printf("Error serving: %v", err)
+	}
+}
+
+// newRouter sets up the Gin engine with every route of the site. The
+// middleware runs before the routes.
+func newRouter(middleware ...gin.HandlerFunc) (*gin.Engine, error) {
 	// Set Gin mode based on dev mode
 	if isDevMode {
 		gin.SetMode(gin.DebugMode)
@@ -347,40 +562,22 @@ func (p *program) run() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	
-	// Create router with default middleware (Logger and Recovery)
-	p.router = gin.New()
-	
-	// Add logger middleware
-	p.router.Use(gin.Logger())
+	// Create router with the caller's middleware (e.g. the request logger)
+	router := gin.New()
+	router.Use(middleware...)
+
+	// Route on the escaped path, so a tag such as CI/CD (/tags/CI%2FCD) stays
+	// one path segment; the parameters are still unescaped
+	router.UseRawPath = true
 	
 	// Add custom recovery middleware for 500 errors
-	p.router.Use(func(c *gin.Context) {
+	router.Use(func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
 				// Log the error
 				log.Printf("PANIC RECOVERED: %v", err)
 				
-				pages := getStaticPages()
-				c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-					"Error":           "Internal server error",
-					"ErrorCode":       500,
-					"ErrorMessage":    "Something went wrong on our end. We're working to fix it.",
-					"Pages":           pages,
-					"SiteTitle":       appConfig.SiteTitle,
-					"SiteAuthor":      appConfig.SiteAuthor,
-					"SiteAuthorURL":   appConfig.SiteAuthorURL,
-					"CurrentYear":     getCurrentYear(),
-					"ShowSocialLinks": appConfig.ShowSocialLinks,
-					"SocialTwitter":   appConfig.SocialTwitter,
-					"SocialBluesky":   appConfig.SocialBluesky,
-					"SocialLinkedIn":  appConfig.SocialLinkedIn,
-					"SocialGitHub":    appConfig.SocialGitHub,
-					"SocialReddit":    appConfig.SocialReddit,
-					"SocialFacebook":  appConfig.SocialFacebook,
-					"UmamiScriptURL":  appConfig.UmamiScriptURL,
-					"UmamiWebsiteID":  appConfig.UmamiWebsiteID,
-					"DisableLandingPage": appConfig.DisableLandingPage,
-				})
+				renderError(c, http.StatusInternalServerError, "internal_error", "internal_error_message")
 				c.Abort()
 			}
 		}()
@@ -388,411 +585,44 @@ func (p *program) run() {
 	})
 
 	// Load HTML templates (they will auto-reload in debug mode)
-	p.router.LoadHTMLGlob("templates/*")
+	// Parse them once first, since LoadHTMLGlob panics on a broken template
+	funcMap := template.FuncMap{
+		"i18n":       translate,
+		"pathEscape": url.PathEscape,
+	}
+	if _, err := template.New("").Funcs(funcMap).ParseGlob("templates/*.html"); err != nil {
+		return nil, err
+	}
+	router.SetFuncMap(funcMap)
+	router.LoadHTMLGlob("templates/*.html")
 
 	// Add caching middleware
-	p.router.Use(cacheMiddleware())
-
-	// Home route
-	p.router.GET("/", func(c *gin.Context) {
-		// If landing page is disabled, redirect to posts list
-		if appConfig.DisableLandingPage {
-			c.Redirect(http.StatusMovedPermanently, "/posts")
-			return
+	router.Use(cacheMiddleware())
+
+	// Content routes for the default language live at the root, every other
+	// language gets its own URL prefix (e.g. /nb/posts)
+	registerContentRoutes(router)
+	for _, lang := range appConfig.Languages {
+		if lang.Code != defaultLanguage() {
+			registerContentRoutes(router.Group("/" + lang.Code))
 		}
-		
-		pages := getStaticPages()
-		c.HTML(http.StatusOK, "index.html", gin.H{
-			"Pages":          pages,
-			"SiteTitle":      appConfig.SiteTitle,
-			"SiteDesc":       appConfig.SiteDescription,
-			"SiteAuthor":     appConfig.SiteAuthor,
-			"SiteAuthorURL":  appConfig.SiteAuthorURL,
-			"HomeIntro":      appConfig.HomeIntro,
-			"ShowQuickLinks": appConfig.ShowQuickLinks,
-			"CurrentYear":    getCurrentYear(),
-			"ShowSocialLinks": appConfig.ShowSocialLinks,
-			"SocialTwitter":   appConfig.SocialTwitter,
-			"SocialBluesky":   appConfig.SocialBluesky,
-			"SocialLinkedIn":  appConfig.SocialLinkedIn,
-			"SocialGitHub":    appConfig.SocialGitHub,
-			"SocialReddit":    appConfig.SocialReddit,
-			"SocialFacebook":  appConfig.SocialFacebook,
-			"UmamiScriptURL":  appConfig.UmamiScriptURL,
-			"UmamiWebsiteID":  appConfig.UmamiWebsiteID,
-			"DisableLandingPage": appConfig.DisableLandingPage,
-		})
-	})
-
-	// Static pages route
-	p.router.GET("/page/:slug", func(c *gin.Context) {
-		slug := c.Param("slug")
-		content, title, _, _, _, isDraft, _, _, err := loadMarkdownFile("static", slug)
-		if err != nil {
-			log.Printf("Page not found: %s", slug)
-			c.HTML(http.StatusNotFound, "error.html", gin.H{
-				"Error":           "Page not found",
-				"ErrorCode":       404,
-				"ErrorMessage":    "The page you're looking for doesn't exist.",
-				"Pages":           getStaticPages(),
-				"SiteTitle":       appConfig.SiteTitle,
-				"SiteAuthor":      appConfig.SiteAuthor,
-				"SiteAuthorURL":   appConfig.SiteAuthorURL,
-				"CurrentYear":     getCurrentYear(),
-				"ShowSocialLinks": appConfig.ShowSocialLinks,
-				"SocialTwitter":   appConfig.SocialTwitter,
-				"SocialBluesky":   appConfig.SocialBluesky,
-				"SocialLinkedIn":  appConfig.SocialLinkedIn,
-				"SocialGitHub":    appConfig.SocialGitHub,
-				"SocialReddit":    appConfig.SocialReddit,
-				"SocialFacebook":  appConfig.SocialFacebook,
-				"UmamiScriptURL":  appConfig.UmamiScriptURL,
-				"UmamiWebsiteID":  appConfig.UmamiWebsiteID,
-				"DisableLandingPage": appConfig.DisableLandingPage,
-			})
-			return
-		}
-
-		// Don't show draft pages
-		if isDraft {
-			log.Printf("Attempted access to draft page: %s", slug)
-			c.HTML(http.StatusNotFound, "error.html", gin.H{
-				"Error":           "Page not found",
-				"ErrorCode":       404,
-				"ErrorMessage":    "The page you're looking for doesn't exist.",
-				"Pages":           getStaticPages(),
-				"SiteTitle":       appConfig.SiteTitle,
-				"SiteAuthor":      appConfig.SiteAuthor,
-				"SiteAuthorURL":   appConfig.SiteAuthorURL,
-				"CurrentYear":     getCurrentYear(),
-				"ShowSocialLinks": appConfig.ShowSocialLinks,
-				"SocialTwitter":   appConfig.SocialTwitter,
-				"SocialBluesky":   appConfig.SocialBluesky,
-				"SocialLinkedIn":  appConfig.SocialLinkedIn,
-				"SocialGitHub":    appConfig.SocialGitHub,
-				"SocialReddit":    appConfig.SocialReddit,
-				"SocialFacebook":  appConfig.SocialFacebook,
-				"UmamiScriptURL":  appConfig.UmamiScriptURL,
-				"UmamiWebsiteID":  appConfig.UmamiWebsiteID,
-				"DisableLandingPage": appConfig.DisableLandingPage,
-			})
-			return
-		}
-
-		pages := getStaticPages()
-		c.HTML(http.StatusOK, "page.html", Page{
-			Title:           title,
-			Content:         template.HTML(content),
-			Pages:           pages,
-			SiteTitle:       appConfig.SiteTitle,
-			SiteDesc:        appConfig.SiteDescription,
-			SiteAuthor:      appConfig.SiteAuthor,
-			SiteAuthorURL:   appConfig.SiteAuthorURL,
-			IsDraft:         isDraft,
-			CurrentYear:     getCurrentYear(),
-			ShowSocialLinks: appConfig.ShowSocialLinks,
-			SocialTwitter:   appConfig.SocialTwitter,
-			SocialBluesky:   appConfig.SocialBluesky,
-			SocialLinkedIn:  appConfig.SocialLinkedIn,
-			SocialGitHub:    appConfig.SocialGitHub,
-			SocialReddit:    appConfig.SocialReddit,
-			SocialFacebook:  appConfig.SocialFacebook,
-			UmamiScriptURL:  appConfig.UmamiScriptURL,
-			UmamiWebsiteID:  appConfig.UmamiWebsiteID,
-			DisableLandingPage: appConfig.DisableLandingPage,
-		})
-	})
-
-	// Blog posts list route
-	p.router.GET("/posts", func(c *gin.Context) {
-		allPosts := getBlogPosts()
-		pages := getStaticPages()
-		
-		// Get page number from query params
-		pageStr := c.DefaultQuery("page", "1")
-		page, err := strconv.Atoi(pageStr)
-		if err != nil || page < 1 {
-			page = 1
-		}
-		
-		// Calculate pagination
-		postsPerPage := appConfig.PostsPerPage
-		totalPosts := len(allPosts)
-		totalPages := (totalPosts + postsPerPage - 1) / postsPerPage
-		
-		// Ensure page is within bounds
-		if page > totalPages && totalPages > 0 {
-			page = totalPages
-		}
-		
-		// Calculate slice bounds
-		start := (page - 1) * postsPerPage
-		end := start + postsPerPage
-		if end > totalPosts {
-			end = totalPosts
-		}
-		
-		// Get posts for current page
-		var paginatedPosts []PageLink
-		if start < totalPosts {
-			paginatedPosts = allPosts[start:end]
-		}
-		
-		c.HTML(http.StatusOK, "posts.html", gin.H{
-			"Posts":           paginatedPosts,
-			"Pages":           pages,
-			"SiteTitle":       appConfig.SiteTitle,
-			"SiteAuthor":      appConfig.SiteAuthor,
-			"SiteAuthorURL":   appConfig.SiteAuthorURL,
-			"CurrentPage":     page,
-			"TotalPages":      totalPages,
-			"HasPrev":         page > 1,
-			"HasNext":         page < totalPages,
-			"PrevPage":        page - 1,
-			"NextPage":        page + 1,
-			"CurrentYear":     getCurrentYear(),
-			"ShowSocialLinks": appConfig.ShowSocialLinks,
-			"SocialTwitter":   appConfig.SocialTwitter,
-			"SocialBluesky":   appConfig.SocialBluesky,
-			"SocialLinkedIn":  appConfig.SocialLinkedIn,
-			"SocialGitHub":    appConfig.SocialGitHub,
-			"SocialReddit":    appConfig.SocialReddit,
-			"SocialFacebook":  appConfig.SocialFacebook,
-			"UmamiScriptURL":  appConfig.UmamiScriptURL,
-			"UmamiWebsiteID":  appConfig.UmamiWebsiteID,
-			"DisableLandingPage": appConfig.DisableLandingPage,
-		})
-	})
-
-	// Individual blog post route
-	p.router.GET("/posts/:slug", func(c *gin.Context) {
-		slug := c.Param("slug")
-		content, title, tags, date, publishDate, isDraft, isFeatured, plainText, err := loadMarkdownFile("posts", slug)
-		if err != nil {
-			log.Printf("Post not found: %s", slug)
-			c.HTML(http.StatusNotFound, "error.html", gin.H{
-				"Error":           "Post not found",
-				"ErrorCode":       404,
-				"ErrorMessage":    "The blog post you're looking for doesn't exist.",
-				"Pages":           getStaticPages(),
-				"SiteTitle":       appConfig.SiteTitle,
-				"SiteAuthor":      appConfig.SiteAuthor,
-				"SiteAuthorURL":   appConfig.SiteAuthorURL,
-				"CurrentYear":     getCurrentYear(),
-				"ShowSocialLinks": appConfig.ShowSocialLinks,
-				"SocialTwitter":   appConfig.SocialTwitter,
-				"SocialBluesky":   appConfig.SocialBluesky,
-				"SocialLinkedIn":  appConfig.SocialLinkedIn,
-				"SocialGitHub":    appConfig.SocialGitHub,
-				"SocialReddit":    appConfig.SocialReddit,
-				"SocialFacebook":  appConfig.SocialFacebook,
-				"UmamiScriptURL":  appConfig.UmamiScriptURL,
-				"UmamiWebsiteID":  appConfig.UmamiWebsiteID,
-				"DisableLandingPage": appConfig.DisableLandingPage,
-			})
-			return
-		}
-
-		// Don't show draft posts
-		if isDraft {
-			log.Printf("Attempted access to draft post: %s", slug)
-			c.HTML(http.StatusNotFound, "error.html", gin.H{
-				"Error":           "Post not found",
-				"ErrorCode":       404,
-				"ErrorMessage":    "The blog post you're looking for doesn't exist.",
-				"Pages":           getStaticPages(),
-				"SiteTitle":       appConfig.SiteTitle,
-				"SiteAuthor":      appConfig.SiteAuthor,
-				"SiteAuthorURL":   appConfig.SiteAuthorURL,
-				"CurrentYear":     getCurrentYear(),
-				"ShowSocialLinks": appConfig.ShowSocialLinks,
-				"SocialTwitter":   appConfig.SocialTwitter,
-				"SocialBluesky":   appConfig.SocialBluesky,
-				"SocialLinkedIn":  appConfig.SocialLinkedIn,
-				"SocialGitHub":    appConfig.SocialGitHub,
-				"SocialReddit":    appConfig.SocialReddit,
-				"SocialFacebook":  appConfig.SocialFacebook,
-				"UmamiScriptURL":  appConfig.UmamiScriptURL,
-				"UmamiWebsiteID":  appConfig.UmamiWebsiteID,
-				"DisableLandingPage": appConfig.DisableLandingPage,
-			})
-			return
-		}
-
-		// Check if post is scheduled for future publication
-		if publishDate != "" {
-			pubTime, err := time.Parse("2006-01-02 15:04", publishDate)
-			if err == nil && time.Now().Before(pubTime) {
-				// Post is scheduled for the future, don't show it yet
-				log.Printf("Attempted access to scheduled post: %s (scheduled for %s)", slug, publishDate)
-				c.HTML(http.StatusNotFound, "error.html", gin.H{
-					"Error":           "Post not found",
-					"ErrorCode":       404,
-					"ErrorMessage":    "The blog post you're looking for doesn't exist.",
-					"Pages":           getStaticPages(),
-					"SiteTitle":       appConfig.SiteTitle,
-					"SiteAuthor":      appConfig.SiteAuthor,
-					"SiteAuthorURL":   appConfig.SiteAuthorURL,
-					"CurrentYear":     getCurrentYear(),
-					"ShowSocialLinks": appConfig.ShowSocialLinks,
-					"SocialTwitter":   appConfig.SocialTwitter,
-					"SocialBluesky":   appConfig.SocialBluesky,
-					"SocialLinkedIn":  appConfig.SocialLinkedIn,
-					"SocialGitHub":    appConfig.SocialGitHub,
-					"SocialReddit":    appConfig.SocialReddit,
-					"SocialFacebook":  appConfig.SocialFacebook,
-					"UmamiScriptURL":  appConfig.UmamiScriptURL,
-					"UmamiWebsiteID":  appConfig.UmamiWebsiteID,
-					"DisableLandingPage": appConfig.DisableLandingPage,
-				})
-				return
-			}
-		}
-
-		pages := getStaticPages()
-		readingTime := calculateReadingTime(plainText)
-		c.HTML(http.StatusOK, "post.html", Post{
-			Title:           title,
-			Slug:            slug,
-			Content:         template.HTML(content),
-			Pages:           pages,
-			Tags:            tags,
-			SiteTitle:       appConfig.SiteTitle,
-			SiteDesc:        appConfig.SiteDescription,
-			SiteAuthor:      appConfig.SiteAuthor,
-			SiteAuthorURL:   appConfig.SiteAuthorURL,
-			Date:            date,
-			PublishDate:     publishDate,
-			IsDraft:         isDraft,
-			ReadingTime:     readingTime,
-			CurrentYear:     getCurrentYear(),
-			Featured:        isFeatured,
-			ShowSocialLinks: appConfig.ShowSocialLinks,
-			SocialTwitter:   appConfig.SocialTwitter,
-			SocialBluesky:   appConfig.SocialBluesky,
-			SocialLinkedIn:  appConfig.SocialLinkedIn,
-			SocialGitHub:    appConfig.SocialGitHub,
-			SocialReddit:    appConfig.SocialReddit,
-			SocialFacebook:  appConfig.SocialFacebook,
-			UmamiScriptURL:  appConfig.UmamiScriptURL,
-			UmamiWebsiteID:  appConfig.UmamiWebsiteID,
-			DisableLandingPage: appConfig.DisableLandingPage,
-		})
-	})
-
-	// Tag filtering route
-	p.router.GET("/tags/:tag", func(c *gin.Context) {
-		tag := c.Param("tag")
-		allPosts := getBlogPosts()
-		var filteredPosts []PageLink
-		
-		for _, post := range allPosts {
-			for _, postTag := range post.Tags {
-				if strings.EqualFold(postTag, tag) {
-					filteredPosts = append(filteredPosts, post)
-					break
-				}
-			}
-		}
-		
-		// Get page number from query params
-		pageStr := c.DefaultQuery("page", "1")
-		page, err := strconv.Atoi(pageStr)
-		if err != nil || page < 1 {
-			page = 1
-		}
-		
-		// Calculate pagination
-		postsPerPage := appConfig.PostsPerPage
-		totalPosts := len(filteredPosts)
-		totalPages := (totalPosts + postsPerPage - 1) / postsPerPage
-		
-		// Ensure page is within bounds
-		if page > totalPages && totalPages > 0 {
-			page = totalPages
-		}
-		
-		// Calculate slice bounds
-		start := (page - 1) * postsPerPage
-		end := start + postsPerPage
-		if end > totalPosts {
-			end = totalPosts
-		}
-		
-		// Get posts for current page
-		var paginatedPosts []PageLink
-		if start < totalPosts {
-			paginatedPosts = filteredPosts[start:end]
-		}
-		
-		pages := getStaticPages()
-		c.HTML(http.StatusOK, "posts.html", gin.H{
-			"Posts":           paginatedPosts,
-			"Pages":           pages,
-			"Tag":             tag,
-			"SiteTitle":       appConfig.SiteTitle,
-			"SiteAuthor":      appConfig.SiteAuthor,
-			"SiteAuthorURL":   appConfig.SiteAuthorURL,
-			"CurrentPage":     page,
-			"TotalPages":      totalPages,
-			"HasPrev":         page > 1,
-			"HasNext":         page < totalPages,
-			"PrevPage":        page - 1,
-			"NextPage":        page + 1,
-			"CurrentYear":     getCurrentYear(),
-			"ShowSocialLinks": appConfig.ShowSocialLinks,
-			"SocialTwitter":   appConfig.SocialTwitter,
-			"SocialBluesky":   appConfig.SocialBluesky,
-			"SocialLinkedIn":  appConfig.SocialLinkedIn,
-			"SocialGitHub":    appConfig.SocialGitHub,
-			"SocialReddit":    appConfig.SocialReddit,
-			"SocialFacebook":  appConfig.SocialFacebook,
-			"UmamiScriptURL":  appConfig.UmamiScriptURL,
-			"UmamiWebsiteID":  appConfig.UmamiWebsiteID,
-			"DisableLandingPage": appConfig.DisableLandingPage,
-		})
-	})
+	}
 
-	// RSS/Atom Feed route
-	p.router.GET("/feed.xml", func(c *gin.Context) {
-		posts := getBlogPosts()
-		
-		// Limit to feed_items from config
-		feedPosts := posts
-		if len(posts) > appConfig.FeedItems {
-			feedPosts = posts[:appConfig.FeedItems]
-		}
-		
-		// Build time for the feed (most recent post date or current time)
-		buildDate := time.Now().Format(time.RFC1123Z)
-		if len(feedPosts) > 0 && feedPosts[0].Date != "" {
-			if parsedDate, err := time.Parse("2006-01-02", feedPosts[0].Date); err == nil {
-				buildDate = parsedDate.Format(time.RFC1123Z)
-			}
-		}
-		
-		c.Header("Content-Type", "application/rss+xml; charset=utf-8")
-		c.String(http.StatusOK, generateRSSFeed(feedPosts, buildDate))
-	})
+	// Serve robots.txt
+	router.GET("/robots.txt", handleRobots)
 
-	// Sitemap.xml route
-	p.router.GET("/sitemap.xml", func(c *gin.Context) {
-		posts := getBlogPosts()
-		pages := getStaticPages()
-		
-		c.Header("Content-Type", "application/xml; charset=utf-8")
-		c.String(http.StatusOK, generateSitemap(posts, pages))
-	})
+	// Receive webmentions from other sites
+	router.POST("/webmention", handleWebmention)
 
-	// Serve robots.txt
-	p.router.GET("/robots.txt", func(c *gin.Context) {
-		c.Header("Content-Type", "text/plain; charset=utf-8")
-		content := fmt.Sprintf("# robots.txt for Podium\n# https://www.robotstxt.org/\n\nUser-agent: *\nAllow: /\n\n# Sitemaps\nSitemap: %s/sitemap.xml\n", appConfig.SiteURL)
-		c.String(http.StatusOK, content)
-	})
+	// ActivityPub, so the blog can be followed from Mastodon and the rest of the Fediverse
+	router.GET("/.well-known/webfinger", handleWebFinger)
+	router.GET("/ap/actor", handleActor)
+	router.GET("/ap/outbox", handleOutbox)
+	router.GET("/ap/followers", handleFollowers)
+	router.POST("/ap/inbox", handleInbox)
 
 	// Serve humans.txt
-	p.router.GET("/humans.txt", func(c *gin.Context) {
+	router.GET("/humans.txt", func(c *gin.Context) {
 		content, err := ioutil.ReadFile("humans.txt")
 		if err != nil {
 			c.String(http.StatusNotFound, "humans.txt not found")
@@ -803,7 +633,7 @@ func (p *program) run() {
 	})
 
 	// Serve static assets (CSS, JS, images) with minification for CSS/JS
-	p.router.GET("/assets/*filepath", func(c *gin.Context) {
+	router.GET("/assets/*filepath", func(c *gin.Context) {
 		reqPath := c.Param("filepath")
 		fullPath := filepath.Join("./assets", reqPath)
 		
@@ -899,40 +729,464 @@ func (p *program) run() {
 	})
 
 	// Custom 404 handler for undefined routes
-	p.router.NoRoute(func(c *gin.Context) {
-		pages := getStaticPages()
-		c.HTML(http.StatusNotFound, "error.html", gin.H{
-			"Error":           "Page not found",
-			"ErrorCode":       404,
-			"ErrorMessage":    "The page you're looking for doesn't exist.",
-			"Pages":           pages,
-			"SiteTitle":       appConfig.SiteTitle,
-			"SiteAuthor":      appConfig.SiteAuthor,
-			"SiteAuthorURL":   appConfig.SiteAuthorURL,
-			"CurrentYear":     getCurrentYear(),
-			"ShowSocialLinks": appConfig.ShowSocialLinks,
-			"SocialTwitter":   appConfig.SocialTwitter,
-			"SocialBluesky":   appConfig.SocialBluesky,
-			"SocialLinkedIn":  appConfig.SocialLinkedIn,
-			"SocialGitHub":    appConfig.SocialGitHub,
-			"SocialReddit":    appConfig.SocialReddit,
-			"SocialFacebook":  appConfig.SocialFacebook,
-			"UmamiScriptURL":  appConfig.UmamiScriptURL,
-			"UmamiWebsiteID":  appConfig.UmamiWebsiteID,
-			"DisableLandingPage": appConfig.DisableLandingPage,
-		})
+	router.NoRoute(func(c *gin.Context) {
+		renderError(c, http.StatusNotFound, "page_not_found", "page_not_found_message")
+	})
+
+	return router, nil
+}
+
+// registerContentRoutes registers the routes that exist once per language
+func registerContentRoutes(r gin.IRoutes) {
+	r.GET("/", handleHome)
+	r.GET("/page/:slug", handlePage)
+	r.GET("/posts", handlePosts)
+	r.GET("/posts/page/:page", handlePosts)
+	r.GET("/posts/:slug", handlePost)
+	r.GET("/posts/:slug/og.png", handleOGImage)
+	r.POST("/posts/:slug/comments", handleComment)
+	r.GET("/preview/:slug", handlePreview)
+	r.GET("/tags/:tag", handleTag)
+	r.GET("/tags/:tag/page/:page", handleTag)
+	r.GET("/search", handleSearch)
+	r.GET("/search-index.json", handleSearchIndex)
+	registerFeedRoutes(r)
+	r.GET("/sitemap.xml", handleSitemap)
+	r.GET("/sitemap-:part", handleSitemapPart)
+	r.POST("/forms/:name", handleFormSubmit)
+	r.GET("/forms/:name/thanks", handleFormThanks)
+	r.POST("/newsletter/subscribe", handleSubscribe)
+	r.GET("/newsletter/confirm", handleConfirmSubscription)
+	r.GET("/newsletter/unsubscribe", handleUnsubscribePage)
+	r.POST("/newsletter/unsubscribe", handleUnsubscribe)
+}
+
+// siteData fills in the template fields shared by every page rendered from a gin.H
+func siteData(c *gin.Context, data gin.H) gin.H {
+	lang := requestLang(c)
+	site := languageConfig(lang)
+	common := gin.H{
+		"Pages":              getStaticPagesForLang(lang),
+		"SiteTitle":          site.SiteTitle,
+		"SiteDesc":           site.SiteDescription,
+		"SiteAuthor":         appConfig.SiteAuthor,
+		"SiteAuthorURL":      appConfig.SiteAuthorURL,
+		"CurrentYear":        getCurrentYear(),
+		"ShowSocialLinks":    appConfig.ShowSocialLinks,
+		"SocialTwitter":      appConfig.SocialTwitter,
+		"SocialBluesky":      appConfig.SocialBluesky,
+		"SocialLinkedIn":     appConfig.SocialLinkedIn,
+		"SocialGitHub":       appConfig.SocialGitHub,
+		"SocialReddit":       appConfig.SocialReddit,
+		"SocialFacebook":     appConfig.SocialFacebook,
+		"UmamiScriptURL":     appConfig.UmamiScriptURL,
+		"UmamiWebsiteID":     appConfig.UmamiWebsiteID,
+		"DisableLandingPage": appConfig.DisableLandingPage,
+		"Lang":               lang,
+		"LangPrefix":         langPrefix(lang),
+		"Languages":          languageLinks(lang, requestPath(c, lang), nil),
+		"Meta":               siteMeta(lang, "", requestPath(c, lang)).HTML(),
+		"Feeds":              feedLinks(lang, "", ""),
+		"NewsletterEnabled":  appConfig.Newsletter.Enabled,
+	}
+	for key, value := range common {
+		if _, ok := data[key]; !ok {
+			data[key] = value
+		}
+	}
+	return data
+}
+
+// renderError renders the error page with translated title and message keys
+func renderError(c *gin.Context, status int, titleKey, messageKey string) {
+	// Old URLs of moved posts and pages redirect instead
+	if status == http.StatusNotFound && redirectAlias(c) {
+		return
+	}
+	lang := requestLang(c)
+	c.HTML(status, "error.html", siteData(c, gin.H{
+		"Meta":         template.HTML(""),
+		"Error":        translate(lang, titleKey),
+		"ErrorCode":    status,
+		"ErrorMessage": translate(lang, messageKey),
+	}))
+}
+
+// isLocalizedSlug reports whether a slug names a translation file directly
+// (e.g. "first-post.nb"), which must only be reachable through its language prefix
+func isLocalizedSlug(slug string) bool {
+	_, lang := splitLangSlug(slug)
+	return lang != defaultLanguage()
+}
+
+// Home route
+func handleHome(c *gin.Context) {
+	lang := requestLang(c)
+	
+	// If landing page is disabled, redirect to posts list
+	if appConfig.DisableLandingPage {
+		c.Redirect(http.StatusMovedPermanently, langPrefix(lang)+"/posts")
+		return
+	}
+	
+	c.HTML(http.StatusOK, "index.html", siteData(c, gin.H{
+		"HomeIntro":      languageConfig(lang).HomeIntro,
+		"ShowQuickLinks": appConfig.ShowQuickLinks,
+	}))
+}
+
+// Static pages route
+func handlePage(c *gin.Context) {
+	slug := c.Param("slug")
+	lang := requestLang(c)
+	if isLocalizedSlug(slug) {
+		renderError(c, http.StatusNotFound, "page_not_found", "page_not_found_message")
+		return
+	}
+	doc, err := loadMarkdownFile("static", langFileSlug(slug, lang))
+	if err != nil {
+		log.Printf("Page not found: %s", slug)
+		renderError(c, http.StatusNotFound, "page_not_found", "page_not_found_message")
+		return
+	}
+
+	// Don't show draft pages
+	if doc.Draft {
+		log.Printf("Attempted access to draft page: %s", slug)
+		renderError(c, http.StatusNotFound, "page_not_found", "page_not_found_message")
+		return
+	}
+
+	pages := getStaticPagesForLang(lang)
+	site := languageConfig(lang)
+	// Unlisted pages are served but kept out of search engines
+	if doc.Unlisted {
+		c.Header("X-Robots-Tag", "noindex")
+	}
+
+	meta := siteMeta(lang, doc.Title, "/page/"+slug)
+	meta.Description = postDescription(doc)
+	meta.Image = absoluteURL(doc.Image)
+	meta.Breadcrumbs = append(meta.Breadcrumbs, Breadcrumb{Name: doc.Title, URL: meta.URL})
+
+	c.HTML(http.StatusOK, "page.html", Page{
+		Title:           doc.Title,
+		Content:         template.HTML(renderForms(c, doc.HTML)),
+		Meta:            meta.HTML(),
+		Pages:           pages,
+		SiteTitle:       site.SiteTitle,
+		SiteDesc:        site.SiteDescription,
+		SiteAuthor:      appConfig.SiteAuthor,
+		SiteAuthorURL:   appConfig.SiteAuthorURL,
+		IsDraft:         doc.Draft,
+		NoIndex:         doc.Unlisted,
+		CurrentYear:     getCurrentYear(),
+		ShowSocialLinks: appConfig.ShowSocialLinks,
+		SocialTwitter:   appConfig.SocialTwitter,
+		SocialBluesky:   appConfig.SocialBluesky,
+		SocialLinkedIn:  appConfig.SocialLinkedIn,
+		SocialGitHub:    appConfig.SocialGitHub,
+		SocialReddit:    appConfig.SocialReddit,
+		SocialFacebook:  appConfig.SocialFacebook,
+		UmamiScriptURL:  appConfig.UmamiScriptURL,
+		UmamiWebsiteID:  appConfig.UmamiWebsiteID,
+		DisableLandingPage: appConfig.DisableLandingPage,
+		Lang:            lang,
+		LangPrefix:      langPrefix(lang),
+		Feeds:           feedLinks(lang, "", ""),
+		Languages: languageLinks(lang, "/page/"+slug, func(l string) bool {
+			return translationExists("static", slug, l)
+		}),
+	})
+}
+
+// Blog posts list route
+func handlePosts(c *gin.Context) {
+	allPosts := getBlogPostsForLang(requestLang(c))
+	
+	page := requestPage(c)
+	
+	// Calculate pagination
+	postsPerPage := appConfig.PostsPerPage
+	totalPosts := len(allPosts)
+	totalPages := (totalPosts + postsPerPage - 1) / postsPerPage
+	
+	// Ensure page is within bounds
+	if page > totalPages && totalPages > 0 {
+		page = totalPages
+	}
+	
+	// Calculate slice bounds
+	start := (page - 1) * postsPerPage
+	end := start + postsPerPage
+	if end > totalPosts {
+		end = totalPosts
+	}
+	
+	// Get posts for current page
+	var paginatedPosts []PageLink
+	if start < totalPosts {
+		paginatedPosts = allPosts[start:end]
+	}
+	
+	lang := requestLang(c)
+	meta := siteMeta(lang, translate(lang, "posts_title"), "/posts")
+	meta.Breadcrumbs = append(meta.Breadcrumbs, Breadcrumb{Name: translate(lang, "nav_posts"), URL: meta.URL})
+
+	c.HTML(http.StatusOK, "posts.html", siteData(c, gin.H{
+		"Meta":        meta.HTML(),
+		"Posts":       paginatedPosts,
+		"PagePath":    langPrefix(lang) + "/posts",
+		"CurrentPage": page,
+		"TotalPages":  totalPages,
+		"HasPrev":     page > 1,
+		"HasNext":     page < totalPages,
+		"PrevPage":    page - 1,
+		"NextPage":    page + 1,
+	}))
+}
+
+// Individual blog post route
+func handlePost(c *gin.Context) {
+	slug := c.Param("slug")
+	lang := requestLang(c)
+	if isLocalizedSlug(slug) {
+		renderError(c, http.StatusNotFound, "post_not_found", "post_not_found_message")
+		return
+	}
+	doc, err := loadMarkdownFile("posts", langFileSlug(slug, lang))
+	if err != nil {
+		log.Printf("Post not found: %s", slug)
+		renderError(c, http.StatusNotFound, "post_not_found", "post_not_found_message")
+		return
+	}
+
+	// Don't show draft posts
+	if doc.Draft {
+		log.Printf("Attempted access to draft post: %s", slug)
+		renderError(c, http.StatusNotFound, "post_not_found", "post_not_found_message")
+		return
+	}
+
+	// Check if post is scheduled for future publication
+	if doc.PublishDate != "" {
+		pubTime, err := time.Parse("2006-01-02 15:04", doc.PublishDate)
+		if err == nil && time.Now().Before(pubTime) {
+			// Post is scheduled for the future, don't show it yet
+			log.Printf("Attempted access to scheduled post: %s (scheduled for %s)", slug, doc.PublishDate)
+			renderError(c, http.StatusNotFound, "post_not_found", "post_not_found_message")
+			return
+		}
+	}
+
+	// Fediverse servers ask for the ActivityPub version of a post
+	if appConfig.ActivityPub.Enabled {
+		c.Header("Vary", "Accept")
+		if wantsActivityJSON(c) {
+			activityJSON(c, http.StatusOK, apArticle(slug, lang, doc))
+			return
+		}
+	}
+
+	renderPost(c, slug, lang, doc, false)
+}
+
+// isPostLive reports whether a post is published: not a draft and not scheduled for later
+func isPostLive(doc *MarkdownFile) bool {
+	if doc.Draft {
+		return false
+	}
+	if doc.PublishDate != "" {
+		pubTime, err := time.Parse("2006-01-02 15:04", doc.PublishDate)
+		if err == nil && time.Now().Before(pubTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// renderPost renders a loaded post, either normally or as a signed preview
+func renderPost(c *gin.Context, slug, lang string, doc *MarkdownFile, preview bool) {
+	pages := getStaticPagesForLang(lang)
+	site := languageConfig(lang)
+	readingTime := calculateReadingTime(doc.PlainText, lang)
+
+	// Unlisted posts are reachable by URL only and kept out of search engines
+	if doc.Unlisted {
+		c.Header("X-Robots-Tag", "noindex")
+	}
+
+	// Advertise the webmention endpoint (https://www.w3.org/TR/webmention/#sender-discovers-receiver-webmention-endpoint)
+	if endpoint := webmentionEndpoint(); endpoint != "" {
+		c.Header("Link", "<"+endpoint+">; rel=\"webmention\"")
+	}
+
+	// Previews don't take comments, the post isn't public yet
+	var comments []*CommentNode
+	var commentCount int
+	showComments := commentsEnabled(doc) && !preview
+	if showComments {
+		comments, commentCount = postComments(slug, lang)
+	}
+
+	c.HTML(http.StatusOK, "post.html", Post{
+		Title:           doc.Title,
+		Slug:            slug,
+		Content:         template.HTML(renderForms(c, doc.HTML)),
+		Meta:            postMeta(lang, slug, doc).HTML(),
+		Pages:           pages,
+		Tags:            doc.Tags,
+		SiteTitle:       site.SiteTitle,
+		SiteDesc:        site.SiteDescription,
+		SiteAuthor:      appConfig.SiteAuthor,
+		SiteAuthorURL:   appConfig.SiteAuthorURL,
+		Date:            doc.Date,
+		PublishDate:     doc.PublishDate,
+		IsDraft:         doc.Draft,
+		IsPreview:       preview,
+		NoIndex:         doc.Unlisted || preview,
+		ReadingTime:     readingTime,
+		CurrentYear:     getCurrentYear(),
+		Featured:        doc.Featured,
+		ShowSocialLinks: appConfig.ShowSocialLinks,
+		SocialTwitter:   appConfig.SocialTwitter,
+		SocialBluesky:   appConfig.SocialBluesky,
+		SocialLinkedIn:  appConfig.SocialLinkedIn,
+		SocialGitHub:    appConfig.SocialGitHub,
+		SocialReddit:    appConfig.SocialReddit,
+		SocialFacebook:  appConfig.SocialFacebook,
+		UmamiScriptURL:  appConfig.UmamiScriptURL,
+		UmamiWebsiteID:  appConfig.UmamiWebsiteID,
+		DisableLandingPage: appConfig.DisableLandingPage,
+		Lang:            lang,
+		LangPrefix:      langPrefix(lang),
+		Feeds:           feedLinks(lang, "", ""),
+		Languages: languageLinks(lang, "/posts/"+slug, func(l string) bool {
+			return translationExists("posts", slug, l)
+		}),
+		CommentsEnabled: showComments,
+		Comments:        comments,
+		CommentCount:    commentCount,
+		CommentStatus:   commentStatus(c.Query("comment")),
+		ReplyTo:         findComment(comments, c.Query("reply")),
+		Webmentions:     postWebmentions(slug, lang),
+		WebmentionURL:   webmentionEndpoint(),
+		NewsletterEnabled: appConfig.Newsletter.Enabled,
 	})
+}
 
-	port := fmt.Sprintf(":%d", appConfig.Port)
-	log.Printf("Starting Podium server on %s", port)
-	if err := p.router.Run(port); err != nil {
-		log.Printf("Error starting server: %v", err)
+// requestPage returns the page number of a paginated list, from /page/:page
+// or the older ?page= query
+func requestPage(c *gin.Context) int {
+	pageStr := c.Param("page")
+	if pageStr == "" {
+		pageStr = c.DefaultQuery("page", "1")
+	}
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		return 1
 	}
+	return page
 }
 
+// Tag filtering route
+func handleTag(c *gin.Context) {
+	tag := c.Param("tag")
+	allPosts := getBlogPostsForLang(requestLang(c))
+	var filteredPosts []PageLink
+	
+	for _, post := range allPosts {
+		for _, postTag := range post.Tags {
+			if strings.EqualFold(postTag, tag) {
+				filteredPosts = append(filteredPosts, post)
+				break
+			}
+		}
+	}
+	
+	page := requestPage(c)
+	
+	// Calculate pagination
+	postsPerPage := appConfig.PostsPerPage
+	totalPosts := len(filteredPosts)
+	totalPages := (totalPosts + postsPerPage - 1) / postsPerPage
+	
+	// Ensure page is within bounds
+	if page > totalPages && totalPages > 0 {
+		page = totalPages
+	}
+	
+	// Calculate slice bounds
+	start := (page - 1) * postsPerPage
+	end := start + postsPerPage
+	if end > totalPosts {
+		end = totalPosts
+	}
+	
+	// Get posts for current page
+	var paginatedPosts []PageLink
+	if start < totalPosts {
+		paginatedPosts = filteredPosts[start:end]
+	}
+	
+	lang := requestLang(c)
+	meta := siteMeta(lang, translate(lang, "posts_tag_title", tag), "/tags/"+url.PathEscape(tag))
+	meta.Breadcrumbs = append(meta.Breadcrumbs,
+		Breadcrumb{Name: translate(lang, "nav_posts"), URL: appConfig.SiteURL + langPrefix(lang) + "/posts"},
+		Breadcrumb{Name: tag, URL: meta.URL},
+	)
+
+	c.HTML(http.StatusOK, "posts.html", siteData(c, gin.H{
+		"Meta":        meta.HTML(),
+		"Posts":       paginatedPosts,
+		"Tag":         tag,
+		"Feeds":       append(feedLinks(lang, "/tags/"+url.PathEscape(tag), tag), feedLinks(lang, "", "")...),
+		"PagePath":    langPrefix(lang) + "/tags/" + url.PathEscape(tag),
+		"CurrentPage": page,
+		"TotalPages":  totalPages,
+		"HasPrev":     page > 1,
+		"HasNext":     page < totalPages,
+		"PrevPage":    page - 1,
+		"NextPage":    page + 1,
+	}))
+}
+
+// Stop stops the watchers and schedulers, stops accepting connections and
+// lets the requests in flight finish, then waits for the background tasks
+// they started, all within shutdown_timeout. Whatever is still running after
+// that is cut off.
 func (p *program) Stop(s service.Service) error {
 	log.Println("Podium service stopping...")
-	close(p.exit)
+	timeout := time.Duration(appConfig.ShutdownTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	p.cancel()
+	if p.server != nil {
+		if err := p.server.Shutdown(ctx); err != nil {
+			log.Printf("Warning: Requests still running after %s were cut off: %v", timeout, err)
+			p.server.Close()
+		}
+	}
+
+	// Requests and schedulers may have started tasks, so wait for those last
+	stopped := make(chan struct{})
+	go func() {
+		p.loops.Wait()
+		backgroundTasks.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		select {
+		case <-stopped:
+		case <-time.After(100 * time.Millisecond):
+			log.Printf("Warning: Background tasks still running after %s were cut off", timeout)
+			return nil
+		}
+	}
+	log.Println("Podium service stopped")
 	return nil
 }
 
@@ -960,7 +1214,7 @@ func (p *program) watchConfigFile() {
 
 	for {
 		select {
-		case <-p.exit:
+		case <-p.ctx.Done():
 			// Stop watching when service is stopping
 			return
 		case event, ok := <-watcher.Events:
@@ -971,19 +1225,18 @@ func (p *program) watchConfigFile() {
 			if event.Op&fsnotify.Write == fsnotify.Write {
 				// Debounce: wait 500ms before reloading
 				debounceTimer.Reset(500 * time.Millisecond)
-				go func() {
-					<-debounceTimer.C
-					log.Printf("Config file changed - reloading...")
-					
-					// Reload config
-					config, err := loadConfig(configFile)
-					if err != nil {
-						log.Printf("Error: Failed to reload config: %v", err)
-					} else {
-						appConfig = config
-						log.Println("✓ Config reloaded successfully")
-					}
-				}()
+			}
+		case <-debounceTimer.C:
+			log.Printf("Config file changed - reloading...")
+
+			// Reload config
+			config, err := loadConfig(configFile)
+			if err != nil {
+				log.Printf("Error: Failed to reload config: %v", err)
+			} else {
+				appConfig = config
+				reloadI18n()
+				log.Println("✓ Config reloaded successfully")
 			}
 		case err, ok := <-watcher.Errors:
 			if !ok {
@@ -999,8 +1252,17 @@ func main() {
 	var devMode bool
 	flag.StringVar(&serviceAction, "service", "", "Control the system service: install, uninstall, start, stop, restart")
 	flag.BoolVar(&devMode, "dev", false, "Enable development mode with hot reload")
+	flag.Usage = usage
 	flag.Parse()
 
+	// Run a subcommand (e.g. "podium preview my-draft") instead of the server
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Get the executable path for the service
 	execPath, err := os.Executable()
 	if err != nil {
@@ -1025,9 +1287,7 @@ func main() {
 		},
 	}
 
-	prg := &program{
-		exit: make(chan struct{}),
-	}
+	prg := newProgram()
 
 	s, err := service.New(prg, svcConfig)
 	if err != nil {
@@ -1069,36 +1329,17 @@ func runWithHotReload() {
 	isDevMode = true
 	
 	// Create file watcher
-	watcher, err := fsnotify.NewWatcher()
+	watcher, err := newContentWatcher()
 	if err != nil {
 		log.Fatal("Failed to create file watcher:", err)
 	}
 	defer watcher.Close()
 
-	// Watch templates, assets, posts, static, and config
-	watchDirs := []string{"templates", "assets", "posts", "static"}
-	watchFiles := []string{"config.yaml"}
-
-	for _, dir := range watchDirs {
-		if err := watcher.Add(dir); err != nil {
-			log.Printf("Warning: Failed to watch directory %s: %v", dir, err)
-		} else {
-			log.Printf("Watching directory: %s", dir)
-		}
-	}
-
-	for _, file := range watchFiles {
-		if err := watcher.Add(file); err != nil {
-			log.Printf("Warning: Failed to watch file %s: %v", file, err)
-		} else {
-			log.Printf("Watching file: %s", file)
-		}
-	}
-
 	// Start the server in a goroutine
 	go func() {
-		prg := &program{exit: make(chan struct{})}
-		prg.Start(nil)
+		if err := newProgram().Start(nil); err != nil {
+			log.Fatal(err)
+		}
 	}()
 
 	// Watch for file changes
@@ -1119,15 +1360,7 @@ func runWithHotReload() {
 				go func() {
 					<-debounceTimer.C
 					log.Printf("File changed: %s - reloading templates and config...", event.Name)
-					
-					// Reload config
-					config, err := loadConfig("config.yaml")
-					if err != nil {
-						log.Printf("Warning: Failed to reload config: %v", err)
-					} else {
-						appConfig = config
-						log.Println("✓ Config reloaded")
-					}
+					reloadSiteConfig()
 					
 					// Templates are reloaded automatically by Gin on each request in dev mode
 					log.Println("✓ Changes detected - templates will reload on next request")
@@ -1142,6 +1375,50 @@ func runWithHotReload() {
 	}
 }
 
+// newContentWatcher watches the templates, assets, content and config the
+// site is rendered from, plus any extra directories
+func newContentWatcher(extraDirs ...string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// Watch templates, assets, posts, static, and config
+	watchDirs := append([]string{"templates", "assets", "posts", "static", appConfig.I18nFolder}, extraDirs...)
+	watchFiles := []string{"config.yaml"}
+
+	for _, dir := range watchDirs {
+		if err := watcher.Add(dir); err != nil {
+			log.Printf("Warning: Failed to watch directory %s: %v", dir, err)
+		} else {
+			log.Printf("Watching directory: %s", dir)
+		}
+	}
+
+	for _, file := range watchFiles {
+		if err := watcher.Add(file); err != nil {
+			log.Printf("Warning: Failed to watch file %s: %v", file, err)
+		} else {
+			log.Printf("Watching file: %s", file)
+		}
+	}
+	return watcher, nil
+}
+
+// reloadSiteConfig reloads config.yaml and the translated UI strings after a change
+func reloadSiteConfig() {
+	config, err := loadConfig("config.yaml")
+	if err != nil {
+		log.Printf("Warning: Failed to reload config: %v", err)
+	} else {
+		appConfig = config
+		log.Println("✓ Config reloaded")
+	}
+
+	// Reload translated UI strings
+	reloadI18n()
+}
+
 func handleServiceAction(s service.Service, action string) error {
 	switch action {
 	case "install":
@@ -1189,73 +1466,175 @@ func handleServiceAction(s service.Service, action string) error {
 	}
 }
 
+// usage prints how to run the server and the subcommands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: podium [-dev] [-service action]")
+	fmt.Fprintln(os.Stderr, "       podium <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  new       Create a post or page from its archetype")
+	fmt.Fprintln(os.Stderr, "  preview   Print a signed preview link for a draft or scheduled post")
+	fmt.Fprintln(os.Stderr, "  comments  List, approve and delete comments")
+	fmt.Fprintln(os.Stderr, "  check     Check the content for mistakes and broken links")
+	fmt.Fprintln(os.Stderr, "  build     Render the site to static files")
+	fmt.Fprintln(os.Stderr, "  deploy    Upload the built site to a deploy target")
+	fmt.Fprintln(os.Stderr, "  import    Import posts and pages from WordPress, Jekyll or Hugo")
+	fmt.Fprintln(os.Stderr, "  export    Back up the whole site to a tar.gz or zip archive")
+	fmt.Fprintln(os.Stderr, "  restore   Restore a site from an archive made by export")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Flags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run podium <command> -h for the arguments of a command.")
+}
+
+// runCommand runs a podium subcommand
+func runCommand(name string, args []string) error {
+	switch name {
+	case "preview":
+		return runPreviewCommand(args)
+	case "comments":
+		return runCommentsCommand(args)
+	case "build":
+		return runBuildCommand(args)
+	case "deploy":
+		return runDeployCommand(args)
+	case "new":
+		return runNewCommand(args)
+	case "check":
+		return runCheckCommand(args)
+	case "import":
+		return runImportCommand(args)
+	case "export":
+		return runExportCommand(args)
+	case "restore":
+		return runRestoreCommand(args)
+	default:
+		return fmt.Errorf("unknown command: %s", name)
+	}
+}
+
+// MarkdownFile holds a markdown file converted to HTML together with its front matter
+type MarkdownFile struct {
+	HTML        string
+	Title       string
+	Tags        []string
+	Date        string
+	PublishDate string
+	Updated     string
+	LastMod     string
+	Draft       bool
+	Featured    bool
+	Unlisted    bool
+	Description string
+	Image       string
+	Author      string
+	Aliases     []string // old URLs that redirect here, e.g. "/2019/05/my-post/"
+	PlainText   string
+
+	DisableComments bool
+}
+
+// frontMatterKeys lists the recognized front matter keys in normalized form
+var frontMatterKeys = map[string]bool{
+	"tags":        true,
+	"date":        true,
+	"publishdate": true,
+	"updated":     true,
+	"lastmod":     true,
+	"featured":    true,
+	"draft":       true,
+	"unlisted":    true,
+	"description": true,
+	"image":       true,
+	"author":      true,
+	"comments":    true,
+	"aliases":     true,
+}
+
+// normalizeFrontMatterKey lowercases a key and drops underscores, so
+// "PublishDate", "publishDate" and "publish_date" are the same key
+func normalizeFrontMatterKey(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", ""))
+}
+
+// parseFrontMatterLine splits a "Key: value" line into its normalized key and value
+func parseFrontMatterLine(line string) (string, string, bool) {
+	colon := strings.Index(line, ":")
+	if colon <= 0 {
+		return "", "", false
+	}
+	key := line[:colon]
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_') {
+			return "", "", false
+		}
+	}
+	return normalizeFrontMatterKey(key), strings.TrimSpace(line[colon+1:]), true
+}
+
 // loadMarkdownFile reads and converts a markdown file to HTML
-func loadMarkdownFile(folder, slug string) (string, string, []string, string, string, bool, bool, string, error) {
+func loadMarkdownFile(folder, slug string) (*MarkdownFile, error) {
 	filePath := filepath.Join(folder, slug+".md")
 	content, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		return "", "", nil, "", "", false, false, "", err
+		return nil, err
 	}
 
-	// Parse front matter for metadata (tags, date, publishDate, featured, draft)
+	// Parse front matter for metadata (tags, date, publishDate, featured, draft, unlisted)
 	lines := strings.Split(string(content), "\n")
-	var tags []string
-	title := slug
-	var date string
-	var publishDate string
-	var isDraft bool
-	var isFeatured bool
+	doc := &MarkdownFile{Title: slug}
 	var contentStartLine int
 	var frontMatterLines []int
 	
-	// Check for front matter (tags, date, publishDate, featured, draft)
+	// Check for front matter lines ("Key: value") before the title
 	for i, line := range lines {
 		if strings.HasPrefix(line, "# ") {
-			title = strings.TrimPrefix(line, "# ")
+			doc.Title = strings.TrimPrefix(line, "# ")
 			if contentStartLine == 0 {
 				contentStartLine = i
 			}
 			break
 		}
-		if strings.HasPrefix(line, "Tags:") || strings.HasPrefix(line, "tags:") {
-			tagStr := strings.TrimPrefix(line, "Tags:")
-			tagStr = strings.TrimPrefix(tagStr, "tags:")
-			tagStr = strings.TrimSpace(tagStr)
-			if tagStr != "" {
-				tagList := strings.Split(tagStr, ",")
-				for _, tag := range tagList {
-					tags = append(tags, strings.TrimSpace(tag))
+		if key, value, ok := parseFrontMatterLine(line); ok && frontMatterKeys[key] {
+			switch key {
+			case "tags":
+				if value != "" {
+					for _, tag := range strings.Split(value, ",") {
+						doc.Tags = append(doc.Tags, strings.TrimSpace(tag))
+					}
 				}
+			case "date":
+				doc.Date = value
+			case "publishdate":
+				doc.PublishDate = value
+			case "updated":
+				doc.Updated = value
+			case "lastmod":
+				doc.LastMod = value
+			case "featured":
+				doc.Featured = strings.ToLower(value) == "true"
+			case "draft":
+				doc.Draft = strings.ToLower(value) == "true"
+			case "unlisted":
+				doc.Unlisted = strings.ToLower(value) == "true"
+			case "description":
+				doc.Description = value
+			case "image":
+				doc.Image = value
+			case "author":
+				doc.Author = value
+			case "aliases":
+				for _, alias := range strings.Split(value, ",") {
+					if alias = strings.TrimSpace(alias); alias != "" {
+						doc.Aliases = append(doc.Aliases, alias)
+					}
+				}
+			case "comments":
+				doc.DisableComments = strings.ToLower(value) == "false"
 			}
 			frontMatterLines = append(frontMatterLines, i)
 		}
-		if strings.HasPrefix(line, "Date:") || strings.HasPrefix(line, "date:") {
-			date = strings.TrimPrefix(line, "Date:")
-			date = strings.TrimPrefix(date, "date:")
-			date = strings.TrimSpace(date)
-			frontMatterLines = append(frontMatterLines, i)
-		}
-		if strings.HasPrefix(line, "PublishDate:") || strings.HasPrefix(line, "publishDate:") || strings.HasPrefix(line, "publish_date:") {
-			publishDate = strings.TrimPrefix(line, "PublishDate:")
-			publishDate = strings.TrimPrefix(publishDate, "publishDate:")
-			publishDate = strings.TrimPrefix(publishDate, "publish_date:")
-			publishDate = strings.TrimSpace(publishDate)
-			frontMatterLines = append(frontMatterLines, i)
-		}
-		if strings.HasPrefix(line, "Featured:") || strings.HasPrefix(line, "featured:") {
-			featuredStr := strings.TrimPrefix(line, "Featured:")
-			featuredStr = strings.TrimPrefix(featuredStr, "featured:")
-			featuredStr = strings.TrimSpace(featuredStr)
-			isFeatured = strings.ToLower(featuredStr) == "true"
-			frontMatterLines = append(frontMatterLines, i)
-		}
-		if strings.HasPrefix(line, "Draft:") || strings.HasPrefix(line, "draft:") {
-			draftStr := strings.TrimPrefix(line, "Draft:")
-			draftStr = strings.TrimPrefix(draftStr, "draft:")
-			draftStr = strings.TrimSpace(draftStr)
-			isDraft = strings.ToLower(draftStr) == "true"
-			frontMatterLines = append(frontMatterLines, i)
-		}
 		// Don't process beyond the title
 		if i > 20 {
 			break
@@ -1281,18 +1660,18 @@ func loadMarkdownFile(folder, slug string) (string, string, []string, string, st
 		contentLines = lines
 	}
 
-	contentToRender := strings.Join(contentLines, "\n")
+	contentToRender := expandFormShortcodes(strings.Join(contentLines, "\n"))
 
 	// Convert markdown to HTML
 	html := blackfriday.Run([]byte(contentToRender))
 	
 	// Add lazy loading to images
-	htmlWithLazyLoad := addLazyLoadingToImages(string(html))
+	doc.HTML = addLazyLoadingToImages(string(html))
 	
 	// Get plain text content for excerpts
-	plainText := stripHTML(htmlWithLazyLoad)
+	doc.PlainText = stripHTML(doc.HTML)
 
-	return htmlWithLazyLoad, title, tags, date, publishDate, isDraft, isFeatured, plainText, nil
+	return doc, nil
 }
 
 // addLazyLoadingToImages adds loading="lazy" attribute to all img tags for better performance
@@ -1307,136 +1686,6 @@ func addLazyLoadingToImages(htmlContent string) string {
 	return htmlContent
 }
 
-// generateRSSFeed creates an RSS 2.0 feed XML string
-func generateRSSFeed(posts []PageLink, buildDate string) string {
-	var feed strings.Builder
-	
-	feed.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
-	feed.WriteString("\n")
-	feed.WriteString(`<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">`)
-	feed.WriteString("\n<channel>\n")
-	
-	// Channel metadata
-	feed.WriteString(fmt.Sprintf("  <title>%s</title>\n", htmlEscape(appConfig.SiteTitle)))
-	feed.WriteString(fmt.Sprintf("  <link>%s</link>\n", appConfig.SiteURL))
-	feed.WriteString(fmt.Sprintf("  <description>%s</description>\n", htmlEscape(appConfig.SiteDescription)))
-	feed.WriteString("  <language>en-us</language>\n")
-	feed.WriteString(fmt.Sprintf("  <lastBuildDate>%s</lastBuildDate>\n", buildDate))
-	feed.WriteString(fmt.Sprintf("  <atom:link href=\"%s/feed.xml\" rel=\"self\" type=\"application/rss+xml\" />\n", appConfig.SiteURL))
-	
-	// Items
-	for _, post := range posts {
-		feed.WriteString("  <item>\n")
-		feed.WriteString(fmt.Sprintf("    <title>%s</title>\n", htmlEscape(post.Title)))
-		feed.WriteString(fmt.Sprintf("    <link>%s/posts/%s</link>\n", appConfig.SiteURL, post.Slug))
-		feed.WriteString(fmt.Sprintf("    <guid>%s/posts/%s</guid>\n", appConfig.SiteURL, post.Slug))
-		
-		if post.Date != "" {
-			if parsedDate, err := time.Parse("2006-01-02", post.Date); err == nil {
-				feed.WriteString(fmt.Sprintf("    <pubDate>%s</pubDate>\n", parsedDate.Format(time.RFC1123Z)))
-			}
-		}
-		
-		// Load post content for description
-		content, _, _, _, _, _, _, _, err := loadMarkdownFile("posts", post.Slug)
-		if err == nil {
-			// Truncate content for RSS description (first 200 chars)
-			description := stripHTML(content)
-			if len(description) > 200 {
-				description = description[:200] + "..."
-			}
-			feed.WriteString(fmt.Sprintf("    <description>%s</description>\n", htmlEscape(description)))
-		}
-		
-		// Add tags as categories
-		for _, tag := range post.Tags {
-			feed.WriteString(fmt.Sprintf("    <category>%s</category>\n", htmlEscape(tag)))
-		}
-		
-		feed.WriteString("  </item>\n")
-	}
-	
-	feed.WriteString("</channel>\n</rss>")
-	return feed.String()
-}
-
-// htmlEscape escapes special characters for XML/HTML
-func htmlEscape(s string) string {
-	s = strings.ReplaceAll(s, "&", "&amp;")
-	s = strings.ReplaceAll(s, "<", "&lt;")
-	s = strings.ReplaceAll(s, ">", "&gt;")
-	s = strings.ReplaceAll(s, "\"", "&quot;")
-	s = strings.ReplaceAll(s, "'", "&#39;")
-	return s
-}
-
-// generateSitemap creates an XML sitemap for all posts and pages
-func generateSitemap(posts []PageLink, pages []PageLink) string {
-	var sitemap strings.Builder
-	
-	sitemap.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
-	sitemap.WriteString("\n")
-	sitemap.WriteString(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
-	sitemap.WriteString("\n")
-	
-	// Add homepage
-	sitemap.WriteString("  <url>\n")
-	sitemap.WriteString(fmt.Sprintf("    <loc>%s</loc>\n", appConfig.SiteURL))
-	sitemap.WriteString(fmt.Sprintf("    <lastmod>%s</lastmod>\n", time.Now().Format("2006-01-02")))
-	sitemap.WriteString("    <changefreq>daily</changefreq>\n")
-	sitemap.WriteString("    <priority>1.0</priority>\n")
-	sitemap.WriteString("  </url>\n")
-	
-	// Add posts list page
-	sitemap.WriteString("  <url>\n")
-	sitemap.WriteString(fmt.Sprintf("    <loc>%s/posts</loc>\n", appConfig.SiteURL))
-	sitemap.WriteString(fmt.Sprintf("    <lastmod>%s</lastmod>\n", time.Now().Format("2006-01-02")))
-	sitemap.WriteString("    <changefreq>daily</changefreq>\n")
-	sitemap.WriteString("    <priority>0.9</priority>\n")
-	sitemap.WriteString("  </url>\n")
-	
-	// Add individual blog posts
-	for _, post := range posts {
-		sitemap.WriteString("  <url>\n")
-		sitemap.WriteString(fmt.Sprintf("    <loc>%s/posts/%s</loc>\n", appConfig.SiteURL, post.Slug))
-		
-		if post.Date != "" {
-			if parsedDate, err := time.Parse("2006-01-02", post.Date); err == nil {
-				sitemap.WriteString(fmt.Sprintf("    <lastmod>%s</lastmod>\n", parsedDate.Format("2006-01-02")))
-			} else {
-				sitemap.WriteString(fmt.Sprintf("    <lastmod>%s</lastmod>\n", time.Now().Format("2006-01-02")))
-			}
-		} else {
-			sitemap.WriteString(fmt.Sprintf("    <lastmod>%s</lastmod>\n", time.Now().Format("2006-01-02")))
-		}
-		
-		sitemap.WriteString("    <changefreq>monthly</changefreq>\n")
-		sitemap.WriteString("    <priority>0.8</priority>\n")
-		sitemap.WriteString("  </url>\n")
-	}
-	
-	// Add static pages
-	for _, page := range pages {
-		sitemap.WriteString("  <url>\n")
-		sitemap.WriteString(fmt.Sprintf("    <loc>%s/page/%s</loc>\n", appConfig.SiteURL, page.Slug))
-		sitemap.WriteString(fmt.Sprintf("    <lastmod>%s</lastmod>\n", time.Now().Format("2006-01-02")))
-		sitemap.WriteString("    <changefreq>monthly</changefreq>\n")
-		sitemap.WriteString("    <priority>0.7</priority>\n")
-		sitemap.WriteString("  </url>\n")
-	}
-	
-	// Add RSS feed
-	sitemap.WriteString("  <url>\n")
-	sitemap.WriteString(fmt.Sprintf("    <loc>%s/feed.xml</loc>\n", appConfig.SiteURL))
-	sitemap.WriteString(fmt.Sprintf("    <lastmod>%s</lastmod>\n", time.Now().Format("2006-01-02")))
-	sitemap.WriteString("    <changefreq>daily</changefreq>\n")
-	sitemap.WriteString("    <priority>0.5</priority>\n")
-	sitemap.WriteString("  </url>\n")
-	
-	sitemap.WriteString("</urlset>\n")
-	return sitemap.String()
-}
-
 // stripHTML removes HTML tags from a string (simple implementation)
 func stripHTML(s string) string {
 	// Simple regex-free approach: remove everything between < and >
@@ -1482,19 +1731,37 @@ func generateExcerpt(text string, maxLength int) string {
 	return excerpt + "..."
 }
 
+// slugify turns a name into a lowercase URL slug, e.g. "Jane Doe" -> "jane-doe"
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
 // calculateReadingTime estimates reading time based on word count
 // Average reading speed: 200-250 words per minute (using 225)
-func calculateReadingTime(text string) string {
+func calculateReadingTime(text string, lang string) string {
 	words := len(strings.Fields(text))
 	minutes := words / 225
 	
 	if minutes < 1 {
-		return "< 1 min read"
+		return translate(lang, "reading_time_short")
 	} else if minutes == 1 {
-		return "1 min read"
+		return translate(lang, "reading_time_one")
 	}
 	
-	return fmt.Sprintf("%d min read", minutes)
+	return translate(lang, "reading_time", minutes)
 }
 
 // getCurrentYear returns the current year as a string
@@ -1502,8 +1769,13 @@ func getCurrentYear() string {
 	return fmt.Sprintf("%d", time.Now().Year())
 }
 
-// getStaticPages scans the static folder and returns all available pages
+// getStaticPages returns all available pages in the default language
 func getStaticPages() []PageLink {
+	return getStaticPagesForLang(defaultLanguage())
+}
+
+// getStaticPagesForLang scans the static folder and returns all available pages in a language
+func getStaticPagesForLang(lang string) []PageLink {
 	var pages []PageLink
 
 	files, err := ioutil.ReadDir("static")
@@ -1514,22 +1786,26 @@ func getStaticPages() []PageLink {
 
 	for _, file := range files {
 		if !file.IsDir() && strings.HasSuffix(file.Name(), ".md") {
-			slug := strings.TrimSuffix(file.Name(), ".md")
+			slug, fileLang := splitLangSlug(strings.TrimSuffix(file.Name(), ".md"))
+			if fileLang != lang {
+				continue
+			}
 			
 			// Read file to get title and draft status
-			_, title, _, _, _, isDraft, _, _, err := loadMarkdownFile("static", slug)
+			doc, err := loadMarkdownFile("static", langFileSlug(slug, lang))
 			if err != nil {
 				continue
 			}
 
-			// Skip draft pages
-			if isDraft {
+			// Skip draft and unlisted pages
+			if doc.Draft || doc.Unlisted {
 				continue
 			}
 
 			pages = append(pages, PageLink{
-				Title: title,
+				Title: doc.Title,
 				Slug:  slug,
+				Lang:  lang,
 			})
 		}
 	}
@@ -1537,8 +1813,13 @@ func getStaticPages() []PageLink {
 	return pages
 }
 
-// getBlogPosts scans the posts folder and returns all available posts
+// getBlogPosts returns all available posts in the default language
 func getBlogPosts() []PageLink {
+	return getBlogPostsForLang(defaultLanguage())
+}
+
+// getBlogPostsForLang scans the posts folder and returns all available posts in a language
+func getBlogPostsForLang(lang string) []PageLink {
 	var posts []PageLink
 	var featuredPosts []PageLink
 
@@ -1550,22 +1831,30 @@ func getBlogPosts() []PageLink {
 
 	for _, file := range files {
 		if !file.IsDir() && strings.HasSuffix(file.Name(), ".md") {
-			slug := strings.TrimSuffix(file.Name(), ".md")
+			slug, fileLang := splitLangSlug(strings.TrimSuffix(file.Name(), ".md"))
+			if fileLang != lang {
+				continue
+			}
 			
 			// Read file to get title, tags, date, publishDate, draft status, featured, and content for excerpt
-			_, title, tags, date, publishDate, isDraft, isFeatured, plainText, err := loadMarkdownFile("posts", slug)
+			doc, err := loadMarkdownFile("posts", langFileSlug(slug, lang))
 			if err != nil {
 				continue
 			}
 
 			// Skip draft posts
-			if isDraft {
+			if doc.Draft {
+				continue
+			}
+
+			// Skip unlisted posts, they are reachable by URL only
+			if doc.Unlisted {
 				continue
 			}
 
 			// Check if post is scheduled for future publication
-			if publishDate != "" {
-				pubTime, err := time.Parse("2006-01-02 15:04", publishDate)
+			if doc.PublishDate != "" {
+				pubTime, err := time.Parse("2006-01-02 15:04", doc.PublishDate)
 				if err == nil && time.Now().Before(pubTime) {
 					// Post is scheduled for the future, skip it
 					continue
@@ -1573,22 +1862,24 @@ func getBlogPosts() []PageLink {
 			}
 			
 			// Generate excerpt and reading time
-			excerpt := generateExcerpt(plainText, appConfig.ExcerptLength)
-			readingTime := calculateReadingTime(plainText)
+			excerpt := generateExcerpt(doc.PlainText, appConfig.ExcerptLength)
+			readingTime := calculateReadingTime(doc.PlainText, lang)
 
 			postLink := PageLink{
-				Title:       title,
+				Title:       doc.Title,
 				Slug:        slug,
-				Tags:        tags,
-				Date:        date,
-				PublishDate: publishDate,
+				Tags:        doc.Tags,
+				Date:        doc.Date,
+				PublishDate: doc.PublishDate,
 				Excerpt:     excerpt,
 				ReadingTime: readingTime,
-				Featured:    isFeatured,
+				Featured:    doc.Featured,
+				Lang:        lang,
+				Author:      doc.Author,
 			}
 
 			// Separate featured and regular posts
-			if isFeatured {
+			if doc.Featured {
 				featuredPosts = append(featuredPosts, postLink)
 			} else {
 				posts = append(posts, postLink)
@@ -1656,15 +1947,8 @@ func init() {
 	}
 
 	// Set defaults for optional fields if not provided
-	if appConfig.PostsPerPage == 0 {
-		appConfig.PostsPerPage = 10
-	}
-	if appConfig.FeedItems == 0 {
-		appConfig.FeedItems = 20
-	}
-	if appConfig.SiteURL == "" {
-		appConfig.SiteURL = fmt.Sprintf("http://localhost:%d", appConfig.Port)
-	}
+	applyConfigDefaults(&appConfig)
+	reloadI18n()
 
 	folders := []string{appConfig.StaticFolder, appConfig.PostsFolder, appConfig.TemplatesFolder, appConfig.AssetsFolder}
 	for _, folder := range folders {
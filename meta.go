@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+)
+
+// PageMeta describes a page for Open Graph, Twitter Card and JSON-LD metadata
+type PageMeta struct {
+	Type        string // "website" or "article"
+	Title       string
+	Description string
+	URL         string
+	Image       string
+	ImageWidth  int
+	ImageHeight int
+	Lang        string
+	Published   string
+	Modified    string
+	Author      string
+	Tags        []string
+	Breadcrumbs []Breadcrumb
+}
+
+// Breadcrumb is one step of a BreadcrumbList
+type Breadcrumb struct {
+	Name string
+	URL  string
+}
+
+// metaTemplate renders the metadata block that templates include with {{.Meta}}
+var metaTemplate = template.Must(template.New("meta").Parse(`<meta name="description" content="{{.Description}}" />
+    <link rel="canonical" href="{{.URL}}" />
+    <meta property="og:type" content="{{.Type}}" />
+    <meta property="og:site_name" content="{{.SiteName}}" />
+    <meta property="og:title" content="{{.Title}}" />
+    <meta property="og:description" content="{{.Description}}" />
+    <meta property="og:url" content="{{.URL}}" />
+    <meta property="og:locale" content="{{.Locale}}" />
+    {{- if .Image}}
+    <meta property="og:image" content="{{.Image}}" />
+    {{- end}}
+    {{- if .ImageWidth}}
+    <meta property="og:image:width" content="{{.ImageWidth}}" />
+    <meta property="og:image:height" content="{{.ImageHeight}}" />
+    {{- end}}
+    {{- if .Published}}
+    <meta property="article:published_time" content="{{.Published}}" />
+    {{- end}}
+    {{- if .Modified}}
+    <meta property="article:modified_time" content="{{.Modified}}" />
+    {{- end}}
+    {{- if and (eq .Type "article") .Author}}
+    <meta property="article:author" content="{{.Author}}" />
+    {{- end}}
+    {{- range .Tags}}
+    <meta property="article:tag" content="{{.}}" />
+    {{- end}}
+    <meta name="twitter:card" content="{{if .Image}}summary_large_image{{else}}summary{{end}}" />
+    {{- if .TwitterSite}}
+    <meta name="twitter:site" content="{{.TwitterSite}}" />
+    {{- end}}
+    <meta name="twitter:title" content="{{.Title}}" />
+    <meta name="twitter:description" content="{{.Description}}" />
+    {{- if .Image}}
+    <meta name="twitter:image" content="{{.Image}}" />
+    {{- end}}
+    <script type="application/ld+json">{{.JSONLD}}</script>`))
+
+// siteMeta returns the metadata of a plain page of the site in a language,
+// with a breadcrumb trail starting at the language's home page
+func siteMeta(lang, title, path string) PageMeta {
+	site := languageConfig(lang)
+	meta := PageMeta{
+		Type:        "website",
+		Title:       site.SiteTitle,
+		Description: site.SiteDescription,
+		URL:         appConfig.SiteURL + langPrefix(lang) + path,
+		Lang:        lang,
+		Breadcrumbs: []Breadcrumb{{Name: translate(lang, "nav_home"), URL: appConfig.SiteURL + langPrefix(lang) + "/"}},
+	}
+	if title != "" {
+		meta.Title = title + " - " + site.SiteTitle
+	}
+	return meta
+}
+
+// postMeta returns the article metadata of a post
+func postMeta(lang, slug string, doc *MarkdownFile) PageMeta {
+	meta := siteMeta(lang, "", "/posts/"+slug)
+	meta.Type = "article"
+	meta.Title = doc.Title
+	meta.Description = postDescription(doc)
+	meta.Image = absoluteURL(doc.Image)
+	if meta.Image == "" {
+		// Fall back to the generated preview image
+		meta.Image = meta.URL + "/og.png"
+		meta.ImageWidth, meta.ImageHeight = ogWidth, ogHeight
+	}
+	meta.Published = metaDate(doc.Date, doc.PublishDate)
+	meta.Modified = meta.Published
+	if doc.Updated != "" {
+		if modified := metaDate(doc.Updated, doc.Updated); modified != "" {
+			meta.Modified = modified
+		}
+	}
+	meta.Author = doc.Author
+	if meta.Author == "" {
+		meta.Author = appConfig.SiteAuthor
+	}
+	meta.Tags = doc.Tags
+	meta.Breadcrumbs = append(meta.Breadcrumbs,
+		Breadcrumb{Name: translate(lang, "nav_posts"), URL: appConfig.SiteURL + langPrefix(lang) + "/posts"},
+		Breadcrumb{Name: doc.Title, URL: meta.URL},
+	)
+	return meta
+}
+
+// postDescription returns the front matter description of a post, or a short excerpt
+func postDescription(doc *MarkdownFile) string {
+	if doc.Description != "" {
+		return doc.Description
+	}
+	// The plain text starts with the title heading, which is already in og:title
+	text := strings.TrimSpace(strings.TrimPrefix(doc.PlainText, doc.Title))
+	return generateExcerpt(text, 160)
+}
+
+// absoluteURL turns a site-relative URL (e.g. /assets/cover.jpg) into an absolute one
+func absoluteURL(u string) string {
+	if u == "" || strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+		return u
+	}
+	if !strings.HasPrefix(u, "/") {
+		u = "/" + u
+	}
+	return appConfig.SiteURL + u
+}
+
+// metaDate converts front matter dates to ISO 8601, preferring the publish date
+func metaDate(date, publishDate string) string {
+	if publishDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02 15:04", publishDate, time.Local); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	if _, err := time.Parse("2006-01-02", date); err == nil {
+		return date
+	}
+	return ""
+}
+
+// ogLocale converts a locale such as "en-us" to the Open Graph form "en_US"
+func ogLocale(locale string) string {
+	parts := strings.SplitN(locale, "-", 2)
+	if len(parts) == 2 {
+		return strings.ToLower(parts[0]) + "_" + strings.ToUpper(parts[1])
+	}
+	return locale
+}
+
+// twitterHandle extracts "@name" from a Twitter/X profile URL
+func twitterHandle(profileURL string) string {
+	profileURL = strings.TrimRight(profileURL, "/")
+	if profileURL == "" {
+		return ""
+	}
+	return "@" + profileURL[strings.LastIndex(profileURL, "/")+1:]
+}
+
+// jsonLD builds the schema.org graph for the page
+func (m PageMeta) jsonLD() map[string]interface{} {
+	site := languageConfig(m.Lang)
+	var graph []interface{}
+
+	if m.Type == "article" {
+		author := map[string]interface{}{"@type": "Person", "name": m.Author}
+		if m.Author == appConfig.SiteAuthor && appConfig.SiteAuthorURL != "" {
+			author["url"] = appConfig.SiteAuthorURL
+		}
+		posting := map[string]interface{}{
+			"@type":            "BlogPosting",
+			"headline":         m.Title,
+			"description":      m.Description,
+			"url":              m.URL,
+			"mainEntityOfPage": m.URL,
+			"inLanguage":       m.Lang,
+			"author":           author,
+			"publisher": map[string]interface{}{
+				"@type": "Organization",
+				"name":  site.SiteTitle,
+				"url":   appConfig.SiteURL,
+			},
+		}
+		if m.Published != "" {
+			posting["datePublished"] = m.Published
+			posting["dateModified"] = m.Modified
+		}
+		if m.Image != "" {
+			posting["image"] = m.Image
+		}
+		if len(m.Tags) > 0 {
+			posting["keywords"] = strings.Join(m.Tags, ", ")
+		}
+		graph = append(graph, posting)
+	} else if len(m.Breadcrumbs) <= 1 {
+		graph = append(graph, map[string]interface{}{
+			"@type":       "WebSite",
+			"name":        site.SiteTitle,
+			"description": site.SiteDescription,
+			"url":         m.URL,
+			"inLanguage":  m.Lang,
+		})
+	}
+
+	if len(m.Breadcrumbs) > 1 {
+		var items []interface{}
+		for i, crumb := range m.Breadcrumbs {
+			items = append(items, map[string]interface{}{
+				"@type":    "ListItem",
+				"position": i + 1,
+				"name":     crumb.Name,
+				"item":     crumb.URL,
+			})
+		}
+		graph = append(graph, map[string]interface{}{
+			"@type":           "BreadcrumbList",
+			"itemListElement": items,
+		})
+	}
+
+	return map[string]interface{}{
+		"@context": "https://schema.org",
+		"@graph":   graph,
+	}
+}
+
+// HTML renders the Open Graph, Twitter Card and JSON-LD block for the page
+func (m PageMeta) HTML() template.HTML {
+	// json.Marshal escapes <, > and &, so the result is safe inside <script>
+	ld, err := json.Marshal(m.jsonLD())
+	if err != nil {
+		log.Printf("Warning: Failed to build JSON-LD: %v", err)
+		ld = []byte("{}")
+	}
+
+	var buf bytes.Buffer
+	err = metaTemplate.Execute(&buf, struct {
+		PageMeta
+		SiteName    string
+		Locale      string
+		TwitterSite string
+		JSONLD      template.JS
+	}{
+		PageMeta:    m,
+		SiteName:    languageConfig(m.Lang).SiteTitle,
+		Locale:      ogLocale(languageConfig(m.Lang).Locale),
+		TwitterSite: twitterHandle(appConfig.SocialTwitter),
+		JSONLD:      template.JS(ld),
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to render page metadata: %v", err)
+		return ""
+	}
+	return template.HTML(buf.String())
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// archetypeData is the data archetypes/<kind>.md templates are executed with
+type archetypeData struct {
+	Title  string
+	Slug   string
+	Date   string // today, as 2006-01-02
+	Author string // site_author from the config
+	Lang   string
+}
+
+// contentKinds maps the kinds `podium new` creates to their content folders
+var contentKinds = map[string]string{
+	"post": "posts",
+	"page": "static",
+}
+
+// defaultArchetypes are used when archetypes/<kind>.md doesn't exist
+var defaultArchetypes = map[string]string{
+	"post": `Tags:
+Date: {{ .Date }}
+Author: {{ .Author }}
+Draft: true
+
+# {{ .Title }}
+
+`,
+	"page": `Draft: true
+
+# {{ .Title }}
+
+`,
+}
+
+// runNewCommand creates a post or page from its archetype
+func runNewCommand(args []string) error {
+	fs := flag.NewFlagSet("new", flag.ExitOnError)
+	lang := fs.String("lang", defaultLanguage(), "Language of the new post or page")
+	edit := fs.Bool("edit", false, "Open the new file in $EDITOR")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: podium new post [-lang code] [-edit] <title>")
+		fmt.Fprintln(os.Stderr, "       podium new page [-lang code] [-edit] <title>")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("new needs a kind: post or page")
+	}
+	kind := args[0]
+	folder, ok := contentKinds[kind]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown kind %q, use post or page", kind)
+	}
+	fs.Parse(args[1:])
+	title := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if title == "" {
+		fs.Usage()
+		return errors.New("new needs a title")
+	}
+	if !isLanguage(*lang) {
+		return fmt.Errorf("unknown language %q", *lang)
+	}
+
+	slug := slugify(title)
+	if slug == "" {
+		return fmt.Errorf("%q has no letters or digits to make a slug from", title)
+	}
+	content, err := renderArchetype(kind, archetypeData{
+		Title:  title,
+		Slug:   slug,
+		Date:   time.Now().Format("2006-01-02"),
+		Author: appConfig.SiteAuthor,
+		Lang:   *lang,
+	})
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(folder, langFileSlug(slug, *lang)+".md")
+	if err := writeNewFile(file, content); err != nil {
+		return err
+	}
+	fmt.Printf("Created %s\n", file)
+
+	if *edit {
+		return openEditor(file)
+	}
+	return nil
+}
+
+// renderArchetype executes archetypes/<kind>.md, or the built-in archetype
+// when the site has none
+func renderArchetype(kind string, data archetypeData) ([]byte, error) {
+	name := filepath.Join("archetypes", kind+".md")
+	source := defaultArchetypes[kind]
+	if content, err := ioutil.ReadFile(name); err == nil {
+		source = string(content)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	tmpl, err := template.New(name).Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// writeNewFile creates a file, failing when it already exists
+func writeNewFile(file string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists", file)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// openEditor opens a file in $EDITOR (or $VISUAL), which may include arguments
+// such as "code --wait"
+func openEditor(file string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	fields := strings.Fields(editor)
+	if len(fields) == 0 {
+		return errors.New("set $EDITOR to open the new file")
+	}
+	cmd := exec.Command(fields[0], append(fields[1:], file)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
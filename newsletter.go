@@ -0,0 +1,392 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewsletterConfig controls email subscriptions. Mail is sent through the smtp settings.
+type NewsletterConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Mode      string `yaml:"mode"`       // "post" mails every new post, "digest" sends a weekly summary
+	DigestDay string `yaml:"digest_day"` // weekday the digest goes out, e.g. "monday"
+}
+
+// Subscriber is a newsletter subscriber, stored in data/subscribers.json. The
+// token confirms the subscription and is part of every unsubscribe link.
+type Subscriber struct {
+	Email       string    `json:"email"`
+	Lang        string    `json:"lang"`
+	Token       string    `json:"token"`
+	Confirmed   bool      `json:"confirmed"`
+	Created     time.Time `json:"created"`
+	ConfirmedAt time.Time `json:"confirmed_at,omitempty"`
+}
+
+// newsletterState is kept in data/newsletter.json: posts waiting for the next
+// digest and when the last digest went out
+type newsletterState struct {
+	LastDigest time.Time        `json:"last_digest"`
+	Pending    []newsletterPost `json:"pending"`
+}
+
+// newsletterPost is a post announced in a newsletter email
+type newsletterPost struct {
+	Slug    string `json:"slug"`
+	Lang    string `json:"lang"`
+	Title   string `json:"-"`
+	URL     string `json:"-"`
+	Excerpt string `json:"-"`
+}
+
+// newsletterMail is the data passed to the templates in templates/email/
+type newsletterMail struct {
+	Lang           string
+	SiteTitle      string
+	SiteURL        string
+	ConfirmURL     string
+	UnsubscribeURL string
+	Posts          []newsletterPost
+}
+
+const newsletterRateLimit = 5 // subscribe requests per IP per 10 minutes
+
+var (
+	subscriberStore   = newJSONStore("subscribers.json")
+	newsletterStore   = newJSONStore("newsletter.json")
+	newsletterLimiter = newRateLimiter(10 * time.Minute)
+)
+
+func init() {
+	onPublish(queueNewsletter)
+}
+
+// renderMessage renders a short page with a translated title and message
+func renderMessage(c *gin.Context, status int, titleKey, messageKey string) {
+	lang := requestLang(c)
+	renderMessagePage(c, status, translate(lang, titleKey),
+		template.HTML("<p>"+html.EscapeString(translate(lang, messageKey))+"</p>"))
+}
+
+// renderMessagePage renders a page that is not backed by a markdown file
+func renderMessagePage(c *gin.Context, status int, title string, content template.HTML) {
+	lang := requestLang(c)
+	c.HTML(status, "page.html", siteData(c, gin.H{
+		"Title":     title,
+		"Content":   template.HTML("<h1>"+html.EscapeString(title)+"</h1>") + content,
+		"NoIndex":   true,
+		"Languages": languageLinks(lang, "/", nil),
+	}))
+}
+
+// newsletterURL returns the absolute URL of a newsletter route for a subscriber
+func newsletterURL(sub Subscriber, action string) string {
+	return appConfig.SiteURL + langPrefix(sub.Lang) + "/newsletter/" + action + "?token=" + sub.Token
+}
+
+// handleSubscribe starts a subscription and mails the confirmation link (double opt-in).
+// The response is the same whether or not the address was already subscribed.
+func handleSubscribe(c *gin.Context) {
+	if !appConfig.Newsletter.Enabled {
+		renderError(c, http.StatusNotFound, "page_not_found", "page_not_found_message")
+		return
+	}
+	lang := requestLang(c)
+
+	if honeypotFilled(c) {
+		log.Printf("Dropped newsletter subscription: honeypot filled in")
+		renderMessage(c, http.StatusOK, "newsletter_check_title", "newsletter_check_message")
+		return
+	}
+	if !newsletterLimiter.Allow(c.ClientIP(), newsletterRateLimit) {
+		log.Printf("Rate limited newsletter subscription from %s", c.ClientIP())
+		renderMessage(c, http.StatusTooManyRequests, "newsletter_error_title", "newsletter_rate_limited")
+		return
+	}
+
+	email := strings.TrimSpace(c.PostForm("email"))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > 254 {
+		renderMessage(c, http.StatusBadRequest, "newsletter_error_title", "newsletter_invalid_email")
+		return
+	}
+
+	var sub Subscriber
+	var subscribers []Subscriber
+	err = subscriberStore.Update(&subscribers, func() error {
+		for _, existing := range subscribers {
+			if strings.EqualFold(existing.Email, email) && existing.Lang == lang {
+				sub = existing
+				return nil
+			}
+		}
+		sub = Subscriber{Email: email, Lang: lang, Token: randomID(16), Created: time.Now()}
+		subscribers = append(subscribers, sub)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error saving subscriber: %v", err)
+		renderError(c, http.StatusInternalServerError, "internal_error", "internal_error_message")
+		return
+	}
+
+	if !sub.Confirmed {
+		msg := mailMessage{
+			To:      sub.Email,
+			Subject: translate(lang, "newsletter_confirm_subject", languageConfig(lang).SiteTitle),
+		}
+		data := newsletterMail{
+			Lang:       lang,
+			SiteTitle:  languageConfig(lang).SiteTitle,
+			SiteURL:    appConfig.SiteURL + langPrefix(lang) + "/",
+			ConfirmURL: newsletterURL(sub, "confirm"),
+		}
+		if err := renderMailTemplates(&msg, "confirm", data); err == nil {
+			err = sendMail(msg)
+		}
+		if err != nil {
+			log.Printf("Error sending newsletter confirmation: %v", err)
+			renderMessage(c, http.StatusInternalServerError, "newsletter_error_title", "newsletter_send_failed")
+			return
+		}
+		log.Printf("Sent newsletter confirmation (%s)", lang)
+	}
+	renderMessage(c, http.StatusOK, "newsletter_check_title", "newsletter_check_message")
+}
+
+// handleConfirmSubscription confirms a subscription from the link in the confirmation email
+func handleConfirmSubscription(c *gin.Context) {
+	token := c.Query("token")
+	found := false
+	var subscribers []Subscriber
+	err := subscriberStore.Update(&subscribers, func() error {
+		for i := range subscribers {
+			if token != "" && subscribers[i].Token == token {
+				found = true
+				if !subscribers[i].Confirmed {
+					subscribers[i].Confirmed = true
+					subscribers[i].ConfirmedAt = time.Now()
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error confirming subscriber: %v", err)
+		renderError(c, http.StatusInternalServerError, "internal_error", "internal_error_message")
+		return
+	}
+	if !found {
+		renderMessage(c, http.StatusNotFound, "newsletter_invalid_title", "newsletter_invalid_message")
+		return
+	}
+	renderMessage(c, http.StatusOK, "newsletter_confirmed_title", "newsletter_confirmed_message")
+}
+
+// handleUnsubscribePage asks for confirmation, so link scanners in mail
+// clients cannot unsubscribe people by following the link
+func handleUnsubscribePage(c *gin.Context) {
+	lang := requestLang(c)
+	token := c.Query("token")
+	if findSubscriber(token) == nil {
+		renderMessage(c, http.StatusNotFound, "newsletter_invalid_title", "newsletter_invalid_message")
+		return
+	}
+	form := fmt.Sprintf(`<p>%s</p><form method="post" action="%s/newsletter/unsubscribe?token=%s"><button type="submit">%s</button></form>`,
+		html.EscapeString(translate(lang, "newsletter_unsubscribe_message")),
+		langPrefix(lang), html.EscapeString(token),
+		html.EscapeString(translate(lang, "newsletter_unsubscribe_button")))
+	renderMessagePage(c, http.StatusOK, translate(lang, "newsletter_unsubscribe_title"), template.HTML(form))
+}
+
+// handleUnsubscribe removes a subscriber. It also serves one-click unsubscribe
+// requests from mail clients (RFC 8058).
+func handleUnsubscribe(c *gin.Context) {
+	token := c.Query("token")
+	found := false
+	var subscribers []Subscriber
+	err := subscriberStore.Update(&subscribers, func() error {
+		kept := subscribers[:0]
+		for _, sub := range subscribers {
+			if token != "" && sub.Token == token {
+				found = true
+				continue
+			}
+			kept = append(kept, sub)
+		}
+		subscribers = kept
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error removing subscriber: %v", err)
+		renderError(c, http.StatusInternalServerError, "internal_error", "internal_error_message")
+		return
+	}
+	if !found {
+		renderMessage(c, http.StatusNotFound, "newsletter_invalid_title", "newsletter_invalid_message")
+		return
+	}
+	log.Printf("Newsletter subscriber removed")
+	renderMessage(c, http.StatusOK, "newsletter_unsubscribed_title", "newsletter_unsubscribed_message")
+}
+
+// findSubscriber returns the subscriber with a token, or nil
+func findSubscriber(token string) *Subscriber {
+	if token == "" {
+		return nil
+	}
+	var subscribers []Subscriber
+	if err := subscriberStore.Read(&subscribers); err != nil {
+		log.Printf("Warning: Failed to read subscribers: %v", err)
+		return nil
+	}
+	for _, sub := range subscribers {
+		if sub.Token == token {
+			return &sub
+		}
+	}
+	return nil
+}
+
+// queueNewsletter is the publish hook: it mails new posts straight away in
+// "post" mode and queues them for the next digest in "digest" mode
+func queueNewsletter(ev PublishEvent) {
+	if !appConfig.Newsletter.Enabled || ev.Updated {
+		return
+	}
+	post := newsletterPost{Slug: ev.Slug, Lang: ev.Lang}
+	if appConfig.Newsletter.Mode == "digest" {
+		var state newsletterState
+		err := newsletterStore.Update(&state, func() error {
+			for _, pending := range state.Pending {
+				if pending == post {
+					return nil
+				}
+			}
+			state.Pending = append(state.Pending, post)
+			return nil
+		})
+		if err != nil {
+			log.Printf("Warning: Failed to queue %s for the newsletter digest: %v", ev.URL, err)
+		}
+		return
+	}
+
+	post.Title = ev.Doc.Title
+	post.URL = ev.URL
+	post.Excerpt = postDescription(ev.Doc)
+	subject := fmt.Sprintf("%s: %s", languageConfig(ev.Lang).SiteTitle, post.Title)
+	goBackground(func() { sendNewsletter(ev.Lang, "post", subject, []newsletterPost{post}) })
+}
+
+// sendNewsletter mails posts to every confirmed subscriber of a language
+func sendNewsletter(lang, templateName, subject string, posts []newsletterPost) {
+	var subscribers []Subscriber
+	if err := subscriberStore.Read(&subscribers); err != nil {
+		log.Printf("Warning: Failed to read subscribers: %v", err)
+		return
+	}
+
+	sent, failed := 0, 0
+	for _, sub := range subscribers {
+		if !sub.Confirmed || sub.Lang != lang {
+			continue
+		}
+		unsubscribe := newsletterURL(sub, "unsubscribe")
+		msg := mailMessage{
+			To:      sub.Email,
+			Subject: subject,
+			Headers: map[string]string{
+				"List-Unsubscribe":      "<" + unsubscribe + ">",
+				"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+			},
+		}
+		data := newsletterMail{
+			Lang:           lang,
+			SiteTitle:      languageConfig(lang).SiteTitle,
+			SiteURL:        appConfig.SiteURL + langPrefix(lang) + "/",
+			UnsubscribeURL: unsubscribe,
+			Posts:          posts,
+		}
+		if err := renderMailTemplates(&msg, templateName, data); err != nil {
+			log.Printf("Error rendering newsletter email: %v", err)
+			return
+		}
+		if err := sendMail(msg); err != nil {
+			log.Printf("Warning: Failed to send newsletter to a subscriber: %v", err)
+			failed++
+			continue
+		}
+		sent++
+	}
+	if sent > 0 || failed > 0 {
+		log.Printf("Newsletter (%s, %s): sent %d, failed %d", templateName, lang, sent, failed)
+	}
+}
+
+// sendDigestIfDue sends the weekly digest of queued posts on the configured weekday
+func sendDigestIfDue(now time.Time) {
+	if !appConfig.Newsletter.Enabled || appConfig.Newsletter.Mode != "digest" {
+		return
+	}
+	if !strings.EqualFold(now.Weekday().String(), appConfig.Newsletter.DigestDay) {
+		return
+	}
+
+	var pending []newsletterPost
+	var state newsletterState
+	err := newsletterStore.Update(&state, func() error {
+		if now.Sub(state.LastDigest) < 24*time.Hour {
+			return nil
+		}
+		pending = state.Pending
+		state.Pending = nil
+		state.LastDigest = now
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to update newsletter state: %v", err)
+		return
+	}
+
+	byLang := map[string][]newsletterPost{}
+	for _, post := range pending {
+		// Skip posts that were deleted or unpublished since they were queued
+		doc, err := loadMarkdownFile("posts", langFileSlug(post.Slug, post.Lang))
+		if err != nil || !isPostLive(doc) {
+			continue
+		}
+		post.Title = doc.Title
+		post.URL = appConfig.SiteURL + langPrefix(post.Lang) + "/posts/" + post.Slug
+		post.Excerpt = postDescription(doc)
+		byLang[post.Lang] = append(byLang[post.Lang], post)
+	}
+	for lang, posts := range byLang {
+		subject := translate(lang, "newsletter_digest_subject", languageConfig(lang).SiteTitle)
+		sendNewsletter(lang, "digest", subject, posts)
+	}
+}
+
+// watchDigests checks every hour whether the weekly digest is due, until the service stops
+func (p *program) watchDigests() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	sendDigestIfDue(time.Now())
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case now := <-ticker.C:
+			sendDigestIfDue(now)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSMTP is an in-process SMTP server that keeps every message it receives
+type fakeSMTP struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	messages []receivedMail
+}
+
+// receivedMail is a message as delivered, with its parts decoded
+type receivedMail struct {
+	From, To string
+	Header   mail.Header
+	Subject  string
+	Text     string
+	HTML     string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(t, conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) handle(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	var from, to string
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "MAIL":
+			from = strings.Trim(line[strings.Index(line, ":")+1:], "<> ")
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			to = strings.Trim(line[strings.Index(line, ":")+1:], "<> ")
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg, err := parseReceivedMail(data)
+			if err != nil {
+				t.Errorf("malformed message: %v\n%s", err, data)
+			}
+			msg.From, msg.To = from, to
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *fakeSMTP) received() []receivedMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]receivedMail(nil), s.messages...)
+}
+
+// parseReceivedMail decodes the subject and the text and HTML parts of a
+// multipart/alternative message
+func parseReceivedMail(data []byte) (receivedMail, error) {
+	var msg receivedMail
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return msg, err
+	}
+	msg.Header = m.Header
+	if msg.Subject, err = new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject")); err != nil {
+		return msg, err
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		return msg, err
+	}
+	if mediaType != "multipart/alternative" {
+		return msg, fmt.Errorf("content type %s, want multipart/alternative", mediaType)
+	}
+	parts := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			break
+		}
+		// NextPart already undoes the quoted-printable encoding
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			return msg, err
+		}
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			msg.Text = string(body)
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			msg.HTML = string(body)
+		}
+	}
+	return msg, nil
+}
+
+var newsletterLink = regexp.MustCompile(`https?://\S+/newsletter/(confirm|unsubscribe)\?token=\w+`)
+
+func TestNewsletterDoubleOptIn(t *testing.T) {
+	useTestNetwork(t)
+	smtpServer := newFakeSMTP(t)
+	smtpConfig, newsletterConfig := appConfig.SMTP, appConfig.Newsletter
+	appConfig.SMTP = SMTPConfig{Host: "127.0.0.1", Port: smtpServer.ln.Addr().(*net.TCPAddr).Port, From: "Blog <blog@example.com>"}
+	appConfig.Newsletter = NewsletterConfig{Enabled: true, Mode: "post"}
+	t.Cleanup(func() { appConfig.SMTP, appConfig.Newsletter = smtpConfig, newsletterConfig })
+
+	router, err := newRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+	publish := func(slug, title string) {
+		queueNewsletter(PublishEvent{
+			Slug: slug,
+			Lang: defaultLanguage(),
+			URL:  appConfig.SiteURL + "/posts/" + slug,
+			Doc:  &MarkdownFile{Title: title, Description: "What " + title + " is about"},
+		})
+		backgroundTasks.Wait()
+	}
+
+	// Subscribing mails the confirmation link and nothing else
+	form := url.Values{"email": {"reader@example.org"}}
+	req := httptest.NewRequest(http.MethodPost, "/newsletter/subscribe", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("subscribe: status = %d, want 200", rec.Code)
+	}
+	messages := smtpServer.received()
+	if len(messages) != 1 {
+		t.Fatalf("%d messages after subscribing, want the confirmation", len(messages))
+	}
+	confirm := messages[0]
+	if confirm.To != "reader@example.org" || confirm.From != "blog@example.com" {
+		t.Errorf("confirmation from %q to %q", confirm.From, confirm.To)
+	}
+	confirmURL := newsletterLink.FindString(confirm.Text)
+	if !strings.Contains(confirmURL, "/newsletter/confirm?token=") {
+		t.Fatalf("no confirmation link in the text part:\n%s", confirm.Text)
+	}
+	if !strings.Contains(confirm.HTML, confirmURL) {
+		t.Errorf("HTML part doesn't link %s:\n%s", confirmURL, confirm.HTML)
+	}
+
+	// Posts published before the address is confirmed are not mailed to it
+	publish("early-post", "Early post")
+	if n := len(smtpServer.received()); n != 1 {
+		t.Fatalf("%d messages before confirming, want 1", n)
+	}
+
+	if rec := request(http.MethodGet, strings.TrimPrefix(confirmURL, appConfig.SiteURL)); rec.Code != http.StatusOK {
+		t.Fatalf("confirm: status = %d, want 200", rec.Code)
+	}
+	publish("new-post", "New post")
+	messages = smtpServer.received()
+	if len(messages) != 2 {
+		t.Fatalf("%d messages after publishing, want 2", len(messages))
+	}
+	post := messages[1]
+	postURL := appConfig.SiteURL + "/posts/new-post"
+	if !strings.Contains(post.Subject, "New post") {
+		t.Errorf("subject = %q", post.Subject)
+	}
+	for _, part := range []struct{ name, body string }{{"text", post.Text}, {"HTML", post.HTML}} {
+		if !strings.Contains(part.body, "New post") || !strings.Contains(part.body, postURL) {
+			t.Errorf("%s part doesn't announce the post:\n%s", part.name, part.body)
+		}
+	}
+	unsubscribeURL := newsletterLink.FindString(post.Text)
+	if !strings.Contains(unsubscribeURL, "/newsletter/unsubscribe?token=") || !strings.Contains(post.HTML, unsubscribeURL) {
+		t.Fatalf("unsubscribe link %q missing from the text or HTML part", unsubscribeURL)
+	}
+	if got := post.Header.Get("List-Unsubscribe"); got != "<"+unsubscribeURL+">" {
+		t.Errorf("List-Unsubscribe = %q, want <%s>", got, unsubscribeURL)
+	}
+
+	// The link unsubscribes after a confirmation step, then no more mail is sent
+	path := strings.TrimPrefix(unsubscribeURL, appConfig.SiteURL)
+	if rec := request(http.MethodGet, path); rec.Code != http.StatusOK || findSubscriber(tokenOf(unsubscribeURL)) == nil {
+		t.Fatalf("unsubscribe page: status = %d, or the subscriber is already gone", rec.Code)
+	}
+	if rec := request(http.MethodPost, path); rec.Code != http.StatusOK {
+		t.Fatalf("unsubscribe: status = %d, want 200", rec.Code)
+	}
+	publish("later-post", "Later post")
+	if n := len(smtpServer.received()); n != 2 {
+		t.Errorf("%d messages after unsubscribing, want 2", n)
+	}
+}
+
+func tokenOf(link string) string {
+	u, _ := url.Parse(link)
+	return u.Query().Get("token")
+}
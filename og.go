@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// OGImageConfig controls the generated social preview images
+type OGImageConfig struct {
+	Background  string `yaml:"background"`   // "#rrggbb" or a path to an image
+	TextColor   string `yaml:"text_color"`   // "#rrggbb"
+	AccentColor string `yaml:"accent_color"` // "#rrggbb"
+	Font        string `yaml:"font"`         // path to a .ttf/.otf file, empty for the embedded Go font
+}
+
+const (
+	ogWidth   = 1200
+	ogHeight  = 630
+	ogPadding = 80
+
+	// The title is shrunk to fit in this many lines, and cut off after them
+	ogTitleLines = 3
+
+	// Bump when the layout changes so cached images are regenerated
+	ogLayoutVersion = "2"
+)
+
+// Generated social preview image for a post
+func handleOGImage(c *gin.Context) {
+	slug := c.Param("slug")
+	lang := requestLang(c)
+	if isLocalizedSlug(slug) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	doc, err := loadMarkdownFile("posts", langFileSlug(slug, lang))
+	if err != nil || !isPostLive(doc) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	path, err := ogImagePath(doc, lang)
+	if err != nil {
+		log.Printf("Error generating preview image for %s: %v", slug, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if !isDevMode {
+		c.Header("Cache-Control", "public, max-age=86400")
+	}
+	c.Header("Content-Type", "image/png")
+	c.File(path)
+}
+
+// ogImagePath returns the cached preview image of a post, generating it when
+// the post or the image settings changed since it was last rendered
+func ogImagePath(doc *MarkdownFile, lang string) (string, error) {
+	dir := filepath.Join(appConfig.CacheFolder, "og")
+	path := filepath.Join(dir, ogImageKey(doc, lang)+".png")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	data, err := renderOGImage(doc, lang)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	// Write to a temp file first so concurrent requests never see a partial image
+	tmpFile, err := ioutil.TempFile(dir, "og-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return "", err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ogImageKey hashes everything that ends up in a preview image
+func ogImageKey(doc *MarkdownFile, lang string) string {
+	cfg := appConfig.OGImage
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%s\n", ogLayoutVersion, lang, languageConfig(lang).SiteTitle, doc.Title, doc.Date)
+	fmt.Fprintf(h, "%s\n", strings.Join(doc.Tags, ","))
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n", cfg.Background, cfg.TextColor, cfg.AccentColor, cfg.Font)
+
+	// Editing the background image or font file in place also invalidates the cache
+	for _, file := range []string{cfg.Background, cfg.Font} {
+		if file == "" || strings.HasPrefix(file, "#") {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(h, "%d-%d\n", info.ModTime().Unix(), info.Size())
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// renderOGImage draws the 1200×630 preview image of a post as PNG
+func renderOGImage(doc *MarkdownFile, lang string) ([]byte, error) {
+	cfg := appConfig.OGImage
+	textColor := parseHexColor(cfg.TextColor, color.NRGBA{0xf8, 0xfa, 0xfc, 0xff})
+	accentColor := parseHexColor(cfg.AccentColor, color.NRGBA{0x38, 0xbd, 0xf8, 0xff})
+
+	img, err := ogBackground(cfg.Background)
+	if err != nil {
+		return nil, err
+	}
+
+	boldFont, regularFont := gobold.TTF, goregular.TTF
+	if cfg.Font != "" {
+		custom, err := ioutil.ReadFile(cfg.Font)
+		if err != nil {
+			return nil, err
+		}
+		boldFont, regularFont = custom, custom
+	}
+	bold, err := opentype.Parse(boldFont)
+	if err != nil {
+		return nil, fmt.Errorf("parsing font: %v", err)
+	}
+	regular, err := opentype.Parse(regularFont)
+	if err != nil {
+		return nil, fmt.Errorf("parsing font: %v", err)
+	}
+
+	// Accent bar along the left edge
+	draw.Draw(img, image.Rect(0, 0, 16, ogHeight), image.NewUniform(accentColor), image.Point{}, draw.Src)
+
+	// Site name at the top
+	siteFace, err := opentype.NewFace(bold, &opentype.FaceOptions{Size: 36, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	drawText(img, siteFace, accentColor, ogPadding, ogPadding+36, languageConfig(lang).SiteTitle)
+
+	// Title, shrunk until it fits in ogTitleLines lines, cut off when it never does
+	var lines []string
+	var titleFace font.Face
+	for _, size := range []float64{72, 64, 56, 48} {
+		titleFace, err = opentype.NewFace(bold, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, err
+		}
+		lines = wrapText(titleFace, doc.Title, ogWidth-2*ogPadding)
+		if len(lines) <= ogTitleLines {
+			break
+		}
+	}
+	if len(lines) > ogTitleLines {
+		lines = lines[:ogTitleLines]
+		lines[ogTitleLines-1] = strings.TrimRight(lines[ogTitleLines-1], " .,;:") + "…"
+	}
+	lineHeight := titleFace.Metrics().Height.Ceil() * 6 / 5
+	y := ogPadding + 36 + 100 + titleFace.Metrics().Ascent.Ceil()
+	for _, line := range lines {
+		drawText(img, titleFace, textColor, ogPadding, y, line)
+		y += lineHeight
+	}
+
+	// Date and tags along the bottom
+	var footer []string
+	if date := doc.Date; date != "" {
+		footer = append(footer, date)
+	}
+	if len(doc.Tags) > 0 {
+		footer = append(footer, "#"+strings.Join(doc.Tags, "  #"))
+	}
+	footerFace, err := opentype.NewFace(regular, &opentype.FaceOptions{Size: 30, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	footerText := strings.Join(footer, "   ·   ")
+	if wrapped := wrapText(footerFace, footerText, ogWidth-2*ogPadding); len(wrapped) > 1 {
+		footerText = strings.TrimRight(wrapped[0], " ·#") + "…"
+	}
+	muted := textColor
+	muted.A = 0xb0
+	drawText(img, footerFace, muted, ogPadding, ogHeight-ogPadding, footerText)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ogBackground returns the canvas, filled with a colour or a cropped and darkened image
+func ogBackground(background string) (*image.NRGBA, error) {
+	if background == "" || strings.HasPrefix(background, "#") {
+		return imaging.New(ogWidth, ogHeight, parseHexColor(background, color.NRGBA{0x1e, 0x29, 0x3b, 0xff})), nil
+	}
+
+	src, err := imaging.Open(background)
+	if err != nil {
+		return nil, err
+	}
+	img := imaging.Fill(src, ogWidth, ogHeight, imaging.Center, imaging.Lanczos)
+	// Darken the image so the text stays readable
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{0, 0, 0, 0x99}), image.Point{}, draw.Over)
+	return img, nil
+}
+
+// parseHexColor parses "#rrggbb", returning fallback for empty or invalid values
+func parseHexColor(s string, fallback color.NRGBA) color.NRGBA {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return fallback
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return fallback
+	}
+	return color.NRGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}
+}
+
+// wrapText splits text into lines no wider than maxWidth pixels
+func wrapText(face font.Face, text string, maxWidth int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && font.MeasureString(face, candidate).Ceil() > maxWidth {
+			lines = append(lines, line)
+			line = word
+		} else {
+			line = candidate
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// drawText draws a single line of text with its baseline at (x, y)
+func drawText(img draw.Image, face font.Face, col color.Color, x, y int, text string) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(col),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
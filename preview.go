@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// signPreview returns the HMAC signature for a preview link. The signature
+// covers the language, slug and expiry, so none of them can be altered, and it
+// stops validating as soon as preview_secret is rotated.
+func signPreview(secret, lang, slug string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%d", lang, slug, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// previewURL builds a signed preview link for a post that expires at the given time
+func previewURL(lang, slug string, expires time.Time) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("sig", signPreview(appConfig.PreviewSecret, lang, slug, expires.Unix()))
+	return fmt.Sprintf("%s%s/preview/%s?%s", appConfig.SiteURL, langPrefix(lang), url.PathEscape(slug), query.Encode())
+}
+
+// Signed preview route for drafts and scheduled posts
+func handlePreview(c *gin.Context) {
+	slug := c.Param("slug")
+	lang := requestLang(c)
+
+	// Previews are never cached or indexed, even when the link leaks
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("X-Robots-Tag", "noindex, nofollow")
+
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	expected := signPreview(appConfig.PreviewSecret, lang, slug, expires)
+	if appConfig.PreviewSecret == "" || err != nil || isLocalizedSlug(slug) ||
+		!hmac.Equal([]byte(c.Query("sig")), []byte(expected)) {
+		log.Printf("Rejected preview link for: %s", slug)
+		renderError(c, http.StatusNotFound, "post_not_found", "post_not_found_message")
+		return
+	}
+	if time.Now().Unix() > expires {
+		log.Printf("Expired preview link for: %s", slug)
+		renderError(c, http.StatusGone, "preview_expired", "preview_expired_message")
+		return
+	}
+
+	doc, err := loadMarkdownFile("posts", langFileSlug(slug, lang))
+	if err != nil {
+		log.Printf("Post not found: %s", slug)
+		renderError(c, http.StatusNotFound, "post_not_found", "post_not_found_message")
+		return
+	}
+
+	renderPost(c, slug, lang, doc, true)
+}
+
+// runPreviewCommand prints a signed preview link for a draft or scheduled post
+func runPreviewCommand(args []string) error {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	lang := fs.String("lang", defaultLanguage(), "Language of the post to preview")
+	valid := fs.Duration("expires", 72*time.Hour, "How long the preview link stays valid")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: podium preview [-lang code] [-expires duration] <slug>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("preview needs exactly one post slug")
+	}
+	if appConfig.PreviewSecret == "" {
+		return errors.New("preview_secret is not set in config.yaml")
+	}
+	if !isLanguage(*lang) {
+		return fmt.Errorf("unknown language: %s", *lang)
+	}
+
+	slug := fs.Arg(0)
+	if _, err := loadMarkdownFile("posts", langFileSlug(slug, *lang)); err != nil {
+		return fmt.Errorf("post not found: %s", slug)
+	}
+
+	expires := time.Now().Add(*valid)
+	fmt.Println(previewURL(*lang, slug, expires))
+	fmt.Printf("Valid until %s\n", expires.Format("2006-01-02 15:04"))
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// PublishEvent is fired when a post goes live or its content changes. Scheduled
+// posts fire once their PublishDate has passed.
+type PublishEvent struct {
+	Slug    string
+	Lang    string
+	URL     string
+	Doc     *MarkdownFile
+	Updated bool // the post was already published and has been edited
+}
+
+// publishedPost records a post the scanner has seen live, in data/published.json
+type publishedPost struct {
+	Hash      string    `json:"hash"`
+	Published time.Time `json:"published"`
+}
+
+var (
+	publishHooks   []func(PublishEvent)
+	publishedStore = newJSONStore("published.json")
+)
+
+// onPublish registers fn to be called for every publish event
+func onPublish(fn func(PublishEvent)) {
+	publishHooks = append(publishHooks, fn)
+}
+
+// scanPublished compares the live posts with the ones seen before and fires
+// publish events for new and edited posts. The very first scan only records
+// what is already published, so existing posts are not announced again.
+func scanPublished() {
+	var state map[string]publishedPost
+	var events []PublishEvent
+	baseline := false
+
+	err := publishedStore.Update(&state, func() error {
+		baseline = state == nil
+		seen := map[string]bool{}
+		if baseline {
+			state = map[string]publishedPost{}
+		}
+
+		for _, l := range appConfig.Languages {
+			for _, post := range getBlogPostsForLang(l.Code) {
+				file := langFileSlug(post.Slug, l.Code)
+				content, err := ioutil.ReadFile(filepath.Join("posts", file+".md"))
+				if err != nil {
+					continue
+				}
+				sum := sha256.Sum256(content)
+				hash := hex.EncodeToString(sum[:])
+
+				key := l.Code + "/" + post.Slug
+				seen[key] = true
+				prev, known := state[key]
+				if known && prev.Hash == hash {
+					continue
+				}
+				if !known {
+					prev.Published = time.Now()
+				}
+				state[key] = publishedPost{Hash: hash, Published: prev.Published}
+				if baseline {
+					continue
+				}
+
+				doc, err := loadMarkdownFile("posts", file)
+				if err != nil {
+					continue
+				}
+				events = append(events, PublishEvent{
+					Slug:    post.Slug,
+					Lang:    l.Code,
+					URL:     appConfig.SiteURL + langPrefix(l.Code) + "/posts/" + post.Slug,
+					Doc:     doc,
+					Updated: known,
+				})
+			}
+		}
+
+		// Forget posts that were removed or unpublished, so they are announced
+		// again if they come back
+		for key := range state {
+			if !seen[key] {
+				delete(state, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to scan published posts: %v", err)
+		return
+	}
+	if baseline {
+		log.Printf("Recorded %d published posts, new posts will be announced from now on", len(state))
+	}
+
+	for _, ev := range events {
+		if ev.Updated {
+			log.Printf("Post updated: %s", ev.URL)
+		} else {
+			log.Printf("Post published: %s", ev.URL)
+		}
+		for _, hook := range publishHooks {
+			hook(ev)
+		}
+	}
+}
+
+// watchPublished scans for newly published posts every minute until the service stops
+func (p *program) watchPublished() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	scanPublished()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			scanPublished()
+		}
+	}
+}
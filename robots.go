@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RobotsConfig controls the generated robots.txt rules
+type RobotsConfig struct {
+	BlockAICrawlers bool         `yaml:"block_ai_crawlers"` // disallow the whole site for aiCrawlers
+	Rules           []RobotsRule `yaml:"rules"`
+}
+
+// RobotsRule is one user-agent group of robots.txt
+type RobotsRule struct {
+	UserAgent string   `yaml:"user_agent"`
+	Allow     []string `yaml:"allow"`
+	Disallow  []string `yaml:"disallow"`
+}
+
+// aiCrawlers are the user agents of crawlers that collect training data for
+// AI models. Crawlers that only fetch pages on behalf of a user are not listed.
+var aiCrawlers = []string{
+	"GPTBot",
+	"ClaudeBot",
+	"anthropic-ai",
+	"CCBot",
+	"Google-Extended",
+	"Applebot-Extended",
+	"Bytespider",
+	"meta-externalagent",
+	"FacebookBot",
+	"cohere-ai",
+	"cohere-training-data-crawler",
+	"Diffbot",
+	"Omgilibot",
+	"AI2Bot",
+	"Timpibot",
+	"ImagesiftBot",
+	"PanguBot",
+}
+
+// robotsNoIndexPaths are served with noindex, in every language
+var robotsNoIndexPaths = []string{"/search?", "/preview/", "/newsletter/", "/forms/"}
+
+// robotsData is the data robots.txt templates are executed with
+type robotsData struct {
+	SiteURL    string
+	Rules      string   // the generated user-agent groups
+	Sitemaps   []string // sitemap URL of every language
+	Disallow   []string // unlisted and noindex paths
+	AICrawlers []string
+}
+
+// defaultRobotsTemplate is used when there is no robots.txt on disk
+const defaultRobotsTemplate = `# robots.txt for Podium
+# https://www.robotstxt.org/
+
+{{ .Rules }}
+# Sitemaps
+{{ range .Sitemaps }}Sitemap: {{ . }}
+{{ end }}`
+
+// unlistedPaths returns the paths of the published unlisted posts and pages
+// of a language. Drafts and scheduled posts are left out, so their URLs
+// don't leak before they are published.
+func unlistedPaths(lang string) []string {
+	var paths []string
+	for _, section := range []struct{ folder, route string }{{"posts", "/posts/"}, {"static", "/page/"}} {
+		files, err := ioutil.ReadDir(section.folder)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), ".md") {
+				continue
+			}
+			slug, fileLang := splitLangSlug(strings.TrimSuffix(file.Name(), ".md"))
+			if fileLang != lang {
+				continue
+			}
+			doc, err := loadMarkdownFile(section.folder, langFileSlug(slug, lang))
+			if err != nil || !doc.Unlisted || !isPostLive(doc) {
+				continue
+			}
+			paths = append(paths, langPrefix(lang)+section.route+slug)
+		}
+	}
+	return paths
+}
+
+// robotsDisallowed returns the paths every crawler is asked to skip
+func robotsDisallowed() []string {
+	var paths []string
+	for _, lang := range appConfig.Languages {
+		for _, path := range robotsNoIndexPaths {
+			paths = append(paths, langPrefix(lang.Code)+path)
+		}
+		paths = append(paths, unlistedPaths(lang.Code)...)
+	}
+	return paths
+}
+
+// generateRobotsRules writes the user-agent groups of robots.txt: the AI
+// crawler block, then the configured rules (or allow everything), each with
+// the unlisted and noindex paths added
+func generateRobotsRules(disallowed []string) string {
+	var b strings.Builder
+	if appConfig.Robots.BlockAICrawlers {
+		for _, agent := range aiCrawlers {
+			b.WriteString("User-agent: " + agent + "\n")
+		}
+		b.WriteString("Disallow: /\n\n")
+	}
+
+	rules := appConfig.Robots.Rules
+	if len(rules) == 0 {
+		rules = []RobotsRule{{UserAgent: "*", Allow: []string{"/"}}}
+	}
+	for _, rule := range rules {
+		b.WriteString("User-agent: " + rule.UserAgent + "\n")
+		for _, path := range rule.Allow {
+			b.WriteString("Allow: " + path + "\n")
+		}
+		blocked := false
+		for _, path := range rule.Disallow {
+			b.WriteString("Disallow: " + path + "\n")
+			blocked = blocked || path == "/"
+		}
+		// A group that is already shut out needs no further paths
+		if !blocked {
+			for _, path := range disallowed {
+				b.WriteString("Disallow: " + path + "\n")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// generateRobots renders robots.txt from the robots.txt file on disk, or
+// from the default template when there is none
+func generateRobots() ([]byte, error) {
+	source := defaultRobotsTemplate
+	if content, err := ioutil.ReadFile("robots.txt"); err == nil {
+		source = string(content)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	tmpl, err := template.New("robots.txt").Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	disallowed := robotsDisallowed()
+	data := robotsData{
+		SiteURL:    appConfig.SiteURL,
+		Rules:      generateRobotsRules(disallowed),
+		Disallow:   disallowed,
+		AICrawlers: aiCrawlers,
+	}
+	for _, lang := range appConfig.Languages {
+		data.Sitemaps = append(data.Sitemaps, appConfig.SiteURL+langPrefix(lang.Code)+"/sitemap.xml")
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Robots.txt route
+func handleRobots(c *gin.Context) {
+	content, err := generateRobots()
+	if err != nil {
+		log.Printf("Error rendering robots.txt: %v", err)
+		c.String(http.StatusInternalServerError, "robots.txt could not be rendered")
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", content)
+}
@@ -0,0 +1,715 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchDoc is a post or static page in the search index
+type searchDoc struct {
+	Key         string // folder and file name, e.g. "posts/first-post.nb"
+	Kind        string // "post" or "page"
+	Slug        string
+	Lang        string
+	Title       string
+	Date        string
+	PublishDate string
+	Tags        []string
+	Description string
+	Text        string // plain text without the title heading
+	Draft       bool
+	Unlisted    bool
+	Featured    bool
+
+	modTime time.Time
+	size    int64
+	terms   []string
+}
+
+// searchPosting records where a term occurs in one document
+type searchPosting struct {
+	title []int // token positions in the title
+	body  []int // token positions in the text
+	tag   bool
+}
+
+// searchIndex is an inverted index over posts and static pages. It is kept up
+// to date by refresh, which only re-reads files that changed on disk.
+type searchIndex struct {
+	mu        sync.RWMutex
+	refreshMu sync.Mutex
+	docs      map[string]*searchDoc
+	postings  map[string]map[string]*searchPosting // term -> doc key -> posting
+}
+
+// searchTerm is a word or a quoted phrase of a query
+type searchTerm struct {
+	stems  []string
+	prefix bool // the word ended with * and matches every term starting with it
+}
+
+// searchQuery is a parsed search query: words, phrases and tag: filters
+type searchQuery struct {
+	Terms []searchTerm
+	Tags  []string
+}
+
+// SearchResult is a matching post or page, ready for the template
+type SearchResult struct {
+	Kind    string
+	Title   string
+	URL     string
+	Date    string
+	Tags    []string
+	Snippet template.HTML
+	score   float64
+}
+
+// Ranking weights: a term in the title counts far more than in the text
+const (
+	searchTitleWeight = 10.0
+	searchTagWeight   = 5.0
+	searchPrefixScale = 0.5
+	searchMaxQuery    = 200 // characters
+)
+
+var siteSearch = newSearchIndex()
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		docs:     map[string]*searchDoc{},
+		postings: map[string]map[string]*searchPosting{},
+	}
+}
+
+// searchToken is a normalized word and its byte offsets in the source text
+type searchToken struct {
+	word       string
+	start, end int
+}
+
+// tokenize splits text into lowercase words of letters and digits
+func tokenize(text string) []searchToken {
+	var tokens []searchToken
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, searchToken{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, searchToken{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+// Suffixes removed by the Norwegian stemmer, longest first
+var norwegianSuffixes = []string{
+	"hetene", "hetens", "heten", "heter", "endes", "ande", "ende", "edes", "enes",
+	"erte", "ene", "ane", "het", "ert", "ers", "ets", "en", "ar", "er", "et", "as", "es", "e", "a", "s",
+}
+
+// stem reduces a lowercase word to its stem with a light suffix stripper for
+// English and Norwegian. Other languages are matched on whole words.
+func stem(lang, word string) string {
+	runes := []rune(word)
+	if len(runes) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasPrefix(lang, "en"):
+		return stemEnglish(word)
+	case lang == "nb" || lang == "nn" || lang == "no":
+		for _, suffix := range norwegianSuffixes {
+			if strings.HasSuffix(word, suffix) && len([]rune(word))-len([]rune(suffix)) >= 3 {
+				return strings.TrimSuffix(word, suffix)
+			}
+		}
+	}
+	return word
+}
+
+// stemEnglish strips common English inflections (plurals, -ing, -ed, -ly)
+func stemEnglish(word string) string {
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		word = strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") &&
+		!strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		word = strings.TrimSuffix(word, "s")
+	}
+
+	for _, suffix := range []string{"ingly", "edly", "ing", "ed", "ly"} {
+		base := strings.TrimSuffix(word, suffix)
+		if base == word || len(base) < 3 || !strings.ContainsAny(base, "aeiouy") {
+			continue
+		}
+		// running -> run, stopped -> stop
+		if n := len(base); n >= 4 && base[n-1] == base[n-2] && !strings.ContainsAny(base[n-1:], "lsz") {
+			base = base[:n-1]
+		}
+		return base
+	}
+	return word
+}
+
+// refresh brings the index in line with the posts and static folders,
+// re-reading only files that were added or changed since the last refresh
+func (idx *searchIndex) refresh() {
+	idx.refreshMu.Lock()
+	defer idx.refreshMu.Unlock()
+
+	seen := map[string]bool{}
+	for _, folder := range []string{"posts", "static"} {
+		files, err := ioutil.ReadDir(folder)
+		if err != nil {
+			log.Printf("Error reading %s folder for search: %v", folder, err)
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), ".md") {
+				continue
+			}
+			name := strings.TrimSuffix(file.Name(), ".md")
+			key := folder + "/" + name
+			seen[key] = true
+
+			idx.mu.RLock()
+			doc := idx.docs[key]
+			idx.mu.RUnlock()
+			if doc != nil && doc.modTime.Equal(file.ModTime()) && doc.size == file.Size() {
+				continue
+			}
+			if doc, err := newSearchDoc(folder, name, file); err == nil {
+				idx.add(doc)
+			}
+		}
+	}
+
+	idx.mu.Lock()
+	for key := range idx.docs {
+		if !seen[key] {
+			idx.remove(key)
+		}
+	}
+	idx.mu.Unlock()
+}
+
+// newSearchDoc loads a markdown file for indexing
+func newSearchDoc(folder, name string, file os.FileInfo) (*searchDoc, error) {
+	md, err := loadMarkdownFile(folder, name)
+	if err != nil {
+		return nil, err
+	}
+	slug, lang := splitLangSlug(name)
+	kind := "post"
+	if folder == "static" {
+		kind = "page"
+	}
+	return &searchDoc{
+		Key:         folder + "/" + name,
+		Kind:        kind,
+		Slug:        slug,
+		Lang:        lang,
+		Title:       md.Title,
+		Date:        md.Date,
+		PublishDate: md.PublishDate,
+		Tags:        md.Tags,
+		Description: md.Description,
+		Text:        strings.TrimSpace(strings.TrimPrefix(md.PlainText, md.Title)),
+		Draft:       md.Draft,
+		Unlisted:    md.Unlisted,
+		Featured:    md.Featured,
+		modTime:     file.ModTime(),
+		size:        file.Size(),
+	}, nil
+}
+
+// add indexes a document, replacing an earlier version of it
+func (idx *searchIndex) add(doc *searchDoc) {
+	postings := map[string]*searchPosting{}
+	posting := func(term string) *searchPosting {
+		p := postings[term]
+		if p == nil {
+			p = &searchPosting{}
+			postings[term] = p
+		}
+		return p
+	}
+	for i, t := range tokenize(doc.Title) {
+		p := posting(stem(doc.Lang, t.word))
+		p.title = append(p.title, i)
+	}
+	for i, t := range tokenize(doc.Text) {
+		p := posting(stem(doc.Lang, t.word))
+		p.body = append(p.body, i)
+	}
+	for _, tag := range doc.Tags {
+		for _, t := range tokenize(tag) {
+			posting(stem(doc.Lang, t.word)).tag = true
+		}
+	}
+	for term := range postings {
+		doc.terms = append(doc.terms, term)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(doc.Key)
+	idx.docs[doc.Key] = doc
+	for term, p := range postings {
+		if idx.postings[term] == nil {
+			idx.postings[term] = map[string]*searchPosting{}
+		}
+		idx.postings[term][doc.Key] = p
+	}
+}
+
+// remove drops a document from the index. The caller holds idx.mu.
+func (idx *searchIndex) remove(key string) {
+	doc := idx.docs[key]
+	if doc == nil {
+		return
+	}
+	for _, term := range doc.terms {
+		delete(idx.postings[term], key)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docs, key)
+}
+
+// listed reports whether a document shows up in lists and search: not a
+// draft, not unlisted and not scheduled for later
+func (doc *searchDoc) listed() bool {
+	if doc.Draft || doc.Unlisted {
+		return false
+	}
+	if doc.PublishDate != "" {
+		pubTime, err := time.Parse("2006-01-02 15:04", doc.PublishDate)
+		if err == nil && time.Now().Before(pubTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// listedDocs returns the keys of the listed documents in a language. The caller holds idx.mu.
+func (idx *searchIndex) listedDocs(lang string) map[string]bool {
+	keys := map[string]bool{}
+	for key, doc := range idx.docs {
+		if doc.Lang == lang && doc.listed() {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// url returns the site-relative URL of a document
+func (doc *searchDoc) url() string {
+	if doc.Kind == "page" {
+		return langPrefix(doc.Lang) + "/page/" + doc.Slug
+	}
+	return langPrefix(doc.Lang) + "/posts/" + doc.Slug
+}
+
+// parseSearchQuery splits a query into words, "quoted phrases" and tag:name filters
+func parseSearchQuery(lang, q string) searchQuery {
+	var query searchQuery
+	for len(q) > 0 {
+		q = strings.TrimLeftFunc(q, unicode.IsSpace)
+		if q == "" {
+			break
+		}
+
+		var part string
+		phrase := q[0] == '"'
+		if phrase {
+			end := strings.IndexByte(q[1:], '"')
+			if end < 0 {
+				part, q = q[1:], ""
+			} else {
+				part, q = q[1:end+1], q[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(q, unicode.IsSpace)
+			if end < 0 {
+				end = len(q)
+			}
+			part, q = q[:end], q[end:]
+			if tag := strings.TrimPrefix(part, "tag:"); tag != part {
+				if tag != "" {
+					query.Tags = append(query.Tags, tag)
+				}
+				continue
+			}
+		}
+
+		tokens := tokenize(part)
+		if len(tokens) == 0 {
+			continue
+		}
+		if !phrase && len(tokens) == 1 && strings.HasSuffix(part, "*") {
+			query.Terms = append(query.Terms, searchTerm{stems: []string{tokens[0].word}, prefix: true})
+			continue
+		}
+		// Hyphenated words such as "web-dev" are searched as a phrase
+		term := searchTerm{}
+		for _, t := range tokens {
+			term.stems = append(term.stems, stem(lang, t.word))
+		}
+		query.Terms = append(query.Terms, term)
+	}
+	return query
+}
+
+// matches returns the score of every visible document matching a term.
+// Term frequencies only count visible documents, so a language's ranking does
+// not depend on drafts or other languages. The caller holds idx.mu.
+func (idx *searchIndex) matches(term searchTerm, visible map[string]bool) map[string]float64 {
+	scores := map[string]float64{}
+	n := float64(len(visible))
+
+	if term.prefix {
+		for indexed, postings := range idx.postings {
+			if !strings.HasPrefix(indexed, term.stems[0]) {
+				continue
+			}
+			df := visibleCount(postings, visible)
+			for key, p := range postings {
+				if !visible[key] {
+					continue
+				}
+				score := termScore(p, n, df) * searchPrefixScale
+				if indexed == term.stems[0] {
+					score /= searchPrefixScale
+				}
+				scores[key] = math.Max(scores[key], score)
+			}
+		}
+		return scores
+	}
+
+	if len(term.stems) == 1 {
+		postings := idx.postings[term.stems[0]]
+		df := visibleCount(postings, visible)
+		for key, p := range postings {
+			if visible[key] {
+				scores[key] = termScore(p, n, df)
+			}
+		}
+		return scores
+	}
+
+	// Phrases: every word must follow the previous one
+	first := idx.postings[term.stems[0]]
+	df := visibleCount(first, visible)
+	for key, p := range first {
+		if !visible[key] {
+			continue
+		}
+		rest := make([]*searchPosting, 0, len(term.stems)-1)
+		for _, s := range term.stems[1:] {
+			if other := idx.postings[s][key]; other != nil {
+				rest = append(rest, other)
+			}
+		}
+		if len(rest) < len(term.stems)-1 {
+			continue
+		}
+		inTitle := phraseCount(p.title, rest, func(p *searchPosting) []int { return p.title })
+		inBody := phraseCount(p.body, rest, func(p *searchPosting) []int { return p.body })
+		if inTitle+inBody == 0 {
+			continue
+		}
+		idf := math.Log(1 + n/float64(df))
+		score := 0.0
+		if inTitle > 0 {
+			score += 2 * searchTitleWeight * idf
+		}
+		if inBody > 0 {
+			score += 2 * (1 + math.Log(float64(inBody))) * idf
+		}
+		scores[key] = score
+	}
+	return scores
+}
+
+// visibleCount counts the visible documents in a term's postings
+func visibleCount(postings map[string]*searchPosting, visible map[string]bool) int {
+	count := 0
+	for key := range postings {
+		if visible[key] {
+			count++
+		}
+	}
+	return count
+}
+
+// termScore weighs a term's occurrences in one document: title matches rank
+// above tag matches, which rank above matches in the text
+func termScore(p *searchPosting, docs float64, df int) float64 {
+	idf := math.Log(1 + docs/float64(df))
+	score := 0.0
+	if len(p.title) > 0 {
+		score += searchTitleWeight * idf
+	}
+	if p.tag {
+		score += searchTagWeight * idf
+	}
+	if len(p.body) > 0 {
+		score += (1 + math.Log(float64(len(p.body)))) * idf
+	}
+	return score
+}
+
+// phraseCount counts the positions where the following words come right after the first
+func phraseCount(starts []int, rest []*searchPosting, field func(*searchPosting) []int) int {
+	count := 0
+	for _, start := range starts {
+		found := true
+		for i, p := range rest {
+			if !containsInt(field(p), start+i+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			count++
+		}
+	}
+	return count
+}
+
+func containsInt(values []int, v int) bool {
+	i := sort.SearchInts(values, v)
+	return i < len(values) && values[i] == v
+}
+
+// Search returns the listed documents of a language that match every term and
+// tag of a query, best matches first
+func (idx *searchIndex) Search(lang string, query searchQuery) []SearchResult {
+	if len(query.Terms) == 0 && len(query.Tags) == 0 {
+		return nil
+	}
+	idx.refresh()
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	visible := idx.listedDocs(lang)
+	var scores map[string]float64
+	if len(query.Terms) == 0 {
+		scores = map[string]float64{}
+		for key := range visible {
+			scores[key] = 0
+		}
+	}
+	for _, term := range query.Terms {
+		matched := idx.matches(term, visible)
+		if scores == nil {
+			scores = matched
+			continue
+		}
+		for key := range scores {
+			if score, ok := matched[key]; ok {
+				scores[key] += score
+			} else {
+				delete(scores, key)
+			}
+		}
+	}
+
+	var results []SearchResult
+	for key, score := range scores {
+		doc := idx.docs[key]
+		if !hasAllTags(doc.Tags, query.Tags) {
+			continue
+		}
+		results = append(results, SearchResult{
+			Kind:    doc.Kind,
+			Title:   doc.Title,
+			URL:     doc.url(),
+			Date:    doc.Date,
+			Tags:    doc.Tags,
+			Snippet: searchSnippet(doc, query),
+			score:   score,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		if results[i].Date != results[j].Date {
+			return results[i].Date > results[j].Date
+		}
+		return results[i].Title < results[j].Title
+	})
+	return results
+}
+
+// hasAllTags reports whether tags contains every wanted tag, ignoring case
+func hasAllTags(tags, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, tag := range tags {
+			if strings.EqualFold(tag, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// searchSnippet returns a piece of a document's text around the first match,
+// with every matching word wrapped in <mark>
+func searchSnippet(doc *searchDoc, query searchQuery) template.HTML {
+	const before, length = 60, 220
+
+	stems := map[string]bool{}
+	var prefixes []string
+	for _, term := range query.Terms {
+		if term.prefix {
+			prefixes = append(prefixes, term.stems[0])
+			continue
+		}
+		for _, s := range term.stems {
+			stems[s] = true
+		}
+	}
+	isMatch := func(word string) bool {
+		s := stem(doc.Lang, word)
+		if stems[s] {
+			return true
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(s, prefix) || strings.HasPrefix(word, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	text := doc.Text
+	tokens := tokenize(text)
+	start := 0
+	for _, t := range tokens {
+		if isMatch(t.word) {
+			start = t.start
+			break
+		}
+	}
+
+	// Start and end the snippet on word boundaries
+	from := 0
+	if start > before {
+		from = strings.LastIndexFunc(text[:start-before], unicode.IsSpace) + 1
+	}
+	to := len(text)
+	if from+length < len(text) {
+		to = from + length
+		if i := strings.IndexFunc(text[to:], unicode.IsSpace); i >= 0 {
+			to += i
+		} else {
+			to = len(text)
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("… ")
+	}
+	pos := from
+	for _, t := range tokens {
+		if t.start < from || t.end > to || !isMatch(t.word) {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:t.start]))
+		b.WriteString("<mark>" + html.EscapeString(text[t.start:t.end]) + "</mark>")
+		pos = t.end
+	}
+	b.WriteString(html.EscapeString(text[pos:to]))
+	if to < len(text) {
+		b.WriteString(" …")
+	}
+	return template.HTML(b.String())
+}
+
+// handleSearch renders the search page and results, paginated like /posts
+func handleSearch(c *gin.Context) {
+	lang := requestLang(c)
+	q := strings.TrimSpace(c.Query("q"))
+	// Cut long queries at a character, never inside one
+	if runes := []rune(q); len(runes) > searchMaxQuery {
+		q = string(runes[:searchMaxQuery])
+	}
+	query := parseSearchQuery(lang, q)
+	if tag := c.Query("tag"); tag != "" {
+		query.Tags = append(query.Tags, tag)
+	}
+	results := siteSearch.Search(lang, query)
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage := appConfig.PostsPerPage
+	total := len(results)
+	totalPages := (total + perPage - 1) / perPage
+	if page > totalPages && totalPages > 0 {
+		page = totalPages
+	}
+	start := (page - 1) * perPage
+	end := start + perPage
+	if end > total {
+		end = total
+	}
+	var paginated []SearchResult
+	if start < total {
+		paginated = results[start:end]
+	}
+
+	meta := siteMeta(lang, translate(lang, "search_title"), "/search")
+	c.Header("X-Robots-Tag", "noindex")
+	c.HTML(http.StatusOK, "search.html", siteData(c, gin.H{
+		"Meta":        meta.HTML(),
+		"Query":       q,
+		"Tag":         c.Query("tag"),
+		"Searched":    len(query.Terms) > 0 || len(query.Tags) > 0,
+		"Results":     paginated,
+		"ResultCount": total,
+		"CurrentPage": page,
+		"TotalPages":  totalPages,
+		"HasPrev":     page > 1,
+		"HasNext":     page < totalPages,
+		"PrevPage":    page - 1,
+		"NextPage":    page + 1,
+	}))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchIndexConfig controls what /search-index.json contains
+type SearchIndexConfig struct {
+	Fields        []string `yaml:"fields"`         // any of title, url, tags, date, summary, body
+	BodyTokens    int      `yaml:"body_tokens"`    // words of body text per document, -1 for all
+	SummaryLength int      `yaml:"summary_length"` // characters of summary per document
+}
+
+// searchIndexFields are the fields /search-index.json can include
+var searchIndexFields = []string{"title", "url", "tags", "date", "summary", "body"}
+
+// searchIndexEntry is one post or page in /search-index.json. The keys are
+// kept to one letter to keep the file small.
+type searchIndexEntry struct {
+	Title   string   `json:"t,omitempty"`
+	URL     string   `json:"u,omitempty"`
+	Tags    []string `json:"g,omitempty"`
+	Date    string   `json:"d,omitempty"`
+	Summary string   `json:"s,omitempty"`
+	Body    string   `json:"b,omitempty"` // stemmed words separated by spaces, in text order
+}
+
+// handleSearchIndex serves the listed posts and pages of a language as a
+// compact index for client-side search (assets/search.js)
+func handleSearchIndex(c *gin.Context) {
+	lang := requestLang(c)
+	cfg := appConfig.SearchIndex
+	include := map[string]bool{}
+	for _, field := range cfg.Fields {
+		include[strings.ToLower(field)] = true
+	}
+
+	siteSearch.refresh()
+	siteSearch.mu.RLock()
+	var docs []*searchDoc
+	for key := range siteSearch.listedDocs(lang) {
+		docs = append(docs, siteSearch.docs[key])
+	}
+	siteSearch.mu.RUnlock()
+
+	// Newest first, so the file is stable between requests
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Date != docs[j].Date {
+			return docs[i].Date > docs[j].Date
+		}
+		return docs[i].Key < docs[j].Key
+	})
+
+	entries := make([]searchIndexEntry, 0, len(docs))
+	for _, doc := range docs {
+		var entry searchIndexEntry
+		if include["title"] {
+			entry.Title = doc.Title
+		}
+		if include["url"] {
+			entry.URL = doc.url()
+		}
+		if include["tags"] {
+			entry.Tags = doc.Tags
+		}
+		if include["date"] {
+			entry.Date = doc.Date
+		}
+		if include["summary"] {
+			summary := doc.Description
+			if summary == "" {
+				summary = doc.Text
+			}
+			entry.Summary = generateExcerpt(summary, cfg.SummaryLength)
+		}
+		if include["body"] {
+			tokens := tokenize(doc.Text)
+			if cfg.BodyTokens >= 0 && len(tokens) > cfg.BodyTokens {
+				tokens = tokens[:cfg.BodyTokens]
+			}
+			stems := make([]string, len(tokens))
+			for i, t := range tokens {
+				stems[i] = stem(lang, t.word)
+			}
+			entry.Body = strings.Join(stems, " ")
+		}
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lang": lang,
+		"docs": entries,
+	})
+}
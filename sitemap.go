@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/html"
+)
+
+// sitemapMaxURLs is the most URLs one sitemap file may list. Larger sites are
+// split into sitemap-1.xml, sitemap-2.xml, ... behind a sitemap index.
+const sitemapMaxURLs = 50000
+
+// sitemapMaxImages is the most images listed for one URL
+const sitemapMaxImages = 1000
+
+// sitemapURLSet is a sitemap (https://www.sitemaps.org/protocol.html)
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	XHTMLNS string       `xml:"xmlns:xhtml,attr,omitempty"`
+	ImageNS string       `xml:"xmlns:image,attr,omitempty"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string             `xml:"loc"`
+	LastMod    string             `xml:"lastmod,omitempty"`
+	ChangeFreq string             `xml:"changefreq,omitempty"`
+	Priority   string             `xml:"priority,omitempty"`
+	Alternates []sitemapAlternate `xml:"xhtml:link"`
+	Images     []sitemapImage     `xml:"image:image"`
+
+	modified time.Time
+}
+
+// sitemapAlternate is an hreflang link to a translation of a URL
+type sitemapAlternate struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+// sitemapImage is an image sitemap extension entry
+// (https://developers.google.com/search/docs/crawling-indexing/sitemaps/image-sitemaps)
+type sitemapImage struct {
+	Loc string `xml:"image:loc"`
+}
+
+// sitemapIndex lists the parts of a sitemap that was split
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapRef `xml:"sitemap"`
+}
+
+type sitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// contentModified returns when a post or page last changed: the front matter
+// lastmod when set, otherwise the modification time of its file
+func contentModified(folder, fileSlug string, doc *MarkdownFile) time.Time {
+	if t, ok := parsePostTime(doc.LastMod); ok {
+		return t
+	}
+	if info, err := os.Stat(filepath.Join(folder, fileSlug+".md")); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// sitemapLastMod formats a modification time for <lastmod>, leaving unknown times out
+func sitemapLastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// newestTime returns the latest of a set of times
+func newestTime(times ...time.Time) time.Time {
+	var newest time.Time
+	for _, t := range times {
+		if t.After(newest) {
+			newest = t
+		}
+	}
+	return newest
+}
+
+// htmlImages returns the absolute URLs of the images in rendered HTML
+func htmlImages(content, pageURL string) []string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	var images []string
+	z := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return images
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		token := z.Token()
+		if token.Data != "img" {
+			continue
+		}
+		for _, attr := range token.Attr {
+			if attr.Key != "src" {
+				continue
+			}
+			if u, err := url.Parse(strings.TrimSpace(attr.Val)); err == nil && !strings.HasPrefix(attr.Val, "data:") {
+				images = append(images, base.ResolveReference(u).String())
+			}
+		}
+	}
+}
+
+// sitemapImages returns the image entries of a post: its cover image and the
+// images in its body, without duplicates
+func sitemapImages(doc *MarkdownFile, pageURL string) []sitemapImage {
+	var images []sitemapImage
+	seen := map[string]bool{}
+	for _, src := range append([]string{absoluteURL(doc.Image)}, htmlImages(doc.HTML, pageURL)...) {
+		if src == "" || seen[src] || len(images) == sitemapMaxImages {
+			continue
+		}
+		seen[src] = true
+		images = append(images, sitemapImage{Loc: src})
+	}
+	return images
+}
+
+// sitemapURLs lists every indexable URL of a language: the home page, the
+// post list, posts, tag pages, static pages and the feed
+func sitemapURLs(lang string) []sitemapURL {
+	baseURL := appConfig.SiteURL + langPrefix(lang)
+
+	var postURLs []sitemapURL
+	var newestPost time.Time
+	tagModified := map[string]time.Time{}
+	var tags []string
+	for _, post := range getBlogPostsForLang(lang) {
+		fileSlug := langFileSlug(post.Slug, lang)
+		doc, err := loadMarkdownFile("posts", fileSlug)
+		if err != nil {
+			continue
+		}
+		modified := contentModified("posts", fileSlug, doc)
+		newestPost = newestTime(newestPost, modified)
+		for _, tag := range post.Tags {
+			key := strings.ToLower(tag)
+			if _, ok := tagModified[key]; !ok {
+				tags = append(tags, tag)
+			}
+			tagModified[key] = newestTime(tagModified[key], modified)
+		}
+
+		slug := post.Slug
+		loc := baseURL + "/posts/" + slug
+		postURLs = append(postURLs, sitemapURL{
+			Loc:        loc,
+			ChangeFreq: "monthly",
+			Priority:   "0.8",
+			Alternates: sitemapAlternates(lang, "/posts/"+slug, func(l string) bool {
+				return translationExists("posts", slug, l)
+			}),
+			Images:   sitemapImages(doc, loc),
+			modified: modified,
+		})
+	}
+
+	urls := []sitemapURL{
+		{Loc: baseURL + "/", ChangeFreq: "daily", Priority: "1.0", Alternates: sitemapAlternates(lang, "/", nil), modified: newestPost},
+		{Loc: baseURL + "/posts", ChangeFreq: "daily", Priority: "0.9", Alternates: sitemapAlternates(lang, "/posts", nil), modified: newestPost},
+	}
+	urls = append(urls, postURLs...)
+
+	sort.Strings(tags)
+	for _, tag := range tags {
+		urls = append(urls, sitemapURL{
+			Loc:        baseURL + "/tags/" + url.PathEscape(tag),
+			ChangeFreq: "weekly",
+			Priority:   "0.5",
+			modified:   tagModified[strings.ToLower(tag)],
+		})
+	}
+
+	for _, page := range getStaticPagesForLang(lang) {
+		fileSlug := langFileSlug(page.Slug, lang)
+		doc, err := loadMarkdownFile("static", fileSlug)
+		if err != nil {
+			continue
+		}
+		slug := page.Slug
+		loc := baseURL + "/page/" + slug
+		urls = append(urls, sitemapURL{
+			Loc:        loc,
+			ChangeFreq: "monthly",
+			Priority:   "0.7",
+			Alternates: sitemapAlternates(lang, "/page/"+slug, func(l string) bool {
+				return translationExists("static", slug, l)
+			}),
+			Images:   sitemapImages(doc, loc),
+			modified: contentModified("static", fileSlug, doc),
+		})
+	}
+
+	urls = append(urls, sitemapURL{Loc: baseURL + "/feed.xml", ChangeFreq: "daily", Priority: "0.5", modified: newestPost})
+
+	for i := range urls {
+		urls[i].LastMod = sitemapLastMod(urls[i].modified)
+	}
+	return urls
+}
+
+// sitemapAlternates returns the hreflang links of a path that exists in
+// several languages (nothing when the site has a single language)
+func sitemapAlternates(lang, path string, exists func(string) bool) []sitemapAlternate {
+	if len(appConfig.Languages) < 2 {
+		return nil
+	}
+	var alternates []sitemapAlternate
+	for _, link := range languageLinks(lang, path, exists) {
+		if link.Available {
+			alternates = append(alternates, sitemapAlternate{Rel: "alternate", Hreflang: link.Code, Href: link.AbsURL})
+		}
+	}
+	return alternates
+}
+
+// sitemapParts splits the URLs of a sitemap into files of at most sitemapMaxURLs
+func sitemapParts(urls []sitemapURL) [][]sitemapURL {
+	var parts [][]sitemapURL
+	for len(urls) > sitemapMaxURLs {
+		parts = append(parts, urls[:sitemapMaxURLs])
+		urls = urls[sitemapMaxURLs:]
+	}
+	return append(parts, urls)
+}
+
+// generateSitemap builds one sitemap file
+func generateSitemap(urls []sitemapURL) ([]byte, error) {
+	set := sitemapURLSet{
+		XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9",
+		URLs:  urls,
+	}
+	for _, u := range urls {
+		if len(u.Alternates) > 0 {
+			set.XHTMLNS = "http://www.w3.org/1999/xhtml"
+		}
+		if len(u.Images) > 0 {
+			set.ImageNS = "http://www.google.com/schemas/sitemap-image/1.1"
+		}
+	}
+	return marshalXML(set)
+}
+
+// generateSitemapIndex builds the index of a split sitemap
+func generateSitemapIndex(parts [][]sitemapURL, lang string) ([]byte, error) {
+	index := sitemapIndex{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for i, part := range parts {
+		var modified time.Time
+		for _, u := range part {
+			modified = newestTime(modified, u.modified)
+		}
+		index.Sitemaps = append(index.Sitemaps, sitemapRef{
+			Loc:     appConfig.SiteURL + langPrefix(lang) + "/sitemap-" + strconv.Itoa(i+1) + ".xml",
+			LastMod: sitemapLastMod(modified),
+		})
+	}
+	return marshalXML(index)
+}
+
+// Sitemap.xml route: the whole sitemap, or an index of its parts on large sites
+func handleSitemap(c *gin.Context) {
+	lang := requestLang(c)
+	parts := sitemapParts(sitemapURLs(lang))
+	var out []byte
+	var err error
+	if len(parts) == 1 {
+		out, err = generateSitemap(parts[0])
+	} else {
+		out, err = generateSitemapIndex(parts, lang)
+	}
+	if err != nil {
+		renderError(c, http.StatusInternalServerError, "internal_error", "internal_error_message")
+		return
+	}
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", out)
+}
+
+// Sitemap part route (/sitemap-N.xml), only present when the sitemap was split
+func handleSitemapPart(c *gin.Context) {
+	lang := requestLang(c)
+	n, err := strconv.Atoi(strings.TrimSuffix(c.Param("part"), ".xml"))
+	parts := sitemapParts(sitemapURLs(lang))
+	if err != nil || !strings.HasSuffix(c.Param("part"), ".xml") || len(parts) == 1 || n < 1 || n > len(parts) {
+		renderError(c, http.StatusNotFound, "page_not_found", "page_not_found_message")
+		return
+	}
+	out, err := generateSitemap(parts[n-1])
+	if err != nil {
+		renderError(c, http.StatusInternalServerError, "internal_error", "internal_error_message")
+		return
+	}
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", out)
+}
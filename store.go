@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jsonStore keeps runtime state (comments, subscribers, ...) as a JSON file in
+// the data folder. Writes go through a temp file and a rename, so a crash never
+// leaves a half-written file behind.
+type jsonStore struct {
+	mu   sync.Mutex
+	name string
+}
+
+// newJSONStore returns a store for a file name inside data_folder
+func newJSONStore(name string) *jsonStore {
+	return &jsonStore{name: name}
+}
+
+func (s *jsonStore) path() string {
+	return filepath.Join(appConfig.DataFolder, s.name)
+}
+
+// load decodes the file into v, leaving v untouched when the file doesn't exist yet
+func (s *jsonStore) load(v interface{}) error {
+	data, err := ioutil.ReadFile(s.path())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *jsonStore) save(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(appConfig.DataFolder, 0755); err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(appConfig.DataFolder, s.name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), s.path())
+}
+
+// Read loads the stored value into v
+func (s *jsonStore) Read(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(v)
+}
+
+// Update loads the stored value into v, calls fn to modify it and saves the
+// result. Nothing is written when fn returns an error.
+func (s *jsonStore) Update(v interface{}, fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(v); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return s.save(v)
+}
+
+// honeypotField is a text input that every form readers submit (comments,
+// newsletter, contact forms) hides with CSS
+const honeypotField = "_company"
+
+// honeypotFilled reports whether a submission filled in the honeypot. Bots
+// fill in every field; people never see it, so callers drop the submission
+// and pretend it worked.
+func honeypotFilled(c *gin.Context) bool {
+	return c.PostForm(honeypotField) != ""
+}
+
+// rateLimiter counts events per key (usually a client IP) in a sliding window
+type rateLimiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	hits   map[string][]time.Time
+}
+
+func newRateLimiter(window time.Duration) *rateLimiter {
+	return &rateLimiter{window: window, hits: map[string][]time.Time{}}
+}
+
+// Allow records an event for key and reports whether it is within limit events
+// per window. The limit is passed per call so config reloads apply at once.
+func (r *rateLimiter) Allow(key string, limit int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-r.window)
+	recent := r.hits[key][:0]
+	for _, t := range r.hits[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= limit {
+		r.hits[key] = recent
+		return false
+	}
+	r.hits[key] = append(recent, now)
+
+	// Forget idle clients now and then so the map doesn't grow forever
+	if len(r.hits) > 10000 {
+		for k, times := range r.hits {
+			if len(times) == 0 || times[len(times)-1].Before(cutoff) {
+				delete(r.hits, k)
+			}
+		}
+	}
+	return true
+}
+
+// randomID returns a random hex identifier of n bytes
+func randomID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
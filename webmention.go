@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/html"
+)
+
+// WebmentionConfig controls sending and receiving webmentions
+type WebmentionConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// Webmention is a verified mention of one of our posts, stored in data/webmentions.json
+type Webmention struct {
+	Source     string    `json:"source"`
+	Target     string    `json:"target"`
+	Post       string    `json:"post"`
+	Lang       string    `json:"lang"`
+	Type       string    `json:"type"` // "like", "repost", "reply" or "mention"
+	AuthorName string    `json:"author_name"`
+	AuthorURL  string    `json:"author_url"`
+	Content    string    `json:"content,omitempty"`
+	URL        string    `json:"url"`
+	Published  string    `json:"published,omitempty"`
+	Verified   time.Time `json:"verified"`
+}
+
+// WebmentionGroups holds the mentions of a post by type, for post.html
+type WebmentionGroups struct {
+	Likes    []Webmention
+	Reposts  []Webmention
+	Replies  []Webmention
+	Mentions []Webmention
+}
+
+// webmentionRequest is a received mention waiting to be verified
+type webmentionRequest struct {
+	Source, Target, Post, Lang string
+}
+
+var (
+	webmentionStore     = newJSONStore("webmentions.json")
+	webmentionSentStore = newJSONStore("webmentions-sent.json")
+	webmentionQueue     = make(chan webmentionRequest, 100)
+	webmentionLimiter   = newRateLimiter(10 * time.Minute)
+
+	// errWebmentionGone and errWebmentionNoLink mean the mention no longer
+	// exists, unlike errors fetching a source that may be down for a while
+	errWebmentionGone   = errors.New("source was deleted")
+	errWebmentionNoLink = errors.New("source does not link to target")
+
+	// webmentionClient fetches sources, targets and endpoints. Tests can swap
+	// it for a client that reaches a local stand-in server.
+	webmentionClient = newPublicHTTPClient(15 * time.Second)
+)
+
+func init() {
+	onPublish(sendWebmentions)
+}
+
+// webmentionEndpoint returns the absolute URL of our webmention endpoint, or "" when disabled
+func webmentionEndpoint() string {
+	if !appConfig.Webmention.Enabled {
+		return ""
+	}
+	return appConfig.SiteURL + "/webmention"
+}
+
+// Webmention receiving endpoint (https://www.w3.org/TR/webmention/#receiving-webmentions)
+func handleWebmention(c *gin.Context) {
+	if !appConfig.Webmention.Enabled {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if !webmentionLimiter.Allow(c.ClientIP(), 30) {
+		c.String(http.StatusTooManyRequests, "Too many webmentions, try again later\n")
+		return
+	}
+
+	source, target := c.PostForm("source"), c.PostForm("target")
+	sourceURL, err := url.Parse(source)
+	if err != nil || (sourceURL.Scheme != "http" && sourceURL.Scheme != "https") || sourceURL.Host == "" {
+		c.String(http.StatusBadRequest, "source must be an http(s) URL\n")
+		return
+	}
+	if source == target {
+		c.String(http.StatusBadRequest, "source and target must differ\n")
+		return
+	}
+	slug, lang, ok := webmentionTargetPost(target)
+	if !ok {
+		c.String(http.StatusBadRequest, "target is not a post on this site\n")
+		return
+	}
+
+	// Verification fetches the source, so it happens in the background
+	select {
+	case webmentionQueue <- webmentionRequest{Source: source, Target: target, Post: slug, Lang: lang}:
+		c.String(http.StatusAccepted, "Webmention accepted, it will be verified shortly\n")
+	default:
+		c.String(http.StatusServiceUnavailable, "Too many webmentions waiting, try again later\n")
+	}
+}
+
+// webmentionTargetPost maps a target URL to a published post of this site
+func webmentionTargetPost(target string) (string, string, bool) {
+	u, err := url.Parse(target)
+	site, siteErr := url.Parse(appConfig.SiteURL)
+	if err != nil || siteErr != nil || !strings.EqualFold(u.Host, site.Host) {
+		return "", "", false
+	}
+
+	path := strings.TrimPrefix(u.Path, strings.TrimSuffix(site.Path, "/"))
+	lang := defaultLanguage()
+	for _, l := range appConfig.Languages {
+		if l.Code != defaultLanguage() && strings.HasPrefix(path, "/"+l.Code+"/") {
+			lang = l.Code
+			path = strings.TrimPrefix(path, "/"+l.Code)
+			break
+		}
+	}
+
+	slug := strings.TrimSuffix(strings.TrimPrefix(path, "/posts/"), "/")
+	if !strings.HasPrefix(path, "/posts/") || slug == "" || strings.Contains(slug, "/") || isLocalizedSlug(slug) {
+		return "", "", false
+	}
+	doc, err := loadMarkdownFile("posts", langFileSlug(slug, lang))
+	if err != nil || !isPostLive(doc) {
+		return "", "", false
+	}
+	return slug, lang, true
+}
+
+// processWebmentions verifies queued webmentions until the service stops
+func (p *program) processWebmentions() {
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case req := <-webmentionQueue:
+			processWebmention(req)
+		}
+	}
+}
+
+// processWebmention verifies one webmention and stores, updates or removes it
+func processWebmention(req webmentionRequest) {
+	mention, err := verifyWebmention(req.Source, req.Target)
+	if err != nil {
+		log.Printf("Webmention from %s rejected: %v", req.Source, err)
+		// A source that can't be fetched right now keeps its earlier mention
+		if !errors.Is(err, errWebmentionGone) && !errors.Is(err, errWebmentionNoLink) {
+			return
+		}
+	}
+
+	var mentions []Webmention
+	err = webmentionStore.Update(&mentions, func() error {
+		// A source that no longer links to us (or is gone) removes its earlier mention
+		kept := mentions[:0]
+		for _, m := range mentions {
+			if m.Source != req.Source || m.Target != req.Target {
+				kept = append(kept, m)
+			}
+		}
+		mentions = kept
+		if mention != nil {
+			mention.Post, mention.Lang = req.Post, req.Lang
+			mentions = append(mentions, *mention)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error saving webmention from %s: %v", req.Source, err)
+		return
+	}
+	if mention != nil {
+		log.Printf("Webmention (%s) from %s for %s", mention.Type, req.Source, req.Target)
+	}
+}
+
+// verifyWebmention fetches the source and checks that it links to the target.
+// It returns the parsed mention, or nil and an error when the mention is invalid.
+func verifyWebmention(source, target string) (*Webmention, error) {
+	resp, err := webmentionClient.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return nil, errWebmentionGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("source returned %s", resp.Status)
+	}
+	body, err := readLimited(resp.Body, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	base := resp.Request.URL
+	link := findNode(doc, func(n *html.Node) bool {
+		for _, name := range []string{"href", "src"} {
+			if v := htmlAttr(n, name); v != "" && sameURL(resolveURL(base, v), target) {
+				return true
+			}
+		}
+		return false
+	})
+	if link == nil {
+		return nil, errWebmentionNoLink
+	}
+
+	mention := &Webmention{
+		Source:     source,
+		Target:     target,
+		Type:       "mention",
+		AuthorName: base.Host,
+		AuthorURL:  base.Scheme + "://" + base.Host + "/",
+		URL:        source,
+		Verified:   time.Now(),
+	}
+
+	// Read the h-entry around the link (microformats2), if there is one
+	entry := link
+	for entry != nil && !hasClass(entry, "h-entry") {
+		entry = entry.Parent
+	}
+	if entry == nil {
+		if title := findNode(doc, func(n *html.Node) bool { return n.Data == "title" }); title != nil {
+			mention.Content = generateExcerpt(nodeText(title), 200)
+		}
+		return mention, nil
+	}
+
+	switch {
+	case hasClass(link, "u-like-of"):
+		mention.Type = "like"
+	case hasClass(link, "u-repost-of"):
+		mention.Type = "repost"
+	case hasClass(link, "u-in-reply-to"):
+		mention.Type = "reply"
+	}
+	if author := findNode(entry, func(n *html.Node) bool { return hasClass(n, "p-author") }); author != nil {
+		mention.AuthorName = nodeText(author)
+		if name := findNode(author, func(n *html.Node) bool { return hasClass(n, "p-name") }); name != nil {
+			mention.AuthorName = nodeText(name)
+		}
+		if href := htmlAttr(author, "href"); href != "" {
+			mention.AuthorURL = resolveURL(base, href)
+		} else if u := findNode(author, func(n *html.Node) bool { return hasClass(n, "u-url") }); u != nil {
+			mention.AuthorURL = resolveURL(base, htmlAttr(u, "href"))
+		}
+	}
+	if content := findNode(entry, func(n *html.Node) bool { return hasClass(n, "e-content") || hasClass(n, "p-content") }); content != nil {
+		mention.Content = generateExcerpt(nodeText(content), 500)
+	}
+	if published := findNode(entry, func(n *html.Node) bool { return hasClass(n, "dt-published") }); published != nil {
+		mention.Published = htmlAttr(published, "datetime")
+		if mention.Published == "" {
+			mention.Published = nodeText(published)
+		}
+	}
+	if u := findNode(entry, func(n *html.Node) bool { return hasClass(n, "u-url") && !hasClass(n, "p-author") }); u != nil {
+		if href := htmlAttr(u, "href"); href != "" {
+			mention.URL = resolveURL(base, href)
+		}
+	}
+	return mention, nil
+}
+
+// postWebmentions returns the stored mentions of a post grouped by type, or nil when there are none
+func postWebmentions(slug, lang string) *WebmentionGroups {
+	if !appConfig.Webmention.Enabled {
+		return nil
+	}
+	var mentions []Webmention
+	if err := webmentionStore.Read(&mentions); err != nil {
+		log.Printf("Warning: Failed to read webmentions: %v", err)
+		return nil
+	}
+
+	groups := &WebmentionGroups{}
+	found := false
+	for _, m := range mentions {
+		if m.Post != slug || m.Lang != lang {
+			continue
+		}
+		found = true
+		switch m.Type {
+		case "like":
+			groups.Likes = append(groups.Likes, m)
+		case "repost":
+			groups.Reposts = append(groups.Reposts, m)
+		case "reply":
+			groups.Replies = append(groups.Replies, m)
+		default:
+			groups.Mentions = append(groups.Mentions, m)
+		}
+	}
+	if !found {
+		return nil
+	}
+	return groups
+}
+
+// sendWebmentions notifies the sites a published or updated post links to.
+// Links removed by an edit are notified too, so those sites can drop the mention.
+func sendWebmentions(ev PublishEvent) {
+	if !appConfig.Webmention.Enabled {
+		return
+	}
+	targets := outboundLinks(ev.Doc.HTML)
+
+	goBackground(func() {
+		var sent map[string][]string
+		if err := webmentionSentStore.Read(&sent); err != nil {
+			log.Printf("Warning: Failed to read sent webmentions: %v", err)
+		}
+		notify := append([]string{}, targets...)
+		for _, old := range sent[ev.URL] {
+			if !containsString(notify, old) {
+				notify = append(notify, old)
+			}
+		}
+
+		for _, target := range notify {
+			if err := sendWebmention(ev.URL, target); err != nil {
+				log.Printf("Webmention to %s not sent: %v", target, err)
+			}
+		}
+
+		err := webmentionSentStore.Update(&sent, func() error {
+			if sent == nil {
+				sent = map[string][]string{}
+			}
+			sent[ev.URL] = targets
+			return nil
+		})
+		if err != nil {
+			log.Printf("Warning: Failed to record sent webmentions: %v", err)
+		}
+	})
+}
+
+// sendWebmention discovers the webmention endpoint of target and notifies it
+// that source links to it. Targets without an endpoint are skipped silently.
+func sendWebmention(source, target string) error {
+	endpoint, err := discoverWebmentionEndpoint(target)
+	if err != nil || endpoint == "" {
+		return err
+	}
+	resp, err := webmentionClient.PostForm(endpoint, url.Values{"source": {source}, "target": {target}})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint %s returned %s", endpoint, resp.Status)
+	}
+	log.Printf("Sent webmention for %s to %s", target, endpoint)
+	return nil
+}
+
+// discoverWebmentionEndpoint finds the endpoint of a URL from its Link header
+// or the first <link>/<a> element with rel="webmention"
+func discoverWebmentionEndpoint(target string) (string, error) {
+	resp, err := webmentionClient.Get(target)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	base := resp.Request.URL
+
+	for _, header := range resp.Header["Link"] {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			href := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			for _, param := range parts[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "rel=") && hasRel(strings.Trim(param[4:], `"`), "webmention") {
+					return resolveURL(base, href), nil
+				}
+			}
+		}
+	}
+
+	if !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return "", nil
+	}
+	body, err := readLimited(resp.Body, 1<<20)
+	if err != nil {
+		return "", err
+	}
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	link := findNode(doc, func(n *html.Node) bool {
+		return (n.Data == "link" || n.Data == "a") && hasRel(htmlAttr(n, "rel"), "webmention") && hasAttr(n, "href")
+	})
+	if link == nil {
+		return "", nil
+	}
+	return resolveURL(base, htmlAttr(link, "href")), nil
+}
+
+// outboundLinks returns the distinct absolute links in rendered post HTML that
+// point to other sites
+func outboundLinks(content string) []string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+	site, _ := url.Parse(appConfig.SiteURL)
+	var links []string
+	findNode(doc, func(n *html.Node) bool {
+		if n.Data != "a" {
+			return false
+		}
+		u, err := url.Parse(htmlAttr(n, "href"))
+		if err == nil && (u.Scheme == "http" || u.Scheme == "https") &&
+			(site == nil || !strings.EqualFold(u.Host, site.Host)) {
+			u.Fragment = ""
+			if !containsString(links, u.String()) {
+				links = append(links, u.String())
+			}
+		}
+		return false
+	})
+	return links
+}
+
+// findNode returns the first element below n (in document order) that matches
+func findNode(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findNode(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// htmlAttr returns the value of an attribute of an element
+func htmlAttr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, name string) bool {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasClass reports whether an element has a class
+func hasClass(n *html.Node, class string) bool {
+	return n.Type == html.ElementNode && containsString(strings.Fields(htmlAttr(n, "class")), class)
+}
+
+// hasRel reports whether a space-separated rel value contains rel
+func hasRel(rels, rel string) bool {
+	for _, r := range strings.Fields(rels) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeText returns the text of an element with whitespace collapsed
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		// Keep words in separate blocks apart
+		switch n.Data {
+		case "p", "div", "br", "li", "blockquote", "h1", "h2", "h3", "h4", "h5", "h6":
+			b.WriteString(" ")
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// resolveURL resolves a possibly relative reference against base
+func resolveURL(base *url.URL, ref string) string {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// sameURL compares two URLs, ignoring a trailing slash and the fragment
+func sameURL(a, b string) bool {
+	clean := func(s string) string {
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		return strings.TrimSuffix(s, "/")
+	}
+	return a != "" && clean(a) == clean(b)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useTestNetwork lets the webmention and ActivityPub clients reach httptest
+// servers, which listen on loopback, and keeps the data files in a temporary
+// folder
+func useTestNetwork(t *testing.T) {
+	t.Helper()
+	wmClient, apClient, dataFolder := webmentionClient, activityPubClient, appConfig.DataFolder
+	webmentionClient = &http.Client{Timeout: 5 * time.Second}
+	activityPubClient = &http.Client{Timeout: 5 * time.Second}
+	appConfig.DataFolder = t.TempDir()
+	t.Cleanup(func() {
+		webmentionClient, activityPubClient, appConfig.DataFolder = wmClient, apClient, dataFolder
+	})
+}
+
+func TestDiscoverWebmentionEndpoint(t *testing.T) {
+	useTestNetwork(t)
+	tests := []struct {
+		name   string
+		header string
+		body   string
+		want   string
+	}{
+		{"link header", `<https://example.com/a>; rel="other", </webmention>; rel="webmention"`, "", "/webmention"},
+		{"link element", "", `<html><head><link rel="webmention" href="/wm/link"></head></html>`, "/wm/link"},
+		{"anchor", "", `<p><a href="/wm/a" rel="nofollow webmention">endpoint</a></p>`, "/wm/a"},
+		{"header before body", `</from-header>; rel=webmention`, `<link rel="webmention" href="/from-body">`, "/from-header"},
+		{"none", "", `<p><a href="/elsewhere">no endpoint</a></p>`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("Link", tt.header)
+				}
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			got, err := discoverWebmentionEndpoint(srv.URL + "/post")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want != "" {
+				want = srv.URL + want
+			}
+			if got != want {
+				t.Errorf("endpoint = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyWebmention(t *testing.T) {
+	useTestNetwork(t)
+	target := "http://localhost:8080/posts/first-post"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/reply":
+			fmt.Fprintf(w, `<div class="h-entry">
+				<a class="p-author h-card" href="/me"><span class="p-name">Ada</span></a>
+				<a class="u-in-reply-to" href="%s">in reply to</a>
+				<p class="e-content">Nice post!</p>
+				<time class="dt-published" datetime="2025-01-02T03:04:05Z">Jan 2</time>
+			</div>`, target)
+		case "/unlinked":
+			fmt.Fprint(w, `<p>This page links <a href="http://localhost:8080/posts/other">elsewhere</a>.</p>`)
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	mention, err := verifyWebmention(srv.URL+"/reply", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mention.Type != "reply" || mention.AuthorName != "Ada" || mention.AuthorURL != srv.URL+"/me" ||
+		mention.Content != "Nice post!" || mention.Published != "2025-01-02T03:04:05Z" {
+		t.Errorf("mention = %+v", mention)
+	}
+
+	if _, err := verifyWebmention(srv.URL+"/unlinked", target); err != errWebmentionNoLink {
+		t.Errorf("unlinked source: err = %v, want %v", err, errWebmentionNoLink)
+	}
+	if _, err := verifyWebmention(srv.URL+"/gone", target); err != errWebmentionGone {
+		t.Errorf("deleted source: err = %v, want %v", err, errWebmentionGone)
+	}
+	if _, err := verifyWebmention(srv.URL+"/error", target); err == nil {
+		t.Error("failing source: no error")
+	}
+}
+
+func TestProcessWebmention(t *testing.T) {
+	useTestNetwork(t)
+	target := "http://localhost:8080/posts/first-post"
+	status, linked := http.StatusOK, true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if status == http.StatusOK && linked {
+			fmt.Fprintf(w, `<p>See <a href="%s">this post</a>.</p>`, target)
+		}
+	}))
+	defer srv.Close()
+	req := webmentionRequest{Source: srv.URL + "/source", Target: target, Post: "first-post", Lang: "en"}
+
+	stored := func() int {
+		var mentions []Webmention
+		if err := webmentionStore.Read(&mentions); err != nil {
+			t.Fatal(err)
+		}
+		return len(mentions)
+	}
+
+	processWebmention(req)
+	if n := stored(); n != 1 {
+		t.Fatalf("after verifying: %d mentions, want 1", n)
+	}
+	processWebmention(req)
+	if n := stored(); n != 1 {
+		t.Fatalf("after verifying again: %d mentions, want 1", n)
+	}
+
+	for _, status = range []int{http.StatusInternalServerError, http.StatusNotFound, http.StatusServiceUnavailable} {
+		processWebmention(req)
+		if n := stored(); n != 1 {
+			t.Fatalf("after status %d: %d mentions, want 1", status, n)
+		}
+	}
+
+	status, linked = http.StatusOK, false
+	processWebmention(req)
+	if n := stored(); n != 0 {
+		t.Fatalf("after the link was removed: %d mentions, want 0", n)
+	}
+
+	linked = true
+	processWebmention(req)
+	status = http.StatusGone
+	processWebmention(req)
+	if n := stored(); n != 0 {
+		t.Fatalf("after 410: %d mentions, want 0", n)
+	}
+}
+
+func TestSendWebmentions(t *testing.T) {
+	useTestNetwork(t)
+	enabled := appConfig.Webmention.Enabled
+	appConfig.Webmention.Enabled = true
+	defer func() { appConfig.Webmention.Enabled = enabled }()
+
+	var mu sync.Mutex
+	var received []url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `</webmention>; rel="webmention"`)
+		fmt.Fprint(w, "<p>An article</p>")
+	})
+	mux.HandleFunc("/no-endpoint", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<p>Nothing to see</p>")
+	})
+	mux.HandleFunc("/webmention", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("endpoint called with %s", r.Method)
+		}
+		r.ParseForm()
+		mu.Lock()
+		received = append(received, r.PostForm)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	source := "http://localhost:8080/posts/first-post"
+	sendWebmentions(PublishEvent{
+		URL: source,
+		Doc: &MarkdownFile{HTML: fmt.Sprintf(`<p><a href="%[1]s/article#intro">one</a>, <a href="%[1]s/no-endpoint">two</a>,
+			<a href="/posts/local">local</a>, <a href="%[1]s/article">one again</a></p>`, srv.URL)},
+	})
+	backgroundTasks.Wait()
+
+	if len(received) != 1 {
+		t.Fatalf("endpoint received %d webmentions, want 1: %v", len(received), received)
+	}
+	if got := received[0].Get("source"); got != source {
+		t.Errorf("source = %q, want %q", got, source)
+	}
+	if got, want := received[0].Get("target"), srv.URL+"/article"; got != want {
+		t.Errorf("target = %q, want %q", got, want)
+	}
+
+	var sent map[string][]string
+	if err := webmentionSentStore.Read(&sent); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent[source]) != 2 {
+		t.Errorf("recorded targets = %v, want the two outbound links", sent[source])
+	}
+}
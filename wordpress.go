@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// wordpressSource reads a WordPress export (WXR) file, as written by
+// Tools > Export in the WordPress admin
+type wordpressSource struct {
+	file string
+	site *url.URL // the old site, to tell its links and uploads apart
+}
+
+// wxrExport is the part of a WXR file the importer reads. Elements are matched
+// by local name, which is unique among the ones used here.
+type wxrExport struct {
+	Link        string      `xml:"channel>link"`
+	BaseSiteURL string      `xml:"channel>base_site_url"`
+	Authors     []wxrAuthor `xml:"channel>author"`
+	Items       []wxrItem   `xml:"channel>item"`
+}
+
+type wxrAuthor struct {
+	Login       string `xml:"author_login"`
+	DisplayName string `xml:"author_display_name"`
+}
+
+type wxrItem struct {
+	Title         string        `xml:"title"`
+	Link          string        `xml:"link"`
+	Creator       string        `xml:"creator"`
+	Encoded       []wxrEncoded  `xml:"encoded"`
+	PostID        string        `xml:"post_id"`
+	PostDate      string        `xml:"post_date"`
+	PostModified  string        `xml:"post_modified"`
+	PostName      string        `xml:"post_name"`
+	Status        string        `xml:"status"`
+	PostType      string        `xml:"post_type"`
+	AttachmentURL string        `xml:"attachment_url"`
+	Categories    []wxrCategory `xml:"category"`
+	Meta          []wxrMeta     `xml:"postmeta"`
+}
+
+// wxrEncoded is content:encoded (the body) or excerpt:encoded, told apart by
+// their namespace
+type wxrEncoded struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type wxrCategory struct {
+	Domain string `xml:"domain,attr"`
+	Name   string `xml:",chardata"`
+}
+
+type wxrMeta struct {
+	Key   string `xml:"meta_key"`
+	Value string `xml:"meta_value"`
+}
+
+// wordpressShortcode matches a shortcode tag such as [gallery ids="1,2"] or [/embed]
+var wordpressShortcode = regexp.MustCompile(`\[(/?)([a-zA-Z][\w-]*)([^\]]*)\]`)
+
+// wordpressEmbed matches an [embed] shortcode around a URL
+var wordpressEmbed = regexp.MustCompile(`\[embed[^\]]*\](.*?)\[/embed\]`)
+
+// items reads the posts and pages of the export; attachments are only used
+// to find featured images
+func (ws *wordpressSource) items(im *importer) ([]*importedItem, error) {
+	f, err := os.Open(ws.file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var export wxrExport
+	if err := xml.NewDecoder(f).Decode(&export); err != nil {
+		return nil, fmt.Errorf("%s is not a WordPress export: %v", ws.file, err)
+	}
+	site := export.Link
+	if site == "" {
+		site = export.BaseSiteURL
+	}
+	ws.site, _ = url.Parse(site)
+	if ws.site == nil {
+		ws.site = &url.URL{}
+	}
+
+	authors := map[string]string{}
+	for _, a := range export.Authors {
+		if a.DisplayName != "" {
+			authors[a.Login] = a.DisplayName
+		}
+	}
+	attachments := map[string]string{}
+	for _, it := range export.Items {
+		if it.PostType == "attachment" && it.AttachmentURL != "" {
+			attachments[it.PostID] = it.AttachmentURL
+		}
+	}
+
+	var items []*importedItem
+	skipped := map[string]int{}
+	for _, it := range export.Items {
+		if it.PostType != "post" && it.PostType != "page" {
+			if it.PostType != "attachment" && it.PostType != "nav_menu_item" {
+				skipped[it.PostType]++
+			}
+			continue
+		}
+		source := fmt.Sprintf("%s %s (%s)", it.PostType, it.PostID, strings.TrimSpace(it.Title))
+		item := &importedItem{
+			Kind:   it.PostType,
+			Source: source,
+			Slug:   it.PostName,
+			Title:  strings.TrimSpace(it.Title),
+			Date:   parseImportedTime(it.PostDate),
+		}
+		if it.PostModified != "" {
+			item.Updated = parseImportedTime(it.PostModified)
+		}
+		switch it.Status {
+		case "publish", "future":
+			// future posts keep their date, which schedules them
+		case "draft", "pending", "private", "auto-draft":
+			item.Draft = true
+			if it.Status == "private" {
+				im.note(source, "was private, imported as a draft")
+			}
+		default:
+			im.note(source, "not imported, status %q", it.Status)
+			continue
+		}
+		if a, ok := authors[it.Creator]; ok {
+			item.Author = a
+		} else {
+			item.Author = it.Creator
+		}
+		for _, c := range it.Categories {
+			name := strings.TrimSpace(c.Name)
+			if (c.Domain == "post_tag" || c.Domain == "category") && name != "" && name != "Uncategorized" {
+				item.Tags = append(item.Tags, name)
+			}
+		}
+		for _, e := range it.Encoded {
+			if strings.Contains(e.XMLName.Space, "excerpt") {
+				item.Description = html.UnescapeString(stripHTML(e.Value))
+			} else {
+				item.Body = e.Value
+			}
+		}
+		for _, m := range it.Meta {
+			if m.Key == "_thumbnail_id" {
+				if u, ok := attachments[m.Value]; ok {
+					item.Image = u
+				}
+			}
+		}
+		if u, err := url.Parse(it.Link); err == nil && u.RawQuery == "" && u.Path != "" {
+			item.Aliases = append(item.Aliases, u.Path)
+		}
+		items = append(items, item)
+	}
+
+	var types []string
+	for t := range skipped {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		im.note(ws.file, "%d items of type %q not imported", skipped[t], t)
+	}
+	return items, nil
+}
+
+// convert converts the HTML body of a post or page, downloading uploaded
+// media and pointing links between posts at their new URLs
+func (ws *wordpressSource) convert(im *importer, item *importedItem) string {
+	if item.Image != "" {
+		if sitePath := ws.media(im, item, item.Image); sitePath != "" {
+			item.Image = sitePath
+		}
+	}
+
+	body := wordpressEmbed.ReplaceAllString(item.Body, "<p><a href=\"$1\">$1</a></p>")
+	reported := map[string]bool{}
+	body = wordpressShortcode.ReplaceAllStringFunc(body, func(tag string) string {
+		name := wordpressShortcode.FindStringSubmatch(tag)[2]
+		if name == "caption" {
+			return ""
+		}
+		if !reported[name] {
+			reported[name] = true
+			im.note(item.file, "shortcode [%s] left as text", name)
+		}
+		return tag
+	})
+	if !strings.Contains(body, "<p") {
+		body = wordpressAutoP(body)
+	}
+
+	return im.convertHTML(item, body, func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil || (isExternalURL(u) && u.Host != ws.site.Host) {
+			return raw
+		}
+		if strings.Contains(u.Path, "/wp-content/uploads/") {
+			if sitePath := ws.media(im, item, raw); sitePath != "" {
+				return sitePath
+			}
+			return raw
+		}
+		if newPath, ok := im.movedPath(u.Path); ok {
+			if u.Fragment != "" {
+				newPath += "#" + u.Fragment
+			}
+			return newPath
+		}
+		if u.Host == ws.site.Host && u.Path != "" && u.Path != "/" {
+			im.note(item.file, "link to %s on the old site was not mapped", raw)
+		}
+		return raw
+	})
+}
+
+// media downloads a file uploaded to WordPress, keeping the year/month folders
+// of its uploads path
+func (ws *wordpressSource) media(im *importer, item *importedItem, raw string) string {
+	u, err := ws.site.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if i := strings.Index(u.Path, "/wp-content/uploads/"); i >= 0 {
+		name = u.Path[i+len("/wp-content/uploads/"):]
+	}
+	return im.downloadMedia(item.file, u.String(), name)
+}
+
+// wordpressBlock matches content starting with a block element, which
+// wordpressAutoP leaves unwrapped
+var wordpressBlock = regexp.MustCompile(`(?i)^<(p|div|h[1-6]|ul|ol|blockquote|pre|table|figure|hr|iframe|!--)[\s>/-]`)
+
+// wordpressAutoP adds the paragraphs WordPress adds when it displays a post
+// written in the classic editor: blank lines separate paragraphs and single
+// line breaks are kept
+func wordpressAutoP(body string) string {
+	var blocks []string
+	for _, block := range regexp.MustCompile(`\n\s*\n`).Split(strings.ReplaceAll(body, "\r\n", "\n"), -1) {
+		block = strings.TrimSpace(block)
+		if block == "" {
+			continue
+		}
+		if !wordpressBlock.MatchString(block) {
+			block = "<p>" + strings.ReplaceAll(block, "\n", "<br>") + "</p>"
+		}
+		blocks = append(blocks, block)
+	}
+	return strings.Join(blocks, "\n")
+}